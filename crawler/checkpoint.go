@@ -0,0 +1,164 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+// CheckpointVersion is the version of the checkpoint format.
+const CheckpointVersion = 1
+
+// Checkpoint is the saved state of a crawl in progress.
+type Checkpoint struct {
+	Version int
+
+	// The graph discovered so far. Nodes in the frontier have no outgoing
+	// edges yet.
+	Graph G.CrawlFile
+
+	// The URLs of the nodes that have yet to be loaded, in the order in which
+	// they should be requested.
+	Frontier []string
+
+	// The number of requests made so far (not including those for the nodes
+	// in the frontier).
+	Requests uint64
+}
+
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	var cp Checkpoint
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, err
+	}
+
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("Unsupported checkpoint version %v", cp.Version)
+	}
+
+	return &cp, nil
+}
+
+// Resume continues a crawl from a checkpoint. A source is created for each
+// node in the frontier by calling makeSource with its URL and depth.
+func Resume(ctx context.Context, cp *Checkpoint, makeSource func(url string, depth int) (S.Source, error), options Options) (*G.Node, error) {
+	g, err := ResumeGraph(ctx, cp, makeSource, options)
+	if g == nil {
+		return nil, err
+	}
+	return g.Root(), err
+}
+
+// ResumeGraph is like Resume, but returns the graph indexed for queries rather
+// than just its root.
+func ResumeGraph(ctx context.Context, cp *Checkpoint, makeSource func(url string, depth int) (S.Source, error), options Options) (*G.Graph, error) {
+	root, _, err := G.FromCrawlFile(cp.Graph)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &crawlState{
+		root:              root,
+		urlToNode:         make(map[string]*G.Node),
+		inEdges:           make(map[*G.Node][]G.Edge),
+		inFlight:          make(map[*G.Node]bool),
+		requested:         make(map[*G.Node]bool),
+		completedRequests: cp.Requests,
+	}
+
+	G.Traverse(root, func(node *G.Node) {
+		state.urlToNode[node.Url] = node
+		for _, e := range node.Out {
+			state.inEdges[e.Node] = append(state.inEdges[e.Node], G.Edge{Kind: e.Kind, Node: node})
+		}
+
+		// Pure assets haven't been requested unless they were loaded (or are
+		// in the frontier).
+		if !node.PureAsset || node.Metadata != nil {
+			state.requested[node] = true
+		}
+	})
+
+	// Links to the pages that were merged into others because of their
+	// <link rel="canonical"> lead to the pages they were merged into.
+	G.Traverse(root, func(node *G.Node) {
+		for _, alias := range node.Aliases {
+			if state.urlToNode[alias] == nil {
+				state.urlToNode[alias] = node
+			}
+		}
+	})
+
+	// The frontier spans at most two levels of the graph. We request the nodes
+	// at the lower depth first to preserve the breadth first order.
+	minDepth := -1
+	for _, u := range cp.Frontier {
+		node := state.urlToNode[u]
+		if node == nil {
+			return nil, fmt.Errorf("Node %v in frontier not found in checkpoint", u)
+		}
+		if minDepth == -1 || node.Depth < minDepth {
+			minDepth = node.Depth
+		}
+	}
+
+	for _, u := range cp.Frontier {
+		node := state.urlToNode[u]
+		source, err := makeSource(u, node.Depth)
+		if err != nil {
+			return nil, err
+		}
+
+		state.requested[node] = true
+
+		r := pendingRequest{node, source}
+		if node.Depth == minDepth {
+			state.queuedRequests = append(state.queuedRequests, r)
+		} else {
+			state.nextLevelRequests = append(state.nextLevelRequests, r)
+		}
+	}
+
+	return run(ctx, state, options)
+}
+
+// writeCheckpoint saves the state of a crawl. The file is replaced atomically,
+// so that a crash while writing doesn't lose the previous checkpoint.
+func writeCheckpoint(filename string, state *crawlState, info G.CrawlInfo) error {
+	cp := Checkpoint{
+		Version:  CheckpointVersion,
+		Graph:    G.ToCrawlFile(info, state.root),
+		Frontier: []string{},
+		Requests: state.completedRequests,
+	}
+
+	for _, node := range state.frontier() {
+		cp.Frontier = append(cp.Frontier, node.Url)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), ".checkpoint-")
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates files that only the owner can read.
+	err = f.Chmod(0644)
+	if err == nil {
+		err = json.NewEncoder(f).Encode(cp)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	S "multiverse.io/crawler/crawler/source"
+	MS "multiverse.io/crawler/crawler/test_helpers/mock_source"
+)
+
+func TestCheckpointAndResume(t *testing.T) {
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	options := Options{AssetsMode: AssetsModeIncludeAssets, CheckpointFile: checkpointFile}
+	_, err := CrawlWithOptions(ctx, &endlessSource{page: 0, cancelAt: 5, cancel: cancel}, options)
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled error, got %v\n", err)
+	}
+
+	cp := readTestCheckpoint(t, checkpointFile)
+
+	if len(cp.Frontier) != 1 || cp.Frontier[0] != "/page5" || cp.Requests != 5 || len(cp.Graph.Nodes) != 6 {
+		t.Fatalf("Unexpected checkpoint %+v\n", cp)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	var madeSources []string
+	makeSource := func(url string, depth int) (S.Source, error) {
+		madeSources = append(madeSources, fmt.Sprintf("%v@%v", url, depth))
+		var page int
+		fmt.Sscanf(url, "/page%d", &page)
+		return &endlessSource{page: page, cancelAt: 8, cancel: cancel}, nil
+	}
+
+	root, err := Resume(ctx, cp, makeSource, options)
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled error, got %v\n", err)
+	}
+
+	if len(madeSources) != 1 || madeSources[0] != "/page5@5" {
+		t.Errorf("Unexpected sources made when resuming: %v\n", madeSources)
+	}
+
+	nNodes := 0
+	node := root
+	for len(node.Out) > 0 {
+		nNodes++
+		node = node.Out[0].Node
+	}
+	if root.Url != "/page0" || nNodes != 8 || node.Url != "/page8" || node.Depth != 8 {
+		t.Errorf("Expected resumed graph ending at /page8 with 8 edges; got %v edges ending at %v\n", nNodes, node.Url)
+	}
+
+	cp = readTestCheckpoint(t, checkpointFile)
+	if len(cp.Frontier) != 1 || cp.Frontier[0] != "/page8" || cp.Requests != 8 {
+		t.Errorf("Unexpected checkpoint after resuming %+v\n", cp)
+	}
+}
+
+func TestCheckpointOfCompletedCrawl(t *testing.T) {
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":      []string{"/page1", "/page2"},
+			"/page1": []string{"/page2"},
+		},
+		Assets: map[string][]string{},
+	}
+
+	options := Options{AssetsMode: AssetsModeIncludeAssets, CheckpointFile: checkpointFile}
+	if _, err := CrawlWithOptions(context.Background(), &MS.MockSource{Universe: &universe, Url: "/"}, options); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	cp := readTestCheckpoint(t, checkpointFile)
+	if len(cp.Frontier) != 0 || cp.Requests != 3 || len(cp.Graph.Nodes) != 3 || len(cp.Graph.Edges) != 3 {
+		t.Errorf("Unexpected checkpoint %+v\n", cp)
+	}
+}
+
+func TestReadCheckpointErrors(t *testing.T) {
+	for _, input := range []string{`not json`, `{"Version": 999}`} {
+		if _, err := ReadCheckpoint(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected error reading %v\n", input)
+		}
+	}
+}
+
+func readTestCheckpoint(t *testing.T, filename string) *Checkpoint {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("Couldn't open checkpoint: %v\n", err)
+	}
+	defer f.Close()
+
+	cp, err := ReadCheckpoint(f)
+	if err != nil {
+		t.Fatalf("Couldn't read checkpoint: %v\n", err)
+	}
+	return cp
+}
@@ -1,8 +1,12 @@
 package crawler
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"runtime"
-	"sync"
+	"sort"
+	"time"
 
 	G "multiverse.io/crawler/crawler/graph"
 	S "multiverse.io/crawler/crawler/source"
@@ -25,9 +29,107 @@ const (
 	AssetsModeIncludeAssets
 )
 
+// How often the state of a crawl is saved if Options.CheckpointInterval isn't
+// set.
+const DefaultCheckpointInterval = 30 * time.Second
+
+// Options configures a crawl.
+type Options struct {
+	AssetsMode AssetsMode
+
+	// If set, the state of the crawl is saved to this file periodically and
+	// when the crawl finishes (or is cancelled), so that it can be resumed
+	// with Resume.
+	CheckpointFile string
+
+	// How often to save the state of the crawl. Defaults to
+	// DefaultCheckpointInterval.
+	CheckpointInterval time.Duration
+
+	// Saved along with the graph in each checkpoint.
+	CrawlInfo G.CrawlInfo
+
+	// The pages listed in the site's sitemaps. Once the pages that can be
+	// reached by following links from the root have been crawled, the root is
+	// given an edge of kind EdgeKindSitemap to each of them. Pages that
+	// weren't reached are added at depth 1.
+	Sitemap []S.Link
+
+	// If true, the pages in Sitemap that weren't reached by following links
+	// are loaded too, along with the pages that they link to.
+	SeedSitemap bool
+
+	// Other sources to start crawling from along with the root. Each is given
+	// a node at depth 0, with an edge of kind EdgeKindSeed to it from the
+	// root, so that the whole graph is reachable from the root.
+	Seeds []S.Source
+
+	// If true, a page whose Metadata.CanonicalUrl is another URL is merged
+	// into the node for that URL, and its URL becomes one of the node's
+	// aliases.
+	MergeCanonical bool
+}
+
+// crawlState is the state of a crawl in progress. It's only accessed by
+// handleGraphUpdates.
+type crawlState struct {
+	root      *G.Node
+	urlToNode map[string]*G.Node
+
+	// The edges into each node. The Node field of each edge is the node that
+	// it comes from, so that the edges into a page can be repointed when it's
+	// merged into another without searching the whole graph.
+	inEdges map[*G.Node][]G.Edge
+
+	// We can't block when sending requests to pendingRequestChan because the
+	// workers may be blocked sending updates to us, and that could give rise to
+	// a deadlock. So we add requests to a queue and then send them to the
+	// channel as workers become available.
+	queuedRequests    []pendingRequest
+	nextLevelRequests []pendingRequest
+	inFlight          map[*G.Node]bool
+
+	// The nodes that have been (or are queued to be) requested.
+	requested map[*G.Node]bool
+
+	// Requests that returned after the crawl was cancelled, whose results we
+	// discard.
+	abandoned []*G.Node
+
+	// The number of requests whose results have been added to the graph.
+	completedRequests uint64
+
+	// Whether the sitemap has yet to be added to the graph.
+	sitemapPending bool
+
+	// Whether the right to load the first queued request has been reserved
+	// (see reserveRequest).
+	reserved bool
+}
+
 // Crawl constructs a graph by crawling a site's links and assets from a root
 // source.
 func Crawl(source S.Source, assetsMode AssetsMode) *G.Node {
+	root, _ := CrawlContext(context.Background(), source, assetsMode)
+	return root
+}
+
+// CrawlContext is like Crawl, but stops crawling if ctx is cancelled. In that
+// case, requests in flight are abandoned, and the graph built so far is
+// returned along with ctx.Err().
+func CrawlContext(ctx context.Context, source S.Source, assetsMode AssetsMode) (*G.Node, error) {
+	return CrawlWithOptions(ctx, source, Options{AssetsMode: assetsMode})
+}
+
+// CrawlWithOptions is like CrawlContext, but takes additional options.
+func CrawlWithOptions(ctx context.Context, source S.Source, options Options) (*G.Node, error) {
+	g, err := CrawlGraph(ctx, source, options)
+	return g.Root(), err
+}
+
+// CrawlGraph is like CrawlWithOptions, but returns the graph indexed for
+// queries rather than just its root.
+func CrawlGraph(ctx context.Context, source S.Source, options Options) (*G.Graph, error) {
 	root := &G.Node{
 		Url:        source.GetUrl(),
 		Out:        []G.Edge{},
@@ -36,54 +138,88 @@ func Crawl(source S.Source, assetsMode AssetsMode) *G.Node {
 		PureAsset:  false,
 	}
 
+	state := &crawlState{
+		root:           root,
+		urlToNode:      map[string]*G.Node{root.Url: root},
+		inEdges:        make(map[*G.Node][]G.Edge),
+		queuedRequests: []pendingRequest{{root, source}},
+		inFlight:       make(map[*G.Node]bool),
+		requested:      map[*G.Node]bool{root: true},
+	}
+
+	for _, seed := range options.Seeds {
+		if state.urlToNode[seed.GetUrl()] != nil {
+			continue
+		}
+
+		node := &G.Node{
+			Url:        seed.GetUrl(),
+			Out:        []G.Edge{},
+			Depth:      0,
+			Popularity: 0,
+			PureAsset:  false,
+		}
+		addEdge(state, root, G.EdgeKindSeed, node)
+
+		state.urlToNode[node.Url] = node
+		state.requested[node] = true
+		state.queuedRequests = append(state.queuedRequests, pendingRequest{node, seed})
+	}
+
+	return run(ctx, state, options)
+}
+
+func run(ctx context.Context, state *crawlState, options Options) (*G.Graph, error) {
 	pendingGraphUpdateChan := make(chan pendingGraphUpdate)
 	pendingRequestChan := make(chan pendingRequest)
 
-	var wg sync.WaitGroup
+	state.sitemapPending = len(options.Sitemap) > 0 && !hasSitemapEdges(state.root)
 
 	// Handle pending queries
 	for i := 0; i < runtime.NumCPU(); i++ {
-		go handleRequests(&wg, pendingGraphUpdateChan, pendingRequestChan)
+		go handleRequests(ctx, pendingGraphUpdateChan, pendingRequestChan)
 	}
 
-	// Handle pending graph updates. We only use one worker here because we don't
-	// want the graph to be updated by multiple threads at once.
-	go handleGraphUpdates(&wg, root, assetsMode, pendingGraphUpdateChan, pendingRequestChan)()
-
-	wg.Add(1)
-	pendingRequestChan <- pendingRequest{root, source}
+	// Handle pending graph updates. We do this on the current goroutine because
+	// we don't want the graph to be updated by multiple threads at once.
+	handleGraphUpdates(ctx, state, options, pendingGraphUpdateChan, pendingRequestChan)
 
-	wg.Wait()
-
-	close(pendingGraphUpdateChan)
+	// There are no requests in flight at this point, so this stops the workers.
 	close(pendingRequestChan)
 
-	G.Sort(root)
-	return root
+	var err error
+	if options.CheckpointFile != "" {
+		err = writeCheckpoint(options.CheckpointFile, state, options.CrawlInfo)
+	}
+
+	G.Sort(state.root)
+	if err == nil {
+		err = ctx.Err()
+	}
+	return G.NewGraph(state.root), err
 }
 
-func handleRequests(wg *sync.WaitGroup, pendingGraphUpdateChan chan<- pendingGraphUpdate, pendingRequestChan <-chan pendingRequest) {
+func handleRequests(ctx context.Context, pendingGraphUpdateChan chan<- pendingGraphUpdate, pendingRequestChan <-chan pendingRequest) {
 	for nextRequest := range pendingRequestChan {
-		outs := nextRequest.source.GetOuts()
-		wg.Add(1)
+		outs := S.GetOutsContext(ctx, nextRequest.source)
 		pendingGraphUpdateChan <- pendingGraphUpdate{nextRequest.node, outs}
-		wg.Done()
 	}
 }
 
-func handleGraphUpdates(wg *sync.WaitGroup, root *G.Node, assetsMode AssetsMode, pendingGraphUpdateChan <-chan pendingGraphUpdate, pendingRequestChan chan<- pendingRequest) func() {
-	urlToNode := make(map[string]*G.Node)
-	urlToNode[root.Url] = root
-
-	// We can't block when sending updates to pendingGraphUpdateChan because its
-	// handler blocks on us, and that could give rise to a deadlock. So we add
-	// updates to a queue and then send them to the channel as available.
-	var queuedRequests []pendingRequest
-
-	handleUpdate := func(pu pendingGraphUpdate, url string, edgeKind G.EdgeKind) *G.Node {
+// handleGraphUpdates sends requests to the workers and updates the graph with
+// the results until there is nothing left to request. If ctx is cancelled, it
+// stops sending requests and returns once the requests in flight have
+// returned.
+//
+// The graph is crawled breadth first, one level at a time: no request for a
+// node at depth d+1 is sent until every node at depth d has been loaded. So
+// each node is first discovered via a shortest path from the root, and its
+// depth doesn't depend on the order in which the workers finish.
+func handleGraphUpdates(ctx context.Context, state *crawlState, options Options, pendingGraphUpdateChan <-chan pendingGraphUpdate, pendingRequestChan chan<- pendingRequest) {
+	handleUpdate := func(pu pendingGraphUpdate, url string, aliases []string, edgeKind G.EdgeKind) *G.Node {
 		var linkNode *G.Node
 
-		if urlNode := urlToNode[url]; urlNode != nil {
+		if urlNode := state.urlToNode[url]; urlNode != nil {
 			linkNode = urlNode
 			linkNode.Popularity++
 		} else {
@@ -95,50 +231,340 @@ func handleGraphUpdates(wg *sync.WaitGroup, root *G.Node, assetsMode AssetsMode,
 			}
 		}
 
-		pu.node.Out = append(pu.node.Out, G.Edge{Kind: edgeKind, Node: linkNode})
+		addEdge(state, pu.node, edgeKind, linkNode)
+
+		for _, alias := range aliases {
+			linkNode.AddAlias(alias)
+		}
 
 		return linkNode
 	}
 
-	return func() {
-		for pu := range pendingGraphUpdateChan {
+	// Receiving from a nil channel blocks forever, so there are no ticks if
+	// we're not checkpointing.
+	var checkpointChan <-chan time.Time
+	if options.CheckpointFile != "" {
+		interval := options.CheckpointInterval
+		if interval == 0 {
+			interval = DefaultCheckpointInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		checkpointChan = ticker.C
+	}
+
+	// Fires when it may be possible to load a request that had to wait.
+	var retryTimer *time.Timer
+	defer func() {
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+	}()
+
+	for {
+		cancelled := ctx.Err() != nil
+
+		if cancelled && state.reserved {
+			S.Release(state.queuedRequests[0].source)
+			state.reserved = false
+		}
+
+		if len(state.inFlight) == 0 {
+			if cancelled {
+				return
+			}
+			if len(state.queuedRequests) == 0 {
+				if len(state.nextLevelRequests) == 0 {
+					if !state.sitemapPending {
+						return
+					}
+					addSitemap(state, options)
+					continue
+				}
+				state.queuedRequests, state.nextLevelRequests = state.nextLevelRequests, nil
+			}
+		}
+
+		// A send on a nil channel is never selected, so we only offer a request
+		// to the workers when we have one.
+		var requestChan chan<- pendingRequest
+		var nextRequest pendingRequest
+		var retryChan <-chan time.Time
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+		if len(state.queuedRequests) > 0 && !cancelled {
+			// Nothing else will make a request loadable if none are in
+			// flight, so we don't wait in that case.
+			ready, retryAt := reserveRequest(state)
+			if ready || (retryAt.IsZero() && len(state.inFlight) == 0) {
+				requestChan = pendingRequestChan
+				nextRequest = state.queuedRequests[0]
+			} else if !retryAt.IsZero() {
+				retryTimer = time.NewTimer(time.Until(retryAt))
+				retryChan = retryTimer.C
+			}
+		}
+
+		done := ctx.Done()
+		if cancelled {
+			done = nil
+		}
+
+		select {
+		case requestChan <- nextRequest:
+			state.queuedRequests = state.queuedRequests[1:]
+			state.inFlight[nextRequest.node] = true
+			state.reserved = false
+
+		case <-retryChan:
+
+		case pu := <-pendingGraphUpdateChan:
+			delete(state.inFlight, pu.node)
+
+			// The request may have been cut short, so we can't trust its
+			// results.
+			if ctx.Err() != nil {
+				state.abandoned = append(state.abandoned, pu.node)
+				continue
+			}
+
+			state.completedRequests++
+
+			pu.node.Metadata = pu.outs.Metadata
+
+			if m := pu.outs.Metadata; options.MergeCanonical && m != nil && m.CanonicalUrl != "" && m.CanonicalUrl != pu.node.Url {
+				node := mergeCanonical(state, pu.node, m.CanonicalUrl)
+				if node == nil {
+					continue
+				}
+				pu.node = node
+			}
+
 			for _, link := range pu.outs.Links {
-				linkNode := handleUpdate(pu, link.Url, G.EdgeKindLink)
-				linkNode.PureAsset = false
+				linkNode := handleUpdate(pu, link.Url, link.Aliases, G.EdgeKindLink)
 
-				if urlToNode[link.Url] == nil {
-					wg.Add(1)
-					queuedRequests = append(queuedRequests, pendingRequest{linkNode, link.Source})
+				// A node that was previously only referenced as an asset may not
+				// have been requested yet.
+				linkNode.PureAsset = false
+				if link.External {
+					linkNode.External = true
+				}
+				if !state.requested[linkNode] {
+					state.requested[linkNode] = true
+					state.nextLevelRequests = append(state.nextLevelRequests, pendingRequest{linkNode, link.Source})
 				}
 
-				urlToNode[link.Url] = linkNode
+				state.urlToNode[link.Url] = linkNode
 			}
 
-			if assetsMode == AssetsModeIncludeAssets {
+			if options.AssetsMode == AssetsModeIncludeAssets {
 				for _, asset := range pu.outs.Assets {
-					linkNode := handleUpdate(pu, asset.Url, G.EdgeKindAsset)
-					urlToNode[asset.Url] = linkNode
+					linkNode := handleUpdate(pu, asset.Url, asset.Aliases, G.EdgeKindAsset)
+
+					// Assets such as stylesheets are loaded to find the assets
+					// that they refer to, and others may be checked.
+					if asset.Source != nil && !state.requested[linkNode] {
+						state.requested[linkNode] = true
+						state.nextLevelRequests = append(state.nextLevelRequests, pendingRequest{linkNode, asset.Source})
+					}
+
+					state.urlToNode[asset.Url] = linkNode
 				}
 			}
 
-			queuedRequests = dequeueRequests(pendingRequestChan, queuedRequests)
+		case <-checkpointChan:
+			if err := writeCheckpoint(options.CheckpointFile, state, options.CrawlInfo); err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't write checkpoint: %v\n", err)
+			}
 
-			wg.Done()
+		case <-done:
 		}
 	}
 }
 
-func dequeueRequests(pendingRequestChan chan<- pendingRequest, pending []pendingRequest) []pendingRequest {
-	for len(pending) > 0 {
-		r := pending[0]
+// mergeCanonical merges a page that has just been loaded into the node for its
+// canonical URL. If there is no such node, the page's node takes the canonical
+// URL. It returns the node that the page's links and assets should be added
+// to, or nil if they should be discarded because the canonical URL has been
+// (or is going to be) loaded itself.
+func mergeCanonical(state *crawlState, node *G.Node, canonicalUrl string) *G.Node {
+	target := state.urlToNode[canonicalUrl]
 
-		select {
-		case pendingRequestChan <- r:
-			pending = pending[1:]
-		default:
-			return pending
+	if target == nil {
+		oldUrl := node.Url
+		node.Url = canonicalUrl
+		node.AddAlias(oldUrl)
+		state.urlToNode[canonicalUrl] = node
+		state.requested[node] = true
+		return node
+	}
+
+	// The roots must stay roots.
+	if target == node || node.Depth == 0 {
+		return node
+	}
+
+	// Point the edges to the page at the node for its canonical URL instead,
+	// unless they would duplicate edges that are already there.
+	repointed := make(map[*G.Node]bool)
+	for _, in := range state.inEdges[node] {
+		n := in.Node
+		if repointed[n] {
+			continue
+		}
+		repointed[n] = true
+
+		out := n.Out[:0]
+		for _, e := range n.Out {
+			if e.Node == node {
+				if hasEdge(n, e.Kind, target) {
+					continue
+				}
+				e.Node = target
+				target.Popularity++
+				state.inEdges[target] = append(state.inEdges[target], G.Edge{Kind: e.Kind, Node: n})
+			}
+			out = append(out, e)
+		}
+		n.Out = out
+	}
+	delete(state.inEdges, node)
+
+	target.AddAlias(node.Url)
+	for _, alias := range node.Aliases {
+		target.AddAlias(alias)
+	}
+	if node.Depth < target.Depth {
+		target.Depth = node.Depth
+	}
+	target.PureAsset = target.PureAsset && node.PureAsset
+	state.urlToNode[node.Url] = target
+
+	if state.requested[target] {
+		return nil
+	}
+
+	state.requested[target] = true
+	target.Metadata = node.Metadata
+	return target
+}
+
+// addEdge adds an edge to the graph, and records it in state.inEdges.
+func addEdge(state *crawlState, from *G.Node, kind G.EdgeKind, to *G.Node) {
+	from.Out = append(from.Out, G.Edge{Kind: kind, Node: to})
+	state.inEdges[to] = append(state.inEdges[to], G.Edge{Kind: kind, Node: from})
+}
+
+func hasEdge(from *G.Node, kind G.EdgeKind, to *G.Node) bool {
+	for _, e := range from.Out {
+		if e.Kind == kind && e.Node == to {
+			return true
+		}
+	}
+	return false
+}
+
+// reserveRequest finds the first queued request whose source can be loaded
+// without waiting (see S.ScheduledSource), reserves it, and moves it to the
+// front of the queue, so that a worker isn't held up by a busy host while
+// requests to other hosts are waiting. If there is none, it returns the
+// earliest time at which one might be loadable, or the zero time if that
+// depends on the requests in flight.
+func reserveRequest(state *crawlState) (ready bool, retryAt time.Time) {
+	if state.reserved {
+		return true, time.Time{}
+	}
+
+	for i, r := range state.queuedRequests {
+		ok, at := S.Reserve(r.source)
+		if ok {
+			copy(state.queuedRequests[1:i+1], state.queuedRequests[:i])
+			state.queuedRequests[0] = r
+			state.reserved = true
+			return true, time.Time{}
+		}
+		if !at.IsZero() && (retryAt.IsZero() || at.Before(retryAt)) {
+			retryAt = at
+		}
+	}
+
+	return false, retryAt
+}
+
+// addSitemap adds an edge from the root to each page in the sitemap, and
+// queues requests for the pages that haven't been loaded if we're seeding the
+// crawl with the sitemap.
+func addSitemap(state *crawlState, options Options) {
+	state.sitemapPending = false
+
+	seen := make(map[*G.Node]bool)
+	for _, link := range options.Sitemap {
+		node := state.urlToNode[link.Url]
+		if node == nil {
+			node = &G.Node{
+				Url:        link.Url,
+				Depth:      state.root.Depth + 1,
+				Popularity: 0,
+				PureAsset:  false,
+			}
+			state.urlToNode[link.Url] = node
+		} else if options.SeedSitemap {
+			node.PureAsset = false
+		}
+
+		for _, alias := range link.Aliases {
+			node.AddAlias(alias)
 		}
+
+		// Several URLs in the sitemap may lead to the same node.
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+
+		if options.SeedSitemap && !state.requested[node] {
+			state.requested[node] = true
+			state.queuedRequests = append(state.queuedRequests, pendingRequest{node, link.Source})
+		}
+
+		addEdge(state, state.root, G.EdgeKindSitemap, node)
+	}
+}
+
+// hasSitemapEdges determines whether the sitemap has already been added to a
+// graph (which is the case when resuming some crawls).
+func hasSitemapEdges(root *G.Node) bool {
+	for _, e := range root.Out {
+		if e.Kind == G.EdgeKindSitemap {
+			return true
+		}
+	}
+	return false
+}
+
+// frontier returns the nodes that have yet to be loaded, in the order in which
+// they should be requested.
+func (state *crawlState) frontier() []*G.Node {
+	var nodes []*G.Node
+
+	nodes = append(nodes, state.abandoned...)
+
+	var inFlight []*G.Node
+	for node := range state.inFlight {
+		inFlight = append(inFlight, node)
+	}
+	sort.Slice(inFlight, func(i, j int) bool {
+		return inFlight[i].Url < inFlight[j].Url
+	})
+	nodes = append(nodes, inFlight...)
+
+	for _, r := range state.queuedRequests {
+		nodes = append(nodes, r.node)
+	}
+	for _, r := range state.nextLevelRequests {
+		nodes = append(nodes, r.node)
 	}
 
-	return pending
+	return nodes
 }
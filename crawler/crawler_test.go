@@ -1,8 +1,15 @@
 package crawler
 
 import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
 	MS "multiverse.io/crawler/crawler/test_helpers/mock_source"
 )
 
@@ -138,3 +145,511 @@ func TestCrawlOnSimpleSiteWithCyclesNotIncludingAssets(t *testing.T) {
 		t.Errorf("Unexpected number of outward links from page 2")
 	}
 }
+
+func TestCrawlAttachesMetadata(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":      []string{"/page1", "/page2"},
+			"/page1": []string{},
+		},
+		Assets: map[string][]string{
+			"/": []string{"/asset1"},
+		},
+		Metadata: map[string]*S.Metadata{
+			"/":      {StatusCode: 200, ContentType: "text/html"},
+			"/page1": {StatusCode: 200, ContentType: "application/pdf"},
+			"/page2": {StatusCode: 404, ContentType: "text/html"},
+		},
+	}
+
+	source := &MS.MockSource{Universe: &universe, Url: "/"}
+
+	root := Crawl(source, AssetsModeIncludeAssets)
+
+	if root.Metadata == nil || root.Metadata.StatusCode != 200 {
+		t.Errorf("Unexpected metadata for root: %+v\n", root.Metadata)
+	}
+
+	asset1, page1, page2 := root.Out[0].Node, root.Out[1].Node, root.Out[2].Node
+
+	if asset1.Metadata != nil {
+		t.Errorf("Unexpected metadata for unloaded asset: %+v\n", asset1.Metadata)
+	}
+
+	if page1.Metadata == nil || page1.Metadata.ContentType != "application/pdf" {
+		t.Errorf("Unexpected metadata for page1: %+v\n", page1.Metadata)
+	}
+
+	if page2.Metadata == nil || !page2.Metadata.IsBroken() {
+		t.Errorf("Unexpected metadata for page2: %+v\n", page2.Metadata)
+	}
+}
+
+func TestCrawlDepthIsShortestPath(t *testing.T) {
+	// There are two paths to /d: / -> /a -> /d and / -> /b -> /c -> /d. The
+	// first is shorter, but /a is slow to load, so the second path is explored
+	// first.
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":  []string{"/a", "/b"},
+			"/a": []string{"/d"},
+			"/b": []string{"/c"},
+			"/c": []string{"/d"},
+			"/d": []string{"/e"},
+		},
+		Assets: map[string][]string{},
+		Delays: map[string]time.Duration{
+			"/a": 50 * time.Millisecond,
+		},
+	}
+
+	source := &MS.MockSource{Universe: &universe, Url: "/"}
+
+	root := Crawl(source, AssetsModeIncludeAssets)
+
+	d := root.Out[0].Node.Out[0].Node
+	e := d.Out[0].Node
+	if d.Url != "/d" || d.Depth != 2 || e.Url != "/e" || e.Depth != 3 {
+		t.Errorf("Expected /d at depth 2 and /e at depth 3; got %v at depth %v and %v at depth %v\n", d.Url, d.Depth, e.Url, e.Depth)
+	}
+}
+
+func TestCrawlLoadsLinkedAssets(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":       []string{"/page1"},
+			"/page1":  []string{"/asset1"},
+			"/asset1": []string{"/page2"},
+		},
+		Assets: map[string][]string{
+			"/": []string{"/asset1"},
+		},
+	}
+
+	source := &MS.MockSource{Universe: &universe, Url: "/"}
+
+	root := Crawl(source, AssetsModeIncludeAssets)
+
+	asset1 := root.Out[0].Node
+	if asset1.Url != "/asset1" || asset1.PureAsset || len(asset1.Out) != 1 || asset1.Out[0].Node.Url != "/page2" {
+		t.Errorf("Expected /asset1 to be loaded once it was linked to; got %+v\n", asset1)
+	}
+}
+
+func TestCrawlWithSitemap(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":       []string{"/a"},
+			"/a":      []string{"/b"},
+			"/orphan": []string{"/c"},
+		},
+		Assets: map[string][]string{
+			"/": []string{"/img"},
+		},
+	}
+
+	var sitemap []S.Link
+	for _, u := range []string{"/b", "/orphan", "/img", "/b"} {
+		sitemap = append(sitemap, S.Link{Url: u, Source: &MS.MockSource{Universe: &universe, Url: u}})
+	}
+
+	for _, seed := range []bool{false, true} {
+		source := &MS.MockSource{Universe: &universe, Url: "/"}
+		root, err := CrawlWithOptions(context.Background(), source, Options{
+			AssetsMode:  AssetsModeIncludeAssets,
+			Sitemap:     sitemap,
+			SeedSitemap: seed,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		nodes := make(map[string]*G.Node)
+		G.Traverse(root, func(node *G.Node) {
+			nodes[node.Url] = node
+		})
+
+		var sitemapUrls []string
+		for _, e := range root.Out {
+			if e.Kind == G.EdgeKindSitemap {
+				sitemapUrls = append(sitemapUrls, e.Node.Url)
+			}
+		}
+		if fmt.Sprint(sitemapUrls) != "[/b /img /orphan]" {
+			t.Errorf("Unexpected sitemap edges from root: %v\n", sitemapUrls)
+		}
+
+		// Being in the sitemap doesn't change the depth of a linked page.
+		if b := nodes["/b"]; b.Depth != 2 || b.Popularity != 1 {
+			t.Errorf("Unexpected depth %v and popularity %v for /b\n", b.Depth, b.Popularity)
+		}
+
+		orphan := nodes["/orphan"]
+		if orphan.Depth != 1 || orphan.PureAsset || orphan.Popularity != 0 {
+			t.Errorf("Unexpected fields for /orphan: %+v\n", orphan)
+		}
+
+		if seed {
+			if len(orphan.Out) != 1 || nodes["/c"] == nil || nodes["/c"].Depth != 2 {
+				t.Errorf("Expected /orphan to be crawled when seeding with the sitemap\n")
+			}
+			if nodes["/img"].PureAsset {
+				t.Errorf("Expected /img to be loaded when seeding with the sitemap\n")
+			}
+		} else {
+			if len(orphan.Out) != 0 || nodes["/c"] != nil {
+				t.Errorf("Expected /orphan not to be crawled without seeding\n")
+			}
+			if !nodes["/img"].PureAsset {
+				t.Errorf("Expected /img not to be loaded without seeding\n")
+			}
+		}
+	}
+}
+
+func TestCrawlWithSeeds(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":       []string{"/a", "/docs/"},
+			"/a":      []string{"/shared"},
+			"/docs/":  []string{"/docs/b", "/"},
+			"/docs/b": []string{"/shared"},
+			"/blog/":  []string{"/blog/c"},
+			"/blog/c": []string{"/shared"},
+			"/shared": []string{},
+		},
+		Assets: map[string][]string{},
+	}
+
+	var seeds []S.Source
+	for _, u := range []string{"/docs/", "/blog/", "/"} {
+		seeds = append(seeds, &MS.MockSource{Universe: &universe, Url: u})
+	}
+
+	root, err := CrawlWithOptions(context.Background(), &MS.MockSource{Universe: &universe, Url: "/"}, Options{Seeds: seeds})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var roots []string
+	for _, r := range G.Roots(root) {
+		roots = append(roots, r.Url)
+		if r.Depth != 0 || len(r.Out) == 0 {
+			t.Errorf("Expected seed %v to be crawled at depth 0; got %+v\n", r.Url, r)
+		}
+	}
+	if fmt.Sprint(roots) != "[/ /blog/ /docs/]" {
+		t.Errorf("Unexpected roots %v\n", roots)
+	}
+
+	nodes := make(map[string]*G.Node)
+	G.Traverse(root, func(node *G.Node) {
+		nodes[node.Url] = node
+	})
+
+	if len(nodes) != 7 {
+		t.Errorf("Expected 7 nodes; got %v\n", len(nodes))
+	}
+
+	// Depths are measured from the nearest seed, and seed edges don't count
+	// towards popularity.
+	for u, depth := range map[string]int{"/a": 1, "/docs/b": 1, "/blog/c": 1, "/shared": 2} {
+		if nodes[u] == nil || nodes[u].Depth != depth {
+			t.Errorf("Expected %v at depth %v; got %+v\n", u, depth, nodes[u])
+		}
+	}
+	if nodes["/docs/"].Popularity != 1 || nodes["/blog/"].Popularity != 0 || nodes["/shared"].Popularity != 3 {
+		t.Errorf("Unexpected popularities %v, %v and %v\n", nodes["/docs/"].Popularity, nodes["/blog/"].Popularity, nodes["/shared"].Popularity)
+	}
+}
+
+func TestCrawlMergesCanonicalUrls(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":      []string{"/a?x=1", "/b"},
+			"/a?x=1": []string{"/c"},
+			"/b":     []string{"/a", "/b2"},
+			"/b2":    []string{"/not-crawled"},
+		},
+		Assets: map[string][]string{
+			"/b": []string{"/img"},
+		},
+		Metadata: map[string]*S.Metadata{
+			"/a?x=1": &S.Metadata{StatusCode: 200, CanonicalUrl: "/a"},
+			"/b":     &S.Metadata{StatusCode: 200, CanonicalUrl: "/b"},
+			"/b2":    &S.Metadata{StatusCode: 200, CanonicalUrl: "/b"},
+		},
+		Aliases: map[string][]string{
+			"/b":   []string{"/b/", "/B"},
+			"/img": []string{"/img?v=2"},
+		},
+	}
+
+	for _, merge := range []bool{false, true} {
+		source := &MS.MockSource{Universe: &universe, Url: "/"}
+		root, err := CrawlWithOptions(context.Background(), source, Options{
+			AssetsMode:     AssetsModeIncludeAssets,
+			MergeCanonical: merge,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		nodes := make(map[string]*G.Node)
+		G.Traverse(root, func(node *G.Node) {
+			nodes[node.Url] = node
+		})
+
+		if b := nodes["/b"]; fmt.Sprint(b.Aliases) != map[bool]string{false: "[/B /b/]", true: "[/B /b/ /b2]"}[merge] {
+			t.Errorf("Unexpected aliases for /b: %v\n", b.Aliases)
+		}
+		if img := nodes["/img"]; fmt.Sprint(img.Aliases) != "[/img?v=2]" {
+			t.Errorf("Unexpected aliases for /img: %v\n", img.Aliases)
+		}
+
+		if !merge {
+			if len(nodes) != 8 || nodes["/a"] == nil || nodes["/a?x=1"] == nil || nodes["/b2"] == nil {
+				t.Errorf("Expected pages not to be merged without MergeCanonical: %v\n", nodes)
+			}
+			continue
+		}
+
+		// /a?x=1 takes its canonical URL, as there's no node for it yet.
+		a := nodes["/a"]
+		if len(nodes) != 5 || a == nil || nodes["/a?x=1"] != nil || nodes["/b2"] != nil || nodes["/not-crawled"] != nil {
+			t.Fatalf("Unexpected nodes %v\n", nodes)
+		}
+		if a.Depth != 1 || a.Popularity != 2 || fmt.Sprint(a.Aliases) != "[/a?x=1]" || len(a.Out) != 1 || a.Out[0].Node != nodes["/c"] {
+			t.Errorf("Unexpected node for /a: %+v\n", a)
+		}
+
+		// /b2 is merged into /b, so /b links to itself.
+		b := nodes["/b"]
+		if b.Popularity != 2 || fmt.Sprint(b.Out) != fmt.Sprint([]G.Edge{{Kind: G.EdgeKindAsset, Node: nodes["/img"]}, {Kind: G.EdgeKindLink, Node: a}, {Kind: G.EdgeKindLink, Node: b}}) {
+			t.Errorf("Unexpected node for /b: %+v\n", b)
+		}
+	}
+}
+
+func TestCrawlLoadsStylesheets(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":      []string{"/page1"},
+			"/page1": []string{"/a.css"},
+		},
+		Assets: map[string][]string{
+			"/":      []string{"/a.css", "/logo.png"},
+			"/a.css": []string{"/b.css", "/font.woff"},
+			"/b.css": []string{"/a.css", "/bg.png"},
+		},
+		LoadableAssets: map[string]bool{"/a.css": true, "/b.css": true},
+	}
+
+	for _, assetsMode := range []AssetsMode{AssetsModeIgnoreAssets, AssetsModeIncludeAssets} {
+		var requests int32
+		source := &countingSource{source: &MS.MockSource{Universe: &universe, Url: "/"}, requests: &requests}
+		root := Crawl(source, assetsMode)
+
+		nodes := make(map[string]*G.Node)
+		G.Traverse(root, func(node *G.Node) {
+			nodes[node.Url] = node
+		})
+
+		if assetsMode == AssetsModeIgnoreAssets {
+			if requests != 3 || len(nodes) != 3 {
+				t.Errorf("Expected 3 requests and 3 nodes when ignoring assets; got %v and %v\n", requests, len(nodes))
+			}
+			continue
+		}
+
+		// The stylesheets are each loaded once, even though /a.css is also
+		// linked to.
+		if requests != 4 {
+			t.Errorf("Expected 4 requests; got %v\n", requests)
+		}
+
+		for _, u := range []string{"/font.woff", "/bg.png", "/logo.png"} {
+			if nodes[u] == nil || !nodes[u].PureAsset {
+				t.Errorf("Expected %v to be an asset\n", u)
+			}
+		}
+
+		if b := nodes["/b.css"]; b == nil || !b.PureAsset || b.Depth != 2 || len(b.Out) != 2 {
+			t.Errorf("Expected /b.css to be loaded as an asset at depth 2; got %+v\n", b)
+		}
+
+		if a := nodes["/a.css"]; a == nil || a.PureAsset || len(a.Out) != 2 {
+			t.Errorf("Expected /a.css to be loaded once and not be a pure asset; got %+v\n", a)
+		}
+	}
+}
+
+// countingSource counts the requests made by it and its descendants.
+type countingSource struct {
+	source   S.Source
+	requests *int32
+}
+
+func (s *countingSource) GetUrl() string {
+	return s.source.GetUrl()
+}
+
+func (s *countingSource) GetOuts() S.Outs {
+	atomic.AddInt32(s.requests, 1)
+
+	outs := s.source.GetOuts()
+	for i := range outs.Links {
+		outs.Links[i].Source = &countingSource{outs.Links[i].Source, s.requests}
+	}
+	for i := range outs.Assets {
+		if outs.Assets[i].Source != nil {
+			outs.Assets[i].Source = &countingSource{outs.Assets[i].Source, s.requests}
+		}
+	}
+
+	return outs
+}
+
+// endlessSource links to a new page each time it's loaded. Page n cancels the
+// crawl and blocks until the cancellation is received.
+type endlessSource struct {
+	page     int
+	cancelAt int
+	cancel   context.CancelFunc
+}
+
+func (s *endlessSource) GetUrl() string {
+	return fmt.Sprintf("/page%v", s.page)
+}
+
+func (s *endlessSource) GetOuts() S.Outs {
+	return s.GetOutsContext(context.Background())
+}
+
+func (s *endlessSource) GetOutsContext(ctx context.Context) S.Outs {
+	if s.page == s.cancelAt {
+		s.cancel()
+		<-ctx.Done()
+		return S.Outs{}
+	}
+
+	next := &endlessSource{page: s.page + 1, cancelAt: s.cancelAt, cancel: s.cancel}
+	return S.Outs{Links: []S.Link{{Url: next.GetUrl(), Source: next}}}
+}
+
+func TestCrawlContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root, err := CrawlContext(ctx, &endlessSource{page: 0, cancelAt: 5, cancel: cancel}, AssetsModeIncludeAssets)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled error, got %v\n", err)
+	}
+
+	if root == nil || root.Url != "/page0" {
+		t.Fatalf("Unexpected root %+v\n", root)
+	}
+
+	nNodes := 0
+	node := root
+	for len(node.Out) > 0 {
+		nNodes++
+		node = node.Out[0].Node
+	}
+	if nNodes != 5 || node.Url != "/page5" {
+		t.Errorf("Expected partial graph ending at /page5 with 5 edges; got %v edges ending at %v\n", nNodes, node.Url)
+	}
+}
+
+func TestCrawlGraph(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":      []string{"/page1", "/page2"},
+			"/page1": []string{"/page2"},
+			"/page2": []string{"/"},
+		},
+		Assets: map[string][]string{},
+	}
+
+	g, err := CrawlGraph(context.Background(), &MS.MockSource{Universe: &universe, Url: "/"}, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	if g.Root().Url != "/" || len(g.Nodes()) != 3 {
+		t.Fatalf("Unexpected graph rooted at %v with %v nodes\n", g.Root().Url, len(g.Nodes()))
+	}
+
+	var predecessors []string
+	for _, node := range g.Predecessors("/page2") {
+		predecessors = append(predecessors, node.Url)
+	}
+	if fmt.Sprint(predecessors) != "[/ /page1]" {
+		t.Errorf("Unexpected predecessors of /page2 %v\n", predecessors)
+	}
+}
+
+// busySource is a page on a host that is busy until every page counted by
+// pending has been loaded. If it's loaded before then, it says that the host
+// is unavailable.
+type busySource struct {
+	url     string
+	pending *int32
+}
+
+func (s *busySource) GetUrl() string {
+	return s.url
+}
+
+func (s *busySource) GetOuts() S.Outs {
+	if atomic.LoadInt32(s.pending) > 0 {
+		return S.Outs{Metadata: &S.Metadata{StatusCode: 503}}
+	}
+	return S.Outs{Metadata: &S.Metadata{StatusCode: 200}}
+}
+
+func (s *busySource) Reserve() (bool, time.Time) {
+	return atomic.LoadInt32(s.pending) == 0, time.Time{}
+}
+
+func (s *busySource) Release() {}
+
+// pendingSource is a page that counts down pending when it's loaded, and links
+// to links.
+type pendingSource struct {
+	url     string
+	links   []S.Link
+	pending *int32
+}
+
+func (s *pendingSource) GetUrl() string {
+	return s.url
+}
+
+func (s *pendingSource) GetOuts() S.Outs {
+	atomic.AddInt32(s.pending, -1)
+	return S.Outs{Links: s.links, Metadata: &S.Metadata{StatusCode: 200}}
+}
+
+func TestCrawlDoesNotWaitForBusyHosts(t *testing.T) {
+	n := 4 * runtime.NumCPU()
+	pending := int32(n + 1)
+
+	var links []S.Link
+	for i := 0; i < n; i++ {
+		busy := &busySource{url: fmt.Sprintf("http://busy.com/%v", i), pending: &pending}
+		links = append(links, S.Link{Url: busy.url, Source: busy})
+	}
+	for i := 0; i < n; i++ {
+		page := &pendingSource{url: fmt.Sprintf("http://free.com/%v", i), pending: &pending}
+		links = append(links, S.Link{Url: page.url, Source: page})
+	}
+
+	root := Crawl(&pendingSource{url: "http://free.com/", links: links, pending: &pending}, AssetsModeIncludeAssets)
+
+	G.Traverse(root, func(node *G.Node) {
+		if node.Metadata == nil || node.Metadata.StatusCode != 200 {
+			t.Errorf("Expected %v to be loaded once its host was free; got %+v\n", node.Url, node.Metadata)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+// Package diff compares two crawls of a site. Pages are matched up by their
+// URLs relative to the scheme and host of each crawl's root, so that crawls of
+// the same site on different hosts (e.g. staging and production) can be
+// compared.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+type Status int
+
+const (
+	StatusUnchanged Status = iota
+	StatusAdded
+	StatusRemoved
+	StatusChanged
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusUnchanged:
+		return "unchanged"
+	case StatusAdded:
+		return "added"
+	case StatusRemoved:
+		return "removed"
+	case StatusChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// PageInfo describes a page in one of the crawls.
+type PageInfo struct {
+	Depth      int
+	Popularity int
+	PureAsset  bool
+	StatusCode int // 0 if the page wasn't loaded
+}
+
+type Link struct {
+	Url    string
+	Kind   G.EdgeKind
+	Status Status // unchanged, added or removed
+}
+
+type Page struct {
+	Url    string
+	Status Status
+	Old    *PageInfo // nil if the page was added
+	New    *PageInfo // nil if the page was removed
+
+	// The outgoing edges of the page in either crawl, ordered by URL and then
+	// kind.
+	Links []Link
+}
+
+type Diff struct {
+	OldRoot string
+	NewRoot string
+
+	// The URL (relative to the roots) of the first page crawled.
+	Root string
+
+	// Every page in either crawl, ordered by URL.
+	Pages []Page
+}
+
+type page struct {
+	info  PageInfo
+	links map[linkKey]bool
+}
+
+type linkKey struct {
+	url  string
+	kind G.EdgeKind
+}
+
+// Compare compares the graphs reachable from two roots.
+func Compare(oldRoot, newRoot *G.Node) Diff {
+	oldPages := getPages(oldRoot)
+	newPages := getPages(newRoot)
+
+	urls := make(map[string]bool)
+	for u := range oldPages {
+		urls[u] = true
+	}
+	for u := range newPages {
+		urls[u] = true
+	}
+
+	d := Diff{
+		OldRoot: oldRoot.Url,
+		NewRoot: newRoot.Url,
+		Root:    relativeUrl(newRoot.Url, newRoot.Url),
+		Pages:   []Page{},
+	}
+
+	for u := range urls {
+		d.Pages = append(d.Pages, comparePage(u, oldPages[u], newPages[u]))
+	}
+
+	sort.Slice(d.Pages, func(i, j int) bool {
+		return d.Pages[i].Url < d.Pages[j].Url
+	})
+
+	return d
+}
+
+func comparePage(u string, oldPage, newPage *page) Page {
+	p := Page{Url: u, Links: []Link{}}
+
+	if oldPage != nil {
+		p.Old = &oldPage.info
+	}
+	if newPage != nil {
+		p.New = &newPage.info
+	}
+
+	links := make(map[linkKey]Status)
+	if oldPage != nil {
+		for k := range oldPage.links {
+			links[k] = StatusRemoved
+		}
+	}
+	if newPage != nil {
+		for k := range newPage.links {
+			if _, ok := links[k]; ok {
+				links[k] = StatusUnchanged
+			} else {
+				links[k] = StatusAdded
+			}
+		}
+	}
+
+	linksChanged := false
+	for k, status := range links {
+		p.Links = append(p.Links, Link{Url: k.url, Kind: k.kind, Status: status})
+		if status != StatusUnchanged {
+			linksChanged = true
+		}
+	}
+
+	sort.Slice(p.Links, func(i, j int) bool {
+		if p.Links[i].Url != p.Links[j].Url {
+			return p.Links[i].Url < p.Links[j].Url
+		}
+		return p.Links[i].Kind < p.Links[j].Kind
+	})
+
+	switch {
+	case oldPage == nil:
+		p.Status = StatusAdded
+	case newPage == nil:
+		p.Status = StatusRemoved
+	case linksChanged || oldPage.info.StatusCode != newPage.info.StatusCode || oldPage.info.Depth != newPage.info.Depth:
+		p.Status = StatusChanged
+	default:
+		p.Status = StatusUnchanged
+	}
+
+	return p
+}
+
+func getPages(root *G.Node) map[string]*page {
+	pages := make(map[string]*page)
+
+	G.Traverse(root, func(node *G.Node) {
+		p := &page{
+			info: PageInfo{
+				Depth:      node.Depth,
+				Popularity: node.Popularity,
+				PureAsset:  node.PureAsset,
+			},
+			links: make(map[linkKey]bool),
+		}
+
+		if node.Metadata != nil {
+			p.info.StatusCode = node.Metadata.StatusCode
+		}
+
+		for _, out := range node.Out {
+			p.links[linkKey{relativeUrl(root.Url, out.Node.Url), out.Kind}] = true
+		}
+
+		pages[relativeUrl(root.Url, node.Url)] = p
+	})
+
+	return pages
+}
+
+// relativeUrl strips the scheme and host of the root from a URL on the same
+// host as the root. Other URLs are returned unchanged.
+func relativeUrl(rootUrl, u string) string {
+	parsedRoot, err := url.Parse(rootUrl)
+	if err != nil {
+		return u
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil || !strings.EqualFold(parsed.Host, parsedRoot.Host) {
+		return u
+	}
+
+	parsed.Scheme = ""
+	parsed.Host = ""
+	parsed.User = nil
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String()
+}
+
+// Changes returns the pages that were added, removed or changed.
+func (d *Diff) Changes() []Page {
+	changes := []Page{}
+	for _, p := range d.Pages {
+		if p.Status != StatusUnchanged {
+			changes = append(changes, p)
+		}
+	}
+	return changes
+}
+
+func WriteText(w io.Writer, d Diff) error {
+	var sb strings.Builder
+	counts := make(map[Status]int)
+
+	fmt.Fprintf(&sb, "Comparing %v with %v\n", d.OldRoot, d.NewRoot)
+
+	for _, p := range d.Changes() {
+		counts[p.Status]++
+		fmt.Fprintf(&sb, "%v %v\n", p.Status, p.Url)
+
+		if p.Status != StatusChanged {
+			continue
+		}
+
+		if p.Old.StatusCode != p.New.StatusCode {
+			fmt.Fprintf(&sb, "    status %v -> %v\n", statusCodeString(p.Old.StatusCode), statusCodeString(p.New.StatusCode))
+		}
+		if p.Old.Depth != p.New.Depth {
+			fmt.Fprintf(&sb, "    depth %v -> %v\n", p.Old.Depth, p.New.Depth)
+		}
+		for _, l := range p.Links {
+			switch l.Status {
+			case StatusAdded:
+				fmt.Fprintf(&sb, "    + %v %v\n", l.Kind, l.Url)
+			case StatusRemoved:
+				fmt.Fprintf(&sb, "    - %v %v\n", l.Kind, l.Url)
+			}
+		}
+	}
+
+	fmt.Fprintf(&sb, "%v added, %v removed, %v changed.\n", counts[StatusAdded], counts[StatusRemoved], counts[StatusChanged])
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteJson writes the pages that were added, removed or changed as JSON.
+func WriteJson(w io.Writer, d Diff) error {
+	changes := d
+	changes.Pages = d.Changes()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(changes)
+}
+
+func statusCodeString(statusCode int) string {
+	if statusCode == 0 {
+		return "none"
+	}
+	return fmt.Sprint(statusCode)
+}
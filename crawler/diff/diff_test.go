@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+func TestCompare(t *testing.T) {
+	d := Compare(makeOldGraph(), makeNewGraph())
+
+	if d.Root != "/" {
+		t.Errorf("Unexpected root %v\n", d.Root)
+	}
+
+	statuses := make(map[string]Status)
+	for _, p := range d.Pages {
+		statuses[p.Url] = p.Status
+	}
+
+	expectedStatuses := map[string]Status{
+		"/":      StatusChanged,
+		"/a":     StatusChanged,
+		"/b":     StatusRemoved,
+		"/c":     StatusAdded,
+		"/d":     StatusChanged,
+		"/e":     StatusUnchanged,
+		"/x.png": StatusUnchanged,
+	}
+
+	if len(statuses) != len(expectedStatuses) {
+		t.Errorf("Unexpected pages %v\n", statuses)
+	}
+	for u, status := range expectedStatuses {
+		if statuses[u] != status {
+			t.Errorf("Expected %v to be %v, got %v\n", u, status, statuses[u])
+		}
+	}
+
+	root := d.Pages[0]
+	if root.Url != "/" || len(root.Links) != 4 ||
+		root.Links[0] != (Link{"/a", G.EdgeKindLink, StatusUnchanged}) ||
+		root.Links[1] != (Link{"/b", G.EdgeKindLink, StatusRemoved}) ||
+		root.Links[2] != (Link{"/c", G.EdgeKindLink, StatusAdded}) ||
+		root.Links[3] != (Link{"/d", G.EdgeKindLink, StatusAdded}) {
+		t.Errorf("Unexpected links for root %+v\n", root.Links)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteText(&sb, Compare(makeOldGraph(), makeNewGraph())); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	expected := `Comparing http://staging.foo.com/ with https://foo.com/
+changed /
+    - link /b
+    + link /c
+    + link /d
+changed /a
+    status 200 -> 404
+removed /b
+added /c
+changed /d
+    depth 2 -> 1
+1 added, 1 removed, 3 changed.
+`
+	if sb.String() != expected {
+		t.Errorf("Unexpected text diff:\n%v\n", sb.String())
+	}
+}
+
+func TestWriteJson(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteJson(&sb, Compare(makeOldGraph(), makeNewGraph())); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var d struct {
+		Pages []struct {
+			Url    string
+			Status string
+		}
+	}
+	if err := json.Unmarshal([]byte(sb.String()), &d); err != nil {
+		t.Fatalf("Couldn't parse JSON diff: %v\n", err)
+	}
+
+	if len(d.Pages) != 5 || d.Pages[0].Url != "/" || d.Pages[0].Status != "changed" || d.Pages[3].Url != "/c" || d.Pages[3].Status != "added" {
+		t.Errorf("Unexpected JSON diff: %v\n", sb.String())
+	}
+}
+
+func TestRelativeUrl(t *testing.T) {
+	type test struct {
+		root     string
+		url      string
+		expected string
+	}
+
+	tests := []test{
+		{"http://foo.com/", "http://foo.com/", "/"},
+		{"http://foo.com/", "http://foo.com", "/"},
+		{"http://foo.com/", "https://FOO.com/a?b=c", "/a?b=c"},
+		{"http://foo.com/", "http://bar.com/a", "http://bar.com/a"},
+	}
+
+	for _, tst := range tests {
+		if result := relativeUrl(tst.root, tst.url); result != tst.expected {
+			t.Errorf("Expected %v relative to %v to be %v, got %v\n", tst.url, tst.root, tst.expected, result)
+		}
+	}
+}
+
+func makeOldGraph() *G.Node {
+	//     / -> /a, /b
+	//     /a -> /e
+	//     /b -> /d
+	//     /e -> /x.png (asset)
+	root := &G.Node{Url: "http://staging.foo.com/", Depth: 0, Metadata: &S.Metadata{StatusCode: 200}}
+	a := &G.Node{Url: "http://staging.foo.com/a", Depth: 1, Metadata: &S.Metadata{StatusCode: 200}}
+	b := &G.Node{Url: "http://staging.foo.com/b", Depth: 1, Metadata: &S.Metadata{StatusCode: 200}}
+	d := &G.Node{Url: "http://staging.foo.com/d", Depth: 2, Metadata: &S.Metadata{StatusCode: 200}}
+	e := &G.Node{Url: "http://staging.foo.com/e", Depth: 2, Metadata: &S.Metadata{StatusCode: 200}}
+	x := &G.Node{Url: "http://staging.foo.com/x.png", Depth: 3, PureAsset: true}
+	root.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: a}, {Kind: G.EdgeKindLink, Node: b}}
+	a.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: e}}
+	b.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: d}}
+	e.Out = []G.Edge{{Kind: G.EdgeKindAsset, Node: x}}
+	return root
+}
+
+func makeNewGraph() *G.Node {
+	//     / -> /a, /c
+	//     /a (404) -> /e
+	//     /c -> /d
+	//     /e -> /x.png (asset)
+	root := &G.Node{Url: "https://foo.com/", Depth: 0, Metadata: &S.Metadata{StatusCode: 200}}
+	a := &G.Node{Url: "https://foo.com/a", Depth: 1, Metadata: &S.Metadata{StatusCode: 404}}
+	c := &G.Node{Url: "https://foo.com/c", Depth: 1, Metadata: &S.Metadata{StatusCode: 200}}
+	d := &G.Node{Url: "https://foo.com/d", Depth: 1, Metadata: &S.Metadata{StatusCode: 200}}
+	e := &G.Node{Url: "https://foo.com/e", Depth: 2, Metadata: &S.Metadata{StatusCode: 200}}
+	x := &G.Node{Url: "https://foo.com/x.png", Depth: 3, PureAsset: true}
+	root.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: a}, {Kind: G.EdgeKindLink, Node: c}, {Kind: G.EdgeKindLink, Node: d}}
+	a.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: e}}
+	c.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: d}}
+	e.Out = []G.Edge{{Kind: G.EdgeKindAsset, Node: x}}
+	return root
+}
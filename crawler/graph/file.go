@@ -0,0 +1,158 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
+// FileVersion is the version of the crawl file format written by WriteJson.
+// It will be incremented whenever a change is made to the format that older
+// readers can't cope with.
+const FileVersion = 1
+
+// CrawlInfo describes how and when a crawl was performed.
+type CrawlInfo struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	// The options that the crawl was performed with, keyed by name (e.g. the
+	// command line flags).
+	Parameters map[string]string
+}
+
+// CrawlFile is the structure of a crawl file. Times are in RFC 3339 format,
+// and durations (such as Metadata.ResponseTime) are integer nanoseconds.
+type CrawlFile struct {
+	// Always FileVersion when written by WriteJson.
+	Version int
+
+	CrawlInfo
+
+	// The URLs of the nodes that the crawl started from. The first is the root
+	// of the graph, which has an edge of kind "seed" to each of the others.
+	Roots []string
+
+	// Every node reachable from the roots.
+	Nodes []CrawlFileNode
+
+	// Every edge between the nodes, in the order that they appear in each
+	// node's Out list.
+	Edges []CrawlFileEdge
+}
+
+type CrawlFileNode struct {
+	Url        string
+	Depth      int
+	Popularity int
+	PureAsset  bool
+	External   bool        `json:",omitempty"`
+	Metadata   *S.Metadata `json:",omitempty"`
+	Aliases    []string    `json:",omitempty"`
+}
+
+type CrawlFileEdge struct {
+	From string
+	To   string
+	Kind EdgeKind // "link", "asset", "sitemap" or "seed"
+}
+
+// WriteJson writes the graph reachable from root to w as a crawl file.
+func WriteJson(w io.Writer, info CrawlInfo, root *Node) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ToCrawlFile(info, root))
+}
+
+// ReadJson reads a crawl file written by WriteJson and returns its root node.
+func ReadJson(r io.Reader) (*Node, CrawlInfo, error) {
+	var file CrawlFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, CrawlInfo{}, err
+	}
+
+	return FromCrawlFile(file)
+}
+
+// ToCrawlFile converts the graph reachable from root to a crawl file.
+func ToCrawlFile(info CrawlInfo, root *Node) CrawlFile {
+	file := CrawlFile{
+		Version:   FileVersion,
+		CrawlInfo: info,
+		Roots:     []string{},
+		Nodes:     []CrawlFileNode{},
+		Edges:     []CrawlFileEdge{},
+	}
+
+	for _, r := range Roots(root) {
+		file.Roots = append(file.Roots, r.Url)
+	}
+
+	Traverse(root, func(node *Node) {
+		file.Nodes = append(file.Nodes, CrawlFileNode{
+			Url:        node.Url,
+			Depth:      node.Depth,
+			Popularity: node.Popularity,
+			PureAsset:  node.PureAsset,
+			External:   node.External,
+			Metadata:   node.Metadata,
+			Aliases:    node.Aliases,
+		})
+
+		for _, e := range node.Out {
+			file.Edges = append(file.Edges, CrawlFileEdge{
+				From: node.Url,
+				To:   e.Node.Url,
+				Kind: e.Kind,
+			})
+		}
+	})
+
+	return file
+}
+
+// FromCrawlFile reconstructs the graph in a crawl file and returns its root
+// node.
+func FromCrawlFile(file CrawlFile) (*Node, CrawlInfo, error) {
+	if file.Version != FileVersion {
+		return nil, CrawlInfo{}, fmt.Errorf("Unsupported crawl file version %v", file.Version)
+	}
+
+	if len(file.Roots) == 0 {
+		return nil, CrawlInfo{}, fmt.Errorf("No roots in crawl file")
+	}
+
+	urlToNode := make(map[string]*Node)
+	for _, n := range file.Nodes {
+		urlToNode[n.Url] = &Node{
+			Url:        n.Url,
+			Out:        []Edge{},
+			Depth:      n.Depth,
+			Popularity: n.Popularity,
+			PureAsset:  n.PureAsset,
+			External:   n.External,
+			Metadata:   n.Metadata,
+			Aliases:    n.Aliases,
+		}
+	}
+
+	for _, e := range file.Edges {
+		from, to := urlToNode[e.From], urlToNode[e.To]
+		if from == nil || to == nil {
+			return nil, CrawlInfo{}, fmt.Errorf("Edge from %v to %v refers to unknown node", e.From, e.To)
+		}
+
+		from.Out = append(from.Out, Edge{Kind: e.Kind, Node: to})
+	}
+
+	for _, r := range file.Roots {
+		if urlToNode[r] == nil {
+			return nil, CrawlInfo{}, fmt.Errorf("Root %v not found in crawl file", r)
+		}
+	}
+
+	return urlToNode[file.Roots[0]], file.CrawlInfo, nil
+}
@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
+func TestJsonRoundTrip(t *testing.T) {
+	//       A <---
+	//      / \   |
+	//     B-->C  |
+	//      \ /   |
+	//       D____|
+	//
+	a := &Node{Url: "A", Depth: 0, Popularity: 1, Metadata: &S.Metadata{StatusCode: 200, ContentType: "text/html", ContentLength: 10, ResponseTime: time.Second}}
+	b := &Node{Url: "B", Depth: 1, Popularity: 1, Metadata: &S.Metadata{StatusCode: 404, ContentLength: -1}, Aliases: []string{"B/", "b"}}
+	c := &Node{Url: "C", Depth: 1, Popularity: 2, Metadata: &S.Metadata{Error: "timeout", ContentLength: -1}}
+	d := &Node{Url: "D", Depth: 2, Popularity: 2, PureAsset: true, External: true}
+	a.Out = []Edge{{EdgeKindLink, b}, {EdgeKindLink, c}}
+	b.Out = []Edge{{EdgeKindLink, c}, {EdgeKindAsset, d}}
+	c.Out = []Edge{{EdgeKindAsset, d}}
+	d.Out = []Edge{{EdgeKindLink, a}}
+
+	info := CrawlInfo{
+		StartedAt:  time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2021, 5, 1, 12, 5, 0, 0, time.UTC),
+		Parameters: map[string]string{"maxdepth": "30"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJson(&buf, info, a); err != nil {
+		t.Fatalf("Unexpected error writing: %v\n", err)
+	}
+
+	root, readInfo, err := ReadJson(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error reading: %v\n", err)
+	}
+
+	if !readInfo.StartedAt.Equal(info.StartedAt) || !readInfo.FinishedAt.Equal(info.FinishedAt) || readInfo.Parameters["maxdepth"] != "30" {
+		t.Errorf("Unexpected crawl info %+v\n", readInfo)
+	}
+
+	originals := map[string]*Node{"A": a, "B": b, "C": c, "D": d}
+	count := 0
+	Traverse(root, func(node *Node) {
+		count++
+		orig := originals[node.Url]
+		if orig == nil {
+			t.Fatalf("Unexpected node %v\n", node.Url)
+		}
+
+		if node.Depth != orig.Depth || node.Popularity != orig.Popularity || node.PureAsset != orig.PureAsset || node.External != orig.External || fmt.Sprint(node.Aliases) != fmt.Sprint(orig.Aliases) {
+			t.Errorf("Bad fields for %v: %+v\n", node.Url, node)
+		}
+
+		if (node.Metadata == nil) != (orig.Metadata == nil) || (node.Metadata != nil && *node.Metadata != *orig.Metadata) {
+			t.Errorf("Bad metadata for %v: %+v\n", node.Url, node.Metadata)
+		}
+
+		if len(node.Out) != len(orig.Out) {
+			t.Fatalf("Bad number of edges for %v\n", node.Url)
+		}
+		for i := range node.Out {
+			if node.Out[i].Kind != orig.Out[i].Kind || node.Out[i].Node.Url != orig.Out[i].Node.Url {
+				t.Errorf("Bad edge %v from %v\n", i, node.Url)
+			}
+		}
+	})
+
+	if count != 4 {
+		t.Errorf("Expected 4 nodes, got %v\n", count)
+	}
+}
+
+func TestJsonRoots(t *testing.T) {
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B"}
+	c := &Node{Url: "C", Depth: 1}
+	a.Out = []Edge{{EdgeKindSeed, b}, {EdgeKindLink, c}}
+	b.Out = []Edge{{EdgeKindLink, c}}
+
+	file := ToCrawlFile(CrawlInfo{}, a)
+	if strings.Join(file.Roots, " ") != "A B" {
+		t.Errorf("Unexpected roots %v\n", file.Roots)
+	}
+
+	root, _, err := FromCrawlFile(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var roots []string
+	for _, r := range Roots(root) {
+		roots = append(roots, r.Url)
+	}
+	if strings.Join(roots, " ") != "A B" {
+		t.Errorf("Unexpected roots after reading %v\n", roots)
+	}
+}
+
+func TestReadJsonErrors(t *testing.T) {
+	inputs := []string{
+		`not json`,
+		`{"Version": 999, "Roots": ["A"], "Nodes": [{"Url": "A"}]}`,
+		`{"Version": 1, "Roots": ["B"], "Nodes": [{"Url": "A"}]}`,
+		`{"Version": 1, "Roots": [], "Nodes": [{"Url": "A"}]}`,
+		`{"Version": 1, "Roots": ["A", "B"], "Nodes": [{"Url": "A"}]}`,
+		`{"Version": 1, "Roots": ["A"], "Nodes": [{"Url": "A"}], "Edges": [{"From": "A", "To": "B", "Kind": "link"}]}`,
+		`{"Version": 1, "Roots": ["A"], "Nodes": [{"Url": "A"}], "Edges": [{"From": "A", "To": "A", "Kind": "teleport"}]}`,
+	}
+
+	for _, input := range inputs {
+		if _, _, err := ReadJson(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected error reading %v\n", input)
+		}
+	}
+}
@@ -1,12 +1,58 @@
 package graph
 
+import (
+	"fmt"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
 type EdgeKind int
 
 const (
-	EdgeKindAsset = iota
+	EdgeKindAsset EdgeKind = iota
 	EdgeKindLink
+
+	// An edge from the root to a page listed in the site's sitemaps.
+	EdgeKindSitemap
+
+	// An edge from the root to another page that the crawl started from.
+	EdgeKindSeed
 )
 
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeKindAsset:
+		return "asset"
+	case EdgeKindLink:
+		return "link"
+	case EdgeKindSitemap:
+		return "sitemap"
+	case EdgeKindSeed:
+		return "seed"
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+func (k EdgeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *EdgeKind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "asset":
+		*k = EdgeKindAsset
+	case "link":
+		*k = EdgeKindLink
+	case "sitemap":
+		*k = EdgeKindSitemap
+	case "seed":
+		*k = EdgeKindSeed
+	default:
+		return fmt.Errorf("Unknown edge kind '%s'", text)
+	}
+	return nil
+}
+
 type Edge struct {
 	Kind EdgeKind
 	Node *Node
@@ -19,11 +65,54 @@ type Node struct {
 	// depth from root in our traversal order
 	Depth int
 
-	// how may nodes point at this one?
+	// how may nodes point at this one? (not counting sitemap edges)
 	Popularity int
 
 	// is it an asset that's never linked to with <a>?
 	PureAsset bool
+
+	// is it a page on another site, which is checked but not crawled?
+	External bool
+
+	// the response received when loading it (nil if it wasn't loaded)
+	Metadata *S.Metadata
+
+	// how important is it in the structure of links between pages? (set by
+	// ComputeMetrics; zero for pure assets)
+	PageRank       float64
+	HubScore       float64
+	AuthorityScore float64
+	Betweenness    float64
+
+	// other URLs for the same resource that were merged into this node, by
+	// canonicalization rules or <link rel="canonical">
+	Aliases []string
+}
+
+// AddAlias records another URL for a node, unless it is the node's URL or is
+// already recorded.
+func (node *Node) AddAlias(alias string) {
+	if alias == node.Url {
+		return
+	}
+	for _, a := range node.Aliases {
+		if a == alias {
+			return
+		}
+	}
+	node.Aliases = append(node.Aliases, alias)
+}
+
+// Roots returns the nodes that a crawl started from: root, followed by the
+// nodes that it has seed edges to.
+func Roots(root *Node) []*Node {
+	roots := []*Node{root}
+	for _, e := range root.Out {
+		if e.Kind == EdgeKindSeed {
+			roots = append(roots, e.Node)
+		}
+	}
+	return roots
 }
 
 // Traverse performs a reverse pre-order traversal on a graph. Each node is
@@ -51,3 +140,61 @@ func Traverse(node *Node, f func(node *Node)) {
 		node, stack = stack[len(stack)-1], stack[:len(stack)-1]
 	}
 }
+
+type SitemapStatus int
+
+const (
+	// The node is neither linked to nor listed in a sitemap (e.g. an asset).
+	SitemapStatusNone SitemapStatus = iota
+	SitemapStatusLinkedOnly
+	SitemapStatusSitemapOnly
+	SitemapStatusBoth
+)
+
+func (s SitemapStatus) String() string {
+	switch s {
+	case SitemapStatusNone:
+		return "none"
+	case SitemapStatusLinkedOnly:
+		return "linked only"
+	case SitemapStatusSitemapOnly:
+		return "sitemap only"
+	case SitemapStatusBoth:
+		return "both"
+	}
+	return fmt.Sprintf("SitemapStatus(%d)", int(s))
+}
+
+// SitemapStatuses determines whether each node reachable from root is linked
+// to, listed in a sitemap, or both. The roots count as linked to.
+func SitemapStatuses(root *Node) map[*Node]SitemapStatus {
+	linked := map[*Node]bool{root: true}
+	inSitemap := make(map[*Node]bool)
+
+	Traverse(root, func(node *Node) {
+		for _, e := range node.Out {
+			switch e.Kind {
+			case EdgeKindLink, EdgeKindSeed:
+				linked[e.Node] = true
+			case EdgeKindSitemap:
+				inSitemap[e.Node] = true
+			}
+		}
+	})
+
+	statuses := make(map[*Node]SitemapStatus)
+	Traverse(root, func(node *Node) {
+		switch {
+		case linked[node] && inSitemap[node]:
+			statuses[node] = SitemapStatusBoth
+		case linked[node]:
+			statuses[node] = SitemapStatusLinkedOnly
+		case inSitemap[node]:
+			statuses[node] = SitemapStatusSitemapOnly
+		default:
+			statuses[node] = SitemapStatusNone
+		}
+	})
+
+	return statuses
+}
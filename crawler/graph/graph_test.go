@@ -36,3 +36,31 @@ func TestTraverse(t *testing.T) {
 		t.Errorf("Expected visitor to be called 4 times but it was called %v times\n", count)
 	}
 }
+
+func TestSitemapStatuses(t *testing.T) {
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B"}
+	c := &Node{Url: "C"}
+	d := &Node{Url: "D"}
+	e := &Node{Url: "E"}
+	f := &Node{Url: "F"}
+	a.Out = []Edge{{EdgeKindLink, b}, {EdgeKindAsset, c}, {EdgeKindSitemap, b}, {EdgeKindSitemap, d}, {EdgeKindSeed, f}}
+	d.Out = []Edge{{EdgeKindAsset, e}}
+
+	statuses := SitemapStatuses(a)
+
+	expected := map[*Node]SitemapStatus{
+		a: SitemapStatusLinkedOnly,
+		b: SitemapStatusBoth,
+		c: SitemapStatusNone,
+		d: SitemapStatusSitemapOnly,
+		e: SitemapStatusNone,
+		f: SitemapStatusLinkedOnly,
+	}
+
+	for node, status := range expected {
+		if statuses[node] != status {
+			t.Errorf("Expected %v to be '%v'; got '%v'\n", node.Url, status, statuses[node])
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package graph
+
+// Graph indexes a graph's nodes by URL, and its edges in both directions, for
+// answering queries about it. It describes the graph at the time it was made,
+// so it should be made again if the graph is changed.
+type Graph struct {
+	root      *Node
+	nodes     []*Node
+	urlToNode map[string]*Node
+	in        map[*Node][]Edge
+}
+
+// NewGraph indexes the graph reachable from root.
+func NewGraph(root *Node) *Graph {
+	var nodes []*Node
+	Traverse(root, func(node *Node) {
+		nodes = append(nodes, node)
+	})
+	return newGraph(root, nodes)
+}
+
+func newGraph(root *Node, nodes []*Node) *Graph {
+	g := &Graph{
+		root:      root,
+		nodes:     nodes,
+		urlToNode: make(map[string]*Node),
+		in:        make(map[*Node][]Edge),
+	}
+
+	for _, node := range nodes {
+		// A node's own URL takes precedence over another's alias.
+		for _, alias := range node.Aliases {
+			if g.urlToNode[alias] == nil {
+				g.urlToNode[alias] = node
+			}
+		}
+	}
+	for _, node := range nodes {
+		g.urlToNode[node.Url] = node
+
+		for _, e := range node.Out {
+			g.in[e.Node] = append(g.in[e.Node], Edge{Kind: e.Kind, Node: node})
+		}
+	}
+
+	return g
+}
+
+// Root returns the root of the graph, or nil if it's a subgraph that doesn't
+// include the root.
+func (g *Graph) Root() *Node {
+	return g.root
+}
+
+// Nodes returns every node in the graph. For a graph made by NewGraph, they
+// are in the order that Traverse visits them, starting with the root.
+func (g *Graph) Nodes() []*Node {
+	return g.nodes
+}
+
+// Node returns the node with the given URL or alias, or nil if there is none.
+func (g *Graph) Node(url string) *Node {
+	return g.urlToNode[url]
+}
+
+// InEdges returns the incoming edges of the node with the given URL. The Node
+// field of each returned edge is the node that the edge comes from.
+func (g *Graph) InEdges(url string) []Edge {
+	return g.in[g.Node(url)]
+}
+
+// Predecessors returns the nodes that have an edge of any kind to the node
+// with the given URL, each once.
+func (g *Graph) Predecessors(url string) []*Node {
+	return distinctNodes(g.InEdges(url))
+}
+
+// Successors returns the nodes that the node with the given URL has an edge of
+// any kind to, each once.
+func (g *Graph) Successors(url string) []*Node {
+	node := g.Node(url)
+	if node == nil {
+		return nil
+	}
+	return distinctNodes(node.Out)
+}
+
+// ShortestPath returns the nodes on a shortest path along edges of any kind
+// from the node with URL from to the node with URL to, including both of them.
+// It returns nil if there is no such path.
+func (g *Graph) ShortestPath(from, to string) []*Node {
+	start, end := g.Node(from), g.Node(to)
+	if start == nil || end == nil {
+		return nil
+	}
+
+	// Breadth first search, recording how each node was reached.
+	previous := map[*Node]*Node{start: nil}
+	queue := []*Node{start}
+	for len(queue) > 0 && previous[end] == nil && end != start {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, e := range node.Out {
+			if _, ok := previous[e.Node]; !ok {
+				previous[e.Node] = node
+				queue = append(queue, e.Node)
+			}
+		}
+	}
+
+	if _, ok := previous[end]; !ok {
+		return nil
+	}
+
+	var path []*Node
+	for node := end; node != nil; node = previous[node] {
+		path = append([]*Node{node}, path...)
+	}
+	return path
+}
+
+// NodesAtDepth returns the nodes with the given depth, in the order of Nodes.
+func (g *Graph) NodesAtDepth(depth int) []*Node {
+	return g.Filter(func(node *Node) bool {
+		return node.Depth == depth
+	})
+}
+
+// Filter returns the nodes for which keep returns true, in the order of Nodes.
+func (g *Graph) Filter(keep func(node *Node) bool) []*Node {
+	var nodes []*Node
+	for _, node := range g.nodes {
+		if keep(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Subgraph makes a graph of copies of the nodes for which keep returns true,
+// with only the edges between them. The copies share their metadata with the
+// original nodes, but are otherwise independent of them, and their other
+// fields (e.g. Popularity) are unchanged.
+func (g *Graph) Subgraph(keep func(node *Node) bool) *Graph {
+	copies := make(map[*Node]*Node)
+	var nodes []*Node
+	for _, node := range g.Filter(keep) {
+		c := *node
+		c.Aliases = append([]string(nil), node.Aliases...)
+		copies[node] = &c
+		nodes = append(nodes, &c)
+	}
+
+	for original, c := range copies {
+		c.Out = []Edge{}
+		for _, e := range original.Out {
+			if to := copies[e.Node]; to != nil {
+				c.Out = append(c.Out, Edge{Kind: e.Kind, Node: to})
+			}
+		}
+	}
+
+	return newGraph(copies[g.root], nodes)
+}
+
+// distinctNodes returns the nodes of edges, each once, in the order they first
+// appear.
+func distinctNodes(edges []Edge) []*Node {
+	var nodes []*Node
+	seen := make(map[*Node]bool)
+	for _, e := range edges {
+		if !seen[e.Node] {
+			seen[e.Node] = true
+			nodes = append(nodes, e.Node)
+		}
+	}
+	return nodes
+}
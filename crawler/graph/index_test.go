@@ -0,0 +1,111 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func urls(nodes []*Node) string {
+	var s []string
+	for _, node := range nodes {
+		s = append(s, node.Url)
+	}
+	return strings.Join(s, " ")
+}
+
+func makeIndexTestGraph() *Node {
+	//       A ------> E
+	//      / \
+	//     B-->C
+	//      \ / \
+	//       D   F (asset)
+	//
+	//     (edges point down or right; D also links back to A)
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B", Depth: 1}
+	c := &Node{Url: "C", Depth: 1, Aliases: []string{"C2"}}
+	d := &Node{Url: "D", Depth: 2}
+	e := &Node{Url: "E", Depth: 1}
+	f := &Node{Url: "F", Depth: 2, PureAsset: true}
+	a.Out = []Edge{{EdgeKindLink, b}, {EdgeKindLink, c}, {EdgeKindSitemap, e}}
+	b.Out = []Edge{{EdgeKindLink, c}, {EdgeKindLink, d}}
+	c.Out = []Edge{{EdgeKindLink, d}, {EdgeKindAsset, f}, {EdgeKindLink, d}}
+	d.Out = []Edge{{EdgeKindLink, a}}
+	return a
+}
+
+func TestGraph(t *testing.T) {
+	root := makeIndexTestGraph()
+	g := NewGraph(root)
+
+	if g.Root() != root || len(g.Nodes()) != 6 || g.Nodes()[0] != root {
+		t.Errorf("Unexpected root %v or nodes %v\n", g.Root(), urls(g.Nodes()))
+	}
+
+	if g.Node("C") == nil || g.Node("C2") != g.Node("C") || g.Node("G") != nil {
+		t.Errorf("Unexpected lookup by URL or alias\n")
+	}
+
+	if in := g.InEdges("D"); len(in) != 3 || in[0].Node.Url != "C" || in[1].Node.Url != "C" || in[2].Node.Url != "B" {
+		t.Errorf("Unexpected incoming edges for D: %+v\n", in)
+	}
+
+	type test struct {
+		actual   []*Node
+		expected string
+	}
+
+	tests := []test{
+		// (Traverse visits C before B.)
+		{g.Predecessors("D"), "C B"},
+		{g.Predecessors("C2"), "A B"},
+		{g.Predecessors("G"), ""},
+		{g.Successors("C"), "D F"},
+		{g.Successors("F"), ""},
+		{g.Successors("G"), ""},
+		{g.ShortestPath("A", "D"), "A B D"},
+		{g.ShortestPath("D", "F"), "D A C F"},
+		{g.ShortestPath("B", "B"), "B"},
+		{g.ShortestPath("F", "A"), ""},
+		{g.ShortestPath("A", "G"), ""},
+		{g.NodesAtDepth(1), urls(g.Filter(func(node *Node) bool { return node.Url == "B" || node.Url == "C" || node.Url == "E" }))},
+		{g.NodesAtDepth(3), ""},
+	}
+
+	for i, tst := range tests {
+		if actual := urls(tst.actual); actual != tst.expected {
+			t.Errorf("Test %v: expected %v; got %v\n", i, tst.expected, actual)
+		}
+	}
+}
+
+func TestSubgraph(t *testing.T) {
+	root := makeIndexTestGraph()
+	g := NewGraph(root)
+
+	sub := g.Subgraph(func(node *Node) bool {
+		return !node.PureAsset && node.Url != "B"
+	})
+
+	if len(sub.Nodes()) != 4 || sub.Root() == nil || sub.Root() == root || sub.Root().Url != "A" {
+		t.Errorf("Unexpected subgraph nodes %v\n", urls(sub.Nodes()))
+	}
+	if actual := urls(sub.Successors("C")); actual != "D" {
+		t.Errorf("Expected only the edges between kept nodes; got %v\n", actual)
+	}
+	if actual := urls(sub.ShortestPath("A", "D")); actual != "A C D" {
+		t.Errorf("Unexpected path in subgraph: %v\n", actual)
+	}
+	if sub.Node("C2") == nil {
+		t.Errorf("Expected aliases in subgraph\n")
+	}
+
+	// The original graph is unchanged.
+	if len(g.Node("C").Out) != 3 || urls(g.Successors("A")) != "B C E" {
+		t.Errorf("Original graph changed by Subgraph\n")
+	}
+
+	if withoutRoot := g.Subgraph(func(node *Node) bool { return node.Depth > 0 }); withoutRoot.Root() != nil || len(withoutRoot.Nodes()) != 5 {
+		t.Errorf("Unexpected subgraph without root: %v\n", urls(withoutRoot.Nodes()))
+	}
+}
@@ -0,0 +1,256 @@
+package graph
+
+import (
+	"math"
+)
+
+// MetricsOptions configures how ComputeMetrics computes PageRank and HITS
+// scores, which are approximated iteratively. The zero value gives the
+// defaults (DefaultDamping, DefaultMaxIterations and DefaultTolerance).
+type MetricsOptions struct {
+	// The probability that someone on a page follows one of its links,
+	// rather than going to a random page. 0.85 if 0.
+	Damping float64
+
+	// The maximum number of iterations. 100 if 0.
+	MaxIterations int
+
+	// Iteration stops early when no score changes by more than this. 1e-9 if
+	// 0.
+	Tolerance float64
+}
+
+const DefaultDamping = 0.85
+const DefaultMaxIterations = 100
+const DefaultTolerance = 1e-9
+
+func (options MetricsOptions) withDefaults() MetricsOptions {
+	if options.Damping == 0 {
+		options.Damping = DefaultDamping
+	}
+	if options.MaxIterations == 0 {
+		options.MaxIterations = DefaultMaxIterations
+	}
+	if options.Tolerance == 0 {
+		options.Tolerance = DefaultTolerance
+	}
+	return options
+}
+
+// linkGraph is the structure of links between the pages of a graph: nodes that
+// aren't pure assets, and the link edges between them. Nodes are identified by
+// their index in pages.
+type linkGraph struct {
+	pages []*Node
+	out   [][]int
+	in    [][]int
+}
+
+func makeLinkGraph(g *Graph) linkGraph {
+	lg := linkGraph{}
+	index := make(map[*Node]int)
+	for _, node := range g.Nodes() {
+		if !node.PureAsset {
+			index[node] = len(lg.pages)
+			lg.pages = append(lg.pages, node)
+		}
+	}
+
+	lg.out = make([][]int, len(lg.pages))
+	lg.in = make([][]int, len(lg.pages))
+	for i, node := range lg.pages {
+		// Several links to the same page count as one, and links from a page
+		// to itself are ignored.
+		seen := map[int]bool{i: true}
+		for _, e := range node.Out {
+			j, ok := index[e.Node]
+			if e.Kind != EdgeKindLink || !ok || seen[j] {
+				continue
+			}
+			seen[j] = true
+			lg.out[i] = append(lg.out[i], j)
+			lg.in[j] = append(lg.in[j], i)
+		}
+	}
+
+	return lg
+}
+
+// ComputeMetrics sets the PageRank, HubScore, AuthorityScore and Betweenness
+// of every node in g. They consider only the links between pages, so they are
+// zero for pure assets.
+func ComputeMetrics(g *Graph, options MetricsOptions) {
+	lg := makeLinkGraph(g)
+	pageRanks := lg.pageRank(options.withDefaults())
+	hubs, authorities := lg.hits(options.withDefaults())
+	betweenness := lg.betweenness()
+
+	for _, node := range g.Nodes() {
+		node.PageRank, node.HubScore, node.AuthorityScore, node.Betweenness = 0, 0, 0, 0
+	}
+	for i, node := range lg.pages {
+		node.PageRank = pageRanks[i]
+		node.HubScore = hubs[i]
+		node.AuthorityScore = authorities[i]
+		node.Betweenness = betweenness[i]
+	}
+}
+
+// pageRank computes the probability of being on each page after following
+// links at random for a long time. The scores add up to 1. Someone on a page
+// without links goes to a random page.
+func (lg linkGraph) pageRank(options MetricsOptions) []float64 {
+	n := len(lg.pages)
+	ranks := make([]float64, n)
+	for i := range ranks {
+		ranks[i] = 1 / float64(n)
+	}
+
+	for iteration := 0; iteration < options.MaxIterations; iteration++ {
+		dangling := 0.0
+		for i := range lg.pages {
+			if len(lg.out[i]) == 0 {
+				dangling += ranks[i]
+			}
+		}
+
+		next := make([]float64, n)
+		change := 0.0
+		for j := range lg.pages {
+			sum := dangling / float64(n)
+			for _, i := range lg.in[j] {
+				sum += ranks[i] / float64(len(lg.out[i]))
+			}
+			next[j] = (1-options.Damping)/float64(n) + options.Damping*sum
+			change = math.Max(change, math.Abs(next[j]-ranks[j]))
+		}
+
+		ranks = next
+		if change < options.Tolerance {
+			break
+		}
+	}
+
+	return ranks
+}
+
+// hits computes Kleinberg's hub and authority scores: a good hub links to good
+// authorities, and a good authority is linked to by good hubs. Each set of
+// scores is normalized so that the sum of their squares is 1, unless there are
+// no links, in which case they are all 0.
+func (lg linkGraph) hits(options MetricsOptions) (hubs, authorities []float64) {
+	n := len(lg.pages)
+	hubs = make([]float64, n)
+	authorities = make([]float64, n)
+	for i := range hubs {
+		hubs[i] = 1
+	}
+
+	for iteration := 0; iteration < options.MaxIterations; iteration++ {
+		nextAuthorities := make([]float64, n)
+		for j := range lg.pages {
+			for _, i := range lg.in[j] {
+				nextAuthorities[j] += hubs[i]
+			}
+		}
+		normalize(nextAuthorities)
+
+		nextHubs := make([]float64, n)
+		for i := range lg.pages {
+			for _, j := range lg.out[i] {
+				nextHubs[i] += nextAuthorities[j]
+			}
+		}
+		normalize(nextHubs)
+
+		change := 0.0
+		for i := range lg.pages {
+			change = math.Max(change, math.Abs(nextHubs[i]-hubs[i]))
+			change = math.Max(change, math.Abs(nextAuthorities[i]-authorities[i]))
+		}
+
+		hubs, authorities = nextHubs, nextAuthorities
+		if change < options.Tolerance {
+			break
+		}
+	}
+
+	return hubs, authorities
+}
+
+// normalize scales scores so that the sum of their squares is 1, unless they
+// are all 0.
+func normalize(scores []float64) {
+	sum := 0.0
+	for _, s := range scores {
+		sum += s * s
+	}
+	if sum == 0 {
+		return
+	}
+
+	norm := math.Sqrt(sum)
+	for i := range scores {
+		scores[i] /= norm
+	}
+}
+
+// betweenness computes the fraction of shortest paths between other pairs of
+// pages that pass through each page, using Brandes' algorithm. If there are
+// several shortest paths between a pair of pages, each counts equally. The
+// scores are between 0 and 1.
+func (lg linkGraph) betweenness() []float64 {
+	n := len(lg.pages)
+	scores := make([]float64, n)
+
+	for s := range lg.pages {
+		// Find the shortest paths from s breadth first, counting them (in
+		// sigma) and recording the pages that precede each page on them.
+		var order []int
+		predecessors := make([][]int, n)
+		sigma := make([]float64, n)
+		distance := make([]int, n)
+		for i := range distance {
+			distance[i] = -1
+		}
+		sigma[s], distance[s] = 1, 0
+
+		queue := []int{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			order = append(order, v)
+
+			for _, w := range lg.out[v] {
+				if distance[w] < 0 {
+					distance[w] = distance[v] + 1
+					queue = append(queue, w)
+				}
+				if distance[w] == distance[v]+1 {
+					sigma[w] += sigma[v]
+					predecessors[w] = append(predecessors[w], v)
+				}
+			}
+		}
+
+		// Accumulate the pages' dependencies, from the furthest back.
+		delta := make([]float64, n)
+		for i := len(order) - 1; i >= 0; i-- {
+			w := order[i]
+			for _, v := range predecessors[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				scores[w] += delta[w]
+			}
+		}
+	}
+
+	if n > 2 {
+		for i := range scores {
+			scores[i] /= float64((n - 1) * (n - 2))
+		}
+	}
+
+	return scores
+}
@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestPageRank(t *testing.T) {
+	// A page without links shares its rank among every page, so
+	// r(A) = (1 - d) / 2 + d * r(B) / 2, and r(A) = 1 / (2 + d).
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B"}
+	css := &Node{Url: "C", PureAsset: true}
+	a.Out = []Edge{{EdgeKindLink, b}, {EdgeKindLink, b}, {EdgeKindAsset, css}}
+	b.Out = []Edge{{EdgeKindAsset, css}, {EdgeKindLink, b}}
+	g := NewGraph(a)
+
+	type test struct {
+		options MetricsOptions
+		rankA   float64
+	}
+
+	tests := []test{
+		{MetricsOptions{}, 1 / 2.85},
+		{MetricsOptions{Damping: 0.5}, 1 / 2.5},
+		{MetricsOptions{MaxIterations: 1}, 0.15/2 + 0.85*0.25},
+	}
+
+	for _, tst := range tests {
+		ComputeMetrics(g, tst.options)
+		if !near(a.PageRank, tst.rankA) || !near(a.PageRank+b.PageRank, 1) || css.PageRank != 0 {
+			t.Errorf("Unexpected PageRanks with %+v: %v %v %v\n", tst.options, a.PageRank, b.PageRank, css.PageRank)
+		}
+	}
+}
+
+func TestPageRankOfCycle(t *testing.T) {
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B"}
+	c := &Node{Url: "C"}
+	d := &Node{Url: "D"}
+	a.Out = []Edge{{EdgeKindLink, b}, {EdgeKindSitemap, d}}
+	b.Out = []Edge{{EdgeKindLink, c}}
+	c.Out = []Edge{{EdgeKindLink, a}}
+	ComputeMetrics(NewGraph(a), MetricsOptions{})
+
+	// D isn't linked to, so it only gets the share of every page when not
+	// following links, and of itself since it has no links:
+	// r(D) = 0.15 / 4 + 0.85 * r(D) / 4.
+	if !near(d.PageRank, 0.15/4/(1-0.85/4)) || !near(a.PageRank, b.PageRank) || !near(b.PageRank, c.PageRank) || !near(a.PageRank+b.PageRank+c.PageRank+d.PageRank, 1) {
+		t.Errorf("Unexpected PageRanks: %v %v %v %v\n", a.PageRank, b.PageRank, c.PageRank, d.PageRank)
+	}
+}
+
+func TestHits(t *testing.T) {
+	// A and B link to C, and A also links to D.
+	root := &Node{Url: "R"}
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B"}
+	c := &Node{Url: "C"}
+	d := &Node{Url: "D"}
+	root.Out = []Edge{{EdgeKindSeed, a}, {EdgeKindSeed, b}}
+	a.Out = []Edge{{EdgeKindLink, c}, {EdgeKindLink, d}}
+	b.Out = []Edge{{EdgeKindLink, c}}
+	ComputeMetrics(NewGraph(root), MetricsOptions{})
+
+	if !(a.HubScore > b.HubScore && b.HubScore > 0 && c.HubScore == 0 && root.HubScore == 0) {
+		t.Errorf("Unexpected hub scores: A=%v B=%v C=%v R=%v\n", a.HubScore, b.HubScore, c.HubScore, root.HubScore)
+	}
+	if !(c.AuthorityScore > d.AuthorityScore && d.AuthorityScore > 0 && a.AuthorityScore == 0) {
+		t.Errorf("Unexpected authority scores: C=%v D=%v A=%v\n", c.AuthorityScore, d.AuthorityScore, a.AuthorityScore)
+	}
+	if !near(c.AuthorityScore*c.AuthorityScore+d.AuthorityScore*d.AuthorityScore, 1) {
+		t.Errorf("Expected authority scores to be normalized: C=%v D=%v\n", c.AuthorityScore, d.AuthorityScore)
+	}
+}
+
+func TestBetweenness(t *testing.T) {
+	//     A --> B --> D
+	//      \        /
+	//       -> C --
+	//
+	// Half of the shortest paths from A to D go through each of B and C, and
+	// they are the only paths through another page. There are 3 * 2 ordered
+	// pairs of other pages for each page.
+	a := &Node{Url: "A"}
+	b := &Node{Url: "B"}
+	c := &Node{Url: "C"}
+	d := &Node{Url: "D"}
+	img := &Node{Url: "I", PureAsset: true}
+	a.Out = []Edge{{EdgeKindLink, b}, {EdgeKindLink, c}}
+	b.Out = []Edge{{EdgeKindLink, d}, {EdgeKindAsset, img}}
+	c.Out = []Edge{{EdgeKindLink, d}}
+	ComputeMetrics(NewGraph(a), MetricsOptions{})
+
+	if !near(b.Betweenness, 0.5/6) || !near(c.Betweenness, 0.5/6) || a.Betweenness != 0 || d.Betweenness != 0 || img.Betweenness != 0 {
+		t.Errorf("Unexpected betweenness: A=%v B=%v C=%v D=%v I=%v\n", a.Betweenness, b.Betweenness, c.Betweenness, d.Betweenness, img.Betweenness)
+	}
+
+	// A chain: B is on the only path from A to C, of 2 * 1 pairs.
+	a.Out = []Edge{{EdgeKindLink, b}}
+	b.Out = []Edge{{EdgeKindLink, c}}
+	c.Out = nil
+	ComputeMetrics(NewGraph(a), MetricsOptions{})
+	if !near(b.Betweenness, 1.0/2) || a.Betweenness != 0 || c.Betweenness != 0 {
+		t.Errorf("Unexpected betweenness in chain: A=%v B=%v C=%v\n", a.Betweenness, b.Betweenness, c.Betweenness)
+	}
+}
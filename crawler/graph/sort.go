@@ -3,11 +3,13 @@ package graph
 import "sort"
 
 // For determinism, we order the list of outgoing edges by
-//   (i)  assets before links
+//   (i)  assets, then links, then sitemap edges, then seed edges
 //   (ii) lexicographic order of URL
+// and the aliases of each node lexicographically.
 func Sort(node *Node) {
 	Traverse(node, func(node *Node) {
 		sortEdges(node)
+		sort.Strings(node.Aliases)
 	})
 }
 
@@ -19,11 +21,8 @@ type EdgeOrder []Edge
 
 func (a EdgeOrder) Len() int { return len(a) }
 func (a EdgeOrder) Less(i, j int) bool {
-	if a[i].Kind == EdgeKindAsset && a[j].Kind == EdgeKindLink {
-		return true
-	}
-	if a[i].Kind == EdgeKindLink && a[j].Kind == EdgeKindAsset {
-		return false
+	if a[i].Kind != a[j].Kind {
+		return a[i].Kind < a[j].Kind
 	}
 	return a[i].Node.Url < a[j].Node.Url
 }
@@ -0,0 +1,272 @@
+// Package http_cache provides an http.RoundTripper that caches responses on
+// disk. Stale responses are revalidated with conditional requests when they
+// have an ETag or Last-Modified header. In offline mode, responses are only
+// ever served from the cache, and HEAD requests are answered from the cached
+// response to a GET request.
+package http_cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type NotCachedError struct {
+	url string
+}
+
+func (e *NotCachedError) Error() string {
+	return fmt.Sprintf("%v is not in the cache", e.url)
+}
+
+// NotCached says that the request failed because we're offline, rather than
+// because the server couldn't be reached.
+func (e *NotCachedError) NotCached() bool {
+	return true
+}
+
+type Transport struct {
+	// The directory that cached responses are stored in. It's created if it
+	// doesn't exist.
+	Dir string
+
+	// If true, no requests are made, and requests for resources that aren't
+	// cached fail with a NotCachedError. Only GET responses are cached, so
+	// requests with other methods fail too, except for HEAD requests.
+	Offline bool
+
+	// Used to make requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+type entry struct {
+	Url        string
+	Status     string
+	StatusCode int
+	Header     http.Header
+	StoredAt   time.Time
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "HEAD" && t.Offline {
+		cached, body, err := t.load(cacheKey(req.URL.String()))
+		if err != nil {
+			return nil, &NotCachedError{url: req.URL.String()}
+		}
+		resp := cached.response(req, body)
+		resp.Body = http.NoBody
+		return resp, nil
+	}
+
+	if req.Method != "GET" {
+		if t.Offline {
+			return nil, &NotCachedError{url: req.URL.String()}
+		}
+		return t.base().RoundTrip(req)
+	}
+
+	key := cacheKey(req.URL.String())
+	cached, body, err := t.load(key)
+	if err != nil {
+		cached = nil
+	}
+
+	if t.Offline {
+		if cached == nil {
+			return nil, &NotCachedError{url: req.URL.String()}
+		}
+		return cached.response(req, body), nil
+	}
+
+	if cached != nil && cached.isFresh(time.Now()) {
+		return cached.response(req, body), nil
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		for k, v := range resp.Header {
+			cached.Header[k] = v
+		}
+		cached.StoredAt = time.Now()
+		t.store(key, cached, body)
+		return cached.response(req, body), nil
+	}
+
+	if !isCacheable(resp) {
+		return resp, nil
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	t.store(key, &entry{
+		Url:        req.URL.String(),
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		StoredAt:   time.Now(),
+	}, body)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func isCacheable(resp *http.Response) bool {
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	return !hasDirective(resp.Header, "no-store")
+}
+
+// isFresh determines whether an entry can be used without revalidating it,
+// based on its Cache-Control and Expires headers. Entries with neither are
+// always revalidated.
+func (e *entry) isFresh(now time.Time) bool {
+	if hasDirective(e.Header, "no-cache") {
+		return false
+	}
+
+	for _, directive := range strings.Split(e.Header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(strings.ToLower(directive))
+		if strings.HasPrefix(directive, "max-age=") {
+			seconds, err := strconv.Atoi(directive[len("max-age="):])
+			if err != nil {
+				return false
+			}
+			return now.Before(e.StoredAt.Add(time.Duration(seconds) * time.Second))
+		}
+	}
+
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		return err == nil && now.Before(t)
+	}
+
+	return false
+}
+
+func hasDirective(header http.Header, directive string) bool {
+	for _, d := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(d), directive) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *entry) response(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func cacheKey(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *Transport) paths(key string) (entryPath, bodyPath string) {
+	return filepath.Join(t.Dir, key+".json"), filepath.Join(t.Dir, key+".body")
+}
+
+func (t *Transport) load(key string) (*entry, []byte, error) {
+	entryPath, bodyPath := t.paths(key)
+
+	entryBytes, err := os.ReadFile(entryPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var e entry
+	if err := json.Unmarshal(entryBytes, &e); err != nil {
+		return nil, nil, err
+	}
+
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &e, body, nil
+}
+
+// store writes an entry to the cache. Failing to write to the cache isn't
+// fatal, so errors are ignored.
+func (t *Transport) store(key string, e *entry, body []byte) {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return
+	}
+
+	entryBytes, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	entryPath, bodyPath := t.paths(key)
+
+	// The body is written first, so that an entry is never read without its
+	// body.
+	if writeFileAtomically(bodyPath, body) == nil {
+		writeFileAtomically(entryPath, entryBytes)
+	}
+}
+
+func writeFileAtomically(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, bytes.NewReader(data))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,164 @@
+package http_cache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	*httptest.Server
+	hits        map[string]int
+	conditional map[string]int
+}
+
+func makeTestServer() *testServer {
+	s := &testServer{hits: make(map[string]int), conditional: make(map[string]int)}
+	lastModified := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				s.conditional[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/lastmodified":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				s.conditional[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/maxage":
+			w.Header().Set("Cache-Control", "max-age=3600")
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/error":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		fmt.Fprintf(w, "body of %v", r.URL.Path)
+	}))
+
+	return s
+}
+
+func get(t *testing.T, client *http.Client, u string) (int, string, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading body: %v\n", err)
+	}
+
+	return resp.StatusCode, string(body), nil
+}
+
+func TestTransport(t *testing.T) {
+	server := makeTestServer()
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{Dir: t.TempDir()}}
+
+	type test struct {
+		path                string
+		expectedStatusCode  int
+		expectedHits        int
+		expectedConditional int
+	}
+
+	tests := []test{
+		// Stale entries with validators are revalidated.
+		{"/etag", 200, 2, 1},
+		{"/lastmodified", 200, 2, 1},
+		// Fresh entries are served from the cache.
+		{"/maxage", 200, 1, 0},
+		// Stale entries without validators are fetched again.
+		{"/plain", 200, 2, 0},
+		{"/nostore", 200, 2, 0},
+		{"/error", 503, 2, 0},
+	}
+
+	for _, tst := range tests {
+		for i := 0; i < 2; i++ {
+			statusCode, body, err := get(t, client, server.URL+tst.path)
+			if err != nil || statusCode != tst.expectedStatusCode || body != "body of "+tst.path {
+				t.Errorf("Unexpected response %v %v (error %v) for request %v to %v\n", statusCode, body, err, i, tst.path)
+			}
+		}
+
+		if server.hits[tst.path] != tst.expectedHits || server.conditional[tst.path] != tst.expectedConditional {
+			t.Errorf("Expected %v hits (%v conditional) for %v; got %v (%v)\n", tst.expectedHits, tst.expectedConditional, tst.path, server.hits[tst.path], server.conditional[tst.path])
+		}
+	}
+}
+
+func TestTransportOffline(t *testing.T) {
+	server := makeTestServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	onlineClient := &http.Client{Transport: &Transport{Dir: dir}}
+	offlineClient := &http.Client{Transport: &Transport{Dir: dir, Offline: true}}
+
+	if _, _, err := get(t, onlineClient, server.URL+"/etag"); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	statusCode, body, err := get(t, offlineClient, server.URL+"/etag")
+	if err != nil || statusCode != 200 || body != "body of /etag" {
+		t.Errorf("Unexpected offline response %v %v (error %v)\n", statusCode, body, err)
+	}
+
+	if server.hits["/etag"] != 1 {
+		t.Errorf("Expected 1 hit, got %v\n", server.hits["/etag"])
+	}
+
+	_, _, err = get(t, offlineClient, server.URL+"/plain")
+	if err == nil {
+		t.Errorf("Expected error for uncached resource in offline mode\n")
+	}
+}
+
+func TestTransportOfflineHead(t *testing.T) {
+	server := makeTestServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	onlineClient := &http.Client{Transport: &Transport{Dir: dir}}
+	offlineClient := &http.Client{Transport: &Transport{Dir: dir, Offline: true}}
+
+	if _, _, err := get(t, onlineClient, server.URL+"/etag"); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	resp, err := offlineClient.Head(server.URL + "/etag")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || len(body) != 0 || resp.ContentLength != int64(len("body of /etag")) {
+		t.Errorf("Unexpected offline HEAD response %v with body '%v' and length %v\n", resp.StatusCode, string(body), resp.ContentLength)
+	}
+
+	if server.hits["/etag"] != 1 {
+		t.Errorf("Expected 1 hit, got %v\n", server.hits["/etag"])
+	}
+
+	if _, err := offlineClient.Head(server.URL + "/plain"); err == nil {
+		t.Errorf("Expected error for uncached resource in offline mode\n")
+	}
+}
@@ -0,0 +1,255 @@
+package http_source
+
+import (
+	"strings"
+)
+
+type urlKind int
+
+const (
+	// A resource used by a page, which isn't crawled.
+	urlKindAsset urlKind = iota
+
+	// An asset that is loaded to find the assets that it refers to.
+	urlKindStylesheet
+
+	// A page, which is crawled.
+	urlKindLink
+
+	// The canonical URL of the page containing it.
+	urlKindCanonical
+)
+
+// urlAttribute describes an attribute of an HTML element that contains URLs.
+type urlAttribute struct {
+	name string
+	kind urlKind
+
+	// If not nil, the attribute only contains URLs if this returns true.
+	when func(attributes map[string]string) bool
+
+	// Extracts the URLs from the attribute's value. If nil, the value is a
+	// single URL.
+	parse func(value string) []string
+}
+
+// urlAttributes lists the attributes that contain URLs for each element. If an
+// element has more than one entry for an attribute, the first whose condition
+// holds is used.
+var urlAttributes = map[string][]urlAttribute{
+	"a":          {{name: "href", kind: urlKindLink}},
+	"area":       {{name: "href", kind: urlKindLink}},
+	"iframe":     {{name: "src", kind: urlKindLink}},
+	"frame":      {{name: "src", kind: urlKindLink}},
+	"blockquote": {{name: "cite", kind: urlKindLink}},
+	"q":          {{name: "cite", kind: urlKindLink}},
+	"del":        {{name: "cite", kind: urlKindLink}},
+	"ins":        {{name: "cite", kind: urlKindLink}},
+	"meta":       {{name: "content", kind: urlKindLink, when: isRefresh, parse: parseRefresh}},
+
+	// Form submissions aren't safe to crawl, so their targets are assets.
+	"form":   {{name: "action", kind: urlKindAsset}},
+	"button": {{name: "formaction", kind: urlKindAsset}},
+	"input": {
+		{name: "src", kind: urlKindAsset},
+		{name: "formaction", kind: urlKindAsset},
+	},
+
+	"link": {
+		{name: "href", kind: urlKindCanonical, when: isCanonicalLink},
+		{name: "href", kind: urlKindStylesheet, when: isStylesheetLink},
+		{name: "href", kind: urlKindAsset},
+		// (imagesizes describes the sizes of the images, not their URLs.)
+		{name: "imagesrcset", kind: urlKindAsset, parse: parseSrcset},
+	},
+	"img": {
+		{name: "src", kind: urlKindAsset},
+		{name: "srcset", kind: urlKindAsset, parse: parseSrcset},
+	},
+	"source": {
+		{name: "src", kind: urlKindAsset},
+		{name: "srcset", kind: urlKindAsset, parse: parseSrcset},
+	},
+	"video": {
+		{name: "src", kind: urlKindAsset},
+		{name: "poster", kind: urlKindAsset},
+	},
+	"audio":  {{name: "src", kind: urlKindAsset}},
+	"track":  {{name: "src", kind: urlKindAsset}},
+	"embed":  {{name: "src", kind: urlKindAsset}},
+	"script": {{name: "src", kind: urlKindAsset}},
+	"object": {{name: "data", kind: urlKindAsset}},
+	"html":   {{name: "manifest", kind: urlKindAsset}},
+}
+
+// anyElementUrlAttributes lists the attributes that contain URLs on any
+// element.
+var anyElementUrlAttributes = []urlAttribute{
+	// Obsolete, but still found on <body>, <table> and so on.
+	{name: "background", kind: urlKindAsset},
+}
+
+// unknownElementUrlAttributes lists the attributes that are assumed to contain
+// URLs on elements that aren't in urlAttributes. Only the first that is
+// present is used.
+var unknownElementUrlAttributes = []urlAttribute{
+	{name: "href", kind: urlKindAsset},
+	{name: "src", kind: urlKindAsset},
+}
+
+type tagUrl struct {
+	url  string
+	kind urlKind
+}
+
+// getUrlsFromTag finds the URLs in the attributes of an element, in the order
+// of the entries in urlAttributes.
+func getUrlsFromTag(tagName string, attributes map[string]string) []tagUrl {
+	var urls []tagUrl
+
+	add := func(attr urlAttribute, value string) {
+		values := []string{value}
+		if attr.parse != nil {
+			values = attr.parse(value)
+		}
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				urls = append(urls, tagUrl{url: v, kind: attr.kind})
+			}
+		}
+	}
+
+	if attrs, ok := urlAttributes[tagName]; ok {
+		done := make(map[string]bool)
+		for _, attr := range attrs {
+			value, present := attributes[attr.name]
+			if !present || done[attr.name] || (attr.when != nil && !attr.when(attributes)) {
+				continue
+			}
+			done[attr.name] = true
+			add(attr, value)
+		}
+	} else {
+		for _, attr := range unknownElementUrlAttributes {
+			if value := attributes[attr.name]; value != "" {
+				add(attr, value)
+				break
+			}
+		}
+	}
+
+	for _, attr := range anyElementUrlAttributes {
+		if value, present := attributes[attr.name]; present {
+			add(attr, value)
+		}
+	}
+
+	return urls
+}
+
+// isStylesheetLink determines whether a <link> is to a stylesheet.
+func isStylesheetLink(attributes map[string]string) bool {
+	return hasRel(attributes, "stylesheet")
+}
+
+// isCanonicalLink determines whether a <link> gives the canonical URL of the
+// page.
+func isCanonicalLink(attributes map[string]string) bool {
+	return hasRel(attributes, "canonical")
+}
+
+func hasRel(attributes map[string]string, rel string) bool {
+	for _, r := range strings.Fields(attributes["rel"]) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRefresh determines whether a <meta> is a refresh (which may redirect to
+// another page).
+func isRefresh(attributes map[string]string) bool {
+	return strings.EqualFold(strings.TrimSpace(attributes["http-equiv"]), "refresh")
+}
+
+// parseRefresh finds the URL in the content of a <meta http-equiv="refresh">,
+// which looks like "5; url=http://foo.com/". There is no URL if the page just
+// refreshes itself.
+func parseRefresh(content string) []string {
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return nil
+	}
+
+	rest := strings.TrimSpace(content[i+1:])
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		afterUrl := strings.TrimSpace(rest[3:])
+		if strings.HasPrefix(afterUrl, "=") {
+			rest = strings.TrimSpace(afterUrl[1:])
+		}
+	}
+
+	if len(rest) > 0 && (rest[0] == '"' || rest[0] == '\'') {
+		if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+			rest = rest[1 : end+1]
+		} else {
+			rest = rest[1:]
+		}
+	}
+
+	if rest == "" {
+		return nil
+	}
+	return []string{rest}
+}
+
+// parseSrcset finds the URLs in a srcset attribute, which is a comma separated
+// list of URLs, each optionally followed by descriptors like "2x" or "100w".
+func parseSrcset(srcset string) []string {
+	var urls []string
+
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+
+	i := 0
+	for i < len(srcset) {
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+		u := srcset[start:i]
+
+		// A URL may contain commas, but a trailing comma ends the candidate.
+		if trimmed := strings.TrimRight(u, ","); trimmed != u {
+			if trimmed != "" {
+				urls = append(urls, trimmed)
+			}
+			continue
+		}
+		if u != "" {
+			urls = append(urls, u)
+		}
+
+		// Skip the descriptors, which may contain commas in parentheses.
+		depth := 0
+		for i < len(srcset) {
+			c := srcset[i]
+			i++
+			if c == '(' {
+				depth++
+			} else if c == ')' && depth > 0 {
+				depth--
+			} else if c == ',' && depth == 0 {
+				break
+			}
+		}
+	}
+
+	return urls
+}
@@ -0,0 +1,147 @@
+package http_source
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	type test struct {
+		srcset       string
+		expectedUrls []string
+	}
+
+	tests := []test{
+		{"", nil},
+		{"a.png", []string{"a.png"}},
+		{"a.png 1x, b.png 2x", []string{"a.png", "b.png"}},
+		{"  a.png   100w,\n\tb.png 200w  ", []string{"a.png", "b.png"}},
+		// Without whitespace, the comma is part of the URL.
+		{"a.png,b.png", []string{"a.png,b.png"}},
+		{"a.png, b.png,", []string{"a.png", "b.png"}},
+		{"/img?w=1,2 1x, /img?w=3,4 2x", []string{"/img?w=1,2", "/img?w=3,4"}},
+		{"a.png 1x (future, descriptor), b.png", []string{"a.png", "b.png"}},
+		{",, ,", nil},
+	}
+
+	for _, tst := range tests {
+		urls := parseSrcset(tst.srcset)
+		if strings.Join(urls, " ") != strings.Join(tst.expectedUrls, " ") || len(urls) != len(tst.expectedUrls) {
+			t.Errorf("Expected srcset '%v' to give %q; got %q\n", tst.srcset, tst.expectedUrls, urls)
+		}
+	}
+}
+
+func TestParseRefresh(t *testing.T) {
+	type test struct {
+		content     string
+		expectedUrl string
+	}
+
+	tests := []test{
+		{"5", ""},
+		{"0; url=http://foo.com/", "http://foo.com/"},
+		{"0;URL=/new", "/new"},
+		{"3, url = '/quoted page'", "/quoted page"},
+		{`0; url="/double"`, "/double"},
+		{"0; /no-url-prefix", "/no-url-prefix"},
+		{"0; url=", ""},
+		{"0; url='/unterminated", "/unterminated"},
+	}
+
+	for _, tst := range tests {
+		urls := parseRefresh(tst.content)
+		if strings.Join(urls, " ") != tst.expectedUrl {
+			t.Errorf("Expected refresh '%v' to give '%v'; got %q\n", tst.content, tst.expectedUrl, urls)
+		}
+	}
+}
+
+func TestGetUrlsFromTag(t *testing.T) {
+	type test struct {
+		tagName    string
+		attributes map[string]string
+		expected   []tagUrl
+	}
+
+	tests := []test{
+		{"a", map[string]string{"href": "/page"}, []tagUrl{{"/page", urlKindLink}}},
+		{"a", map[string]string{"src": "/page"}, nil},
+		{"iframe", map[string]string{"src": "/frame"}, []tagUrl{{"/frame", urlKindLink}}},
+		{"blockquote", map[string]string{"cite": "/source"}, []tagUrl{{"/source", urlKindLink}}},
+		{"form", map[string]string{"action": "/submit"}, []tagUrl{{"/submit", urlKindAsset}}},
+		{"link", map[string]string{"rel": "stylesheet", "href": "/a.css"}, []tagUrl{{"/a.css", urlKindStylesheet}}},
+		{"link", map[string]string{"rel": "icon", "href": "/a.ico"}, []tagUrl{{"/a.ico", urlKindAsset}}},
+		{"link", map[string]string{"rel": "preload", "as": "image", "imagesrcset": "a.png 1x, b.png 2x", "imagesizes": "50vw"}, []tagUrl{{"a.png", urlKindAsset}, {"b.png", urlKindAsset}}},
+		{"img", map[string]string{"src": "a.png", "srcset": "a.png 1x, b.png 2x"}, []tagUrl{{"a.png", urlKindAsset}, {"a.png", urlKindAsset}, {"b.png", urlKindAsset}}},
+		{"video", map[string]string{"src": "v.mp4", "poster": "p.jpg"}, []tagUrl{{"v.mp4", urlKindAsset}, {"p.jpg", urlKindAsset}}},
+		{"object", map[string]string{"data": "movie.swf"}, []tagUrl{{"movie.swf", urlKindAsset}}},
+		{"meta", map[string]string{"http-equiv": "Refresh", "content": "0; url=/next"}, []tagUrl{{"/next", urlKindLink}}},
+		{"meta", map[string]string{"name": "description", "content": "0; url=/next"}, nil},
+		{"body", map[string]string{"background": "bg.png"}, []tagUrl{{"bg.png", urlKindAsset}}},
+		{"td", map[string]string{"background": "bg.png"}, []tagUrl{{"bg.png", urlKindAsset}}},
+		{"imggg", map[string]string{"src": "a.png"}, []tagUrl{{"a.png", urlKindAsset}}},
+		{"linkk", map[string]string{"href": "a.css", "src": "b.png"}, []tagUrl{{"a.css", urlKindAsset}}},
+		{"p", map[string]string{}, nil},
+	}
+
+	for _, tst := range tests {
+		urls := getUrlsFromTag(tst.tagName, tst.attributes)
+		if len(urls) != len(tst.expected) {
+			t.Errorf("Expected %+v from <%v %v>; got %+v\n", tst.expected, tst.tagName, tst.attributes, urls)
+			continue
+		}
+		for i := range urls {
+			if urls[i] != tst.expected[i] {
+				t.Errorf("Expected %+v from <%v %v>; got %+v\n", tst.expected, tst.tagName, tst.attributes, urls)
+				break
+			}
+		}
+	}
+}
+
+func TestParseHtmlUrlAttributes(t *testing.T) {
+	input := `
+	<html manifest="app.appcache">
+	<meta http-equiv="refresh" content="30; url=http://foo.com/next">
+	<body background="bg.png">
+	<a href="http://foo.com/link1">Foo!</a>
+	<a href="http://foo.com/link1">Foo again!</a>
+	<iframe src="/frame.html"></iframe>
+	<img src="small.jpeg" srcset="small.jpeg 1x, large.jpeg 2x">
+	<picture><source srcset="wide.webp 800w, narrow.webp 400w"></picture>
+	<video src="movie.mp4" poster="poster.jpeg"></video>
+	<object data="http://otherdomain.com/movie.swf"></object>
+	<form action="/search"><input type="image" src="go.png"></form>
+	<q cite="/quotes">Quote</q>
+	`
+
+	outs, _, _ := parseHtml(
+		&HttpSource{
+			url:          "http://foo.com",
+			host:         "foo.com",
+			protocol:     "http",
+			errorHandler: func(httpUrl string, err error) { panic("Not expecting error") },
+		},
+		mustParseUrl("http://foo.com/"),
+		strings.NewReader(input),
+	)
+
+	var links []string
+	for _, l := range outs.Links {
+		links = append(links, l.Url)
+	}
+	expectedLinks := "http://foo.com/next http://foo.com/link1 http://foo.com/frame.html http://foo.com/quotes"
+	if strings.Join(links, " ") != expectedLinks {
+		t.Errorf("Unexpected links %v\n", links)
+	}
+
+	var assets []string
+	for _, a := range outs.Assets {
+		assets = append(assets, strings.TrimPrefix(a.Url, "http://foo.com/"))
+	}
+	expectedAssets := "app.appcache bg.png small.jpeg large.jpeg wide.webp narrow.webp movie.mp4 poster.jpeg search go.png"
+	if strings.Join(assets, " ") != expectedAssets {
+		t.Errorf("Unexpected assets %v\n", assets)
+	}
+}
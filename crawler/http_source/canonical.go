@@ -0,0 +1,242 @@
+package http_source
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Canonicalizer rewrites URLs so that the different URLs that a site uses for
+// the same resource are treated as one. It is given URLs that have already been
+// normalized as in section 6.2.2 of RFC 3986 (lowercase scheme and host, no
+// default port, consistent percent-encoding).
+type Canonicalizer interface {
+	Canonicalize(u *url.URL)
+}
+
+type TrailingSlashPolicy int
+
+const (
+	// Leave paths as they are.
+	TrailingSlashKeep TrailingSlashPolicy = iota
+
+	// Add a slash to paths whose last segment doesn't look like a file name
+	// (i.e. doesn't contain a dot).
+	TrailingSlashAdd
+
+	// Remove the slash from the end of every path except "/".
+	TrailingSlashRemove
+)
+
+func (p TrailingSlashPolicy) String() string {
+	switch p {
+	case TrailingSlashKeep:
+		return "keep"
+	case TrailingSlashAdd:
+		return "add"
+	case TrailingSlashRemove:
+		return "remove"
+	}
+	return fmt.Sprintf("TrailingSlashPolicy(%d)", int(p))
+}
+
+// ParseTrailingSlashPolicy parses "keep", "add" or "remove".
+func ParseTrailingSlashPolicy(s string) (TrailingSlashPolicy, error) {
+	switch s {
+	case "keep":
+		return TrailingSlashKeep, nil
+	case "add":
+		return TrailingSlashAdd, nil
+	case "remove":
+		return TrailingSlashRemove, nil
+	}
+	return TrailingSlashKeep, fmt.Errorf("Unknown trailing slash policy '%v'", s)
+}
+
+// CanonicalRules is a Canonicalizer configured with a set of common rules. The
+// zero value leaves URLs as they are.
+type CanonicalRules struct {
+	// Query parameters whose names match any of these patterns (as in
+	// path.Match, e.g. "utm_*") are removed.
+	RemoveParams []string
+
+	// If true, query parameters are sorted by name. Parameters with the same
+	// name keep their order.
+	SortParams bool
+
+	TrailingSlash TrailingSlashPolicy
+
+	// File names, such as "index.html", that are removed from the end of
+	// paths, leaving the directory.
+	IndexFiles []string
+
+	// If true, paths are converted to lowercase, for sites whose paths are
+	// case insensitive.
+	LowercasePaths bool
+}
+
+func (r *CanonicalRules) Canonicalize(u *url.URL) {
+	if r.LowercasePaths {
+		// (Keeping the hex digits of percent-encoded characters uppercase.)
+		setEscapedPath(u, normalizePercentEncoding(strings.ToLower(u.EscapedPath())))
+	}
+
+	p := u.EscapedPath()
+	dir, file := p[:strings.LastIndex(p, "/")+1], p[strings.LastIndex(p, "/")+1:]
+
+	for _, index := range r.IndexFiles {
+		if file == index {
+			p, file = dir, ""
+			break
+		}
+	}
+
+	switch r.TrailingSlash {
+	case TrailingSlashAdd:
+		if file != "" && !strings.Contains(file, ".") {
+			p += "/"
+		}
+	case TrailingSlashRemove:
+		if len(p) > 1 && file == "" {
+			p = strings.TrimRight(p, "/")
+			if p == "" {
+				p = "/"
+			}
+		}
+	}
+
+	setEscapedPath(u, p)
+
+	if len(r.RemoveParams) > 0 || r.SortParams {
+		u.RawQuery = r.canonicalizeQuery(u.RawQuery)
+		u.ForceQuery = false
+	}
+}
+
+// canonicalizeQuery removes and sorts the parameters in a query string without
+// re-encoding them.
+func (r *CanonicalRules) canonicalizeQuery(rawQuery string) string {
+	type param struct {
+		name string
+		raw  string
+	}
+
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		rawName := raw
+		if i := strings.IndexByte(raw, '='); i >= 0 {
+			rawName = raw[:i]
+		}
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+
+		if !r.removeParam(name) {
+			params = append(params, param{name: name, raw: raw})
+		}
+	}
+
+	if r.SortParams {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+
+	raws := make([]string, len(params))
+	for i, p := range params {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+func (r *CanonicalRules) removeParam(name string) bool {
+	for _, pattern := range r.RemoveParams {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize applies the normalizations in section 6.2.2 and 6.2.3 of RFC 3986
+// that don't change the resource that a HTTP(S) URL refers to.
+func normalize(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if port := u.Port(); port == "80" && u.Scheme == "http" || port == "443" && u.Scheme == "https" {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	p := normalizePercentEncoding(u.EscapedPath())
+	if p == "" {
+		p = "/"
+	}
+	setEscapedPath(u, p)
+
+	u.RawQuery = normalizePercentEncoding(u.RawQuery)
+}
+
+// setEscapedPath sets the path of a URL from its escaped form, keeping any
+// escaped characters (such as %2F) that have a special meaning unescaped.
+func setEscapedPath(u *url.URL, escaped string) {
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+	u.Path = unescaped
+	u.RawPath = escaped
+}
+
+// normalizePercentEncoding uppercases the hex digits of percent-encoded
+// characters, and decodes those that don't need to be encoded.
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// isUnreserved determines whether a character may appear in any part of a URL
+// without being percent-encoded.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,148 @@
+package http_source
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePercentEncoding(t *testing.T) {
+	type test struct {
+		input    string
+		expected string
+	}
+
+	tests := []test{
+		{"", ""},
+		{"/a/b", "/a/b"},
+		{"/%7Euser", "/~user"},
+		{"/%41%2d%5f%2E", "/A-_."},
+		{"/a%2fb", "/a%2Fb"},
+		{"/caf%c3%a9", "/caf%C3%A9"},
+		{"/100%", "/100%"},
+		{"/%zz%4", "/%zz%4"},
+	}
+
+	for _, tst := range tests {
+		if actual := normalizePercentEncoding(tst.input); actual != tst.expected {
+			t.Errorf("Expected '%v' to normalize to '%v'; got '%v'\n", tst.input, tst.expected, actual)
+		}
+	}
+}
+
+func TestCanonicalRules(t *testing.T) {
+	docs := CanonicalRules{
+		RemoveParams:   []string{"utm_*", "fbclid"},
+		SortParams:     true,
+		TrailingSlash:  TrailingSlashRemove,
+		IndexFiles:     []string{"index.html", "index.htm"},
+		LowercasePaths: true,
+	}
+
+	type test struct {
+		rules    CanonicalRules
+		input    string
+		expected string
+	}
+
+	tests := []test{
+		{CanonicalRules{}, "http://foo.com/Docs/?b=2&a=1", "http://foo.com/Docs/?b=2&a=1"},
+
+		// The same page under different URLs.
+		{docs, "http://foo.com/docs", "http://foo.com/docs"},
+		{docs, "http://foo.com/docs/", "http://foo.com/docs"},
+		{docs, "http://foo.com/docs/index.html", "http://foo.com/docs"},
+		{docs, "http://foo.com/Docs", "http://foo.com/docs"},
+		{docs, "http://foo.com/docs?utm_source=mail&utm_medium=email", "http://foo.com/docs"},
+		{docs, "http://foo.com/docs/?fbclid=123", "http://foo.com/docs"},
+
+		{docs, "http://foo.com/", "http://foo.com/"},
+		{docs, "http://foo.com/index.html", "http://foo.com/"},
+		{docs, "http://foo.com/docs/page.html?b=2&utm_x=1&a=1&b=1", "http://foo.com/docs/page.html?a=1&b=2&b=1"},
+		{docs, "http://foo.com/A%2FB/", "http://foo.com/a%2Fb"},
+		{docs, "http://foo.com/docs/myindex.html", "http://foo.com/docs/myindex.html"},
+
+		{CanonicalRules{TrailingSlash: TrailingSlashAdd}, "http://foo.com/docs", "http://foo.com/docs/"},
+		{CanonicalRules{TrailingSlash: TrailingSlashAdd}, "http://foo.com/docs/", "http://foo.com/docs/"},
+		{CanonicalRules{TrailingSlash: TrailingSlashAdd}, "http://foo.com/style.css", "http://foo.com/style.css"},
+		{CanonicalRules{TrailingSlash: TrailingSlashAdd, IndexFiles: []string{"index.php"}}, "http://foo.com/docs/index.php?a=1", "http://foo.com/docs/?a=1"},
+		{CanonicalRules{TrailingSlash: TrailingSlashRemove}, "http://foo.com//", "http://foo.com/"},
+
+		// Parameters are matched by their decoded names, and aren't re-encoded.
+		{CanonicalRules{RemoveParams: []string{"utm_*"}}, "http://foo.com/?utm%5Fsource=x&q=a+b%20c", "http://foo.com/?q=a+b%20c"},
+		{CanonicalRules{RemoveParams: []string{"utm_*"}}, "http://foo.com/?utm_source=x", "http://foo.com/"},
+		{CanonicalRules{SortParams: true}, "http://foo.com/?z&y=&x=1", "http://foo.com/?x=1&y=&z"},
+	}
+
+	for _, tst := range tests {
+		sess := &session{canonicalizer: &tst.rules}
+		if actual := sess.canonicalize(mustParseUrl(tst.input)); actual != tst.expected {
+			t.Errorf("Expected %v to canonicalize to %v with %+v; got %v\n", tst.input, tst.expected, tst.rules, actual)
+		}
+	}
+}
+
+func TestParseTrailingSlashPolicy(t *testing.T) {
+	for _, p := range []TrailingSlashPolicy{TrailingSlashKeep, TrailingSlashAdd, TrailingSlashRemove} {
+		if parsed, err := ParseTrailingSlashPolicy(p.String()); err != nil || parsed != p {
+			t.Errorf("Couldn't parse %v\n", p)
+		}
+	}
+	if _, err := ParseTrailingSlashPolicy("sometimes"); err == nil {
+		t.Errorf("Expected an error for an unknown policy\n")
+	}
+}
+
+func TestGetOutsCanonical(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`
+		<link rel="canonical" href="/Docs/index.html?utm_source=feed">
+		<link rel="canonical" href="/ignored">
+		<a href="/docs">Docs</a>
+		<a href="/docs/">Docs</a>
+		<a href="/Docs/index.html#intro">Docs</a>
+		<a href="/docs?utm_source=mail">Docs</a>
+		<a href="/other/">Other</a>
+		<img src="/img/logo.png?utm_campaign=x">
+		<img src="/img/logo.png">
+		`))
+	}))
+	defer server.Close()
+
+	source, err := MakeSourceWithOptions(server.URL+"/start/index.html", func(u string, err error) {
+		t.Errorf("Unexpected error for %v: %v\n", u, err)
+	}, Options{Canonicalizer: &CanonicalRules{
+		RemoveParams:   []string{"utm_*"},
+		TrailingSlash:  TrailingSlashRemove,
+		IndexFiles:     []string{"index.html"},
+		LowercasePaths: true,
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	if source.GetUrl() != server.URL+"/start" {
+		t.Errorf("Expected the source's URL to be canonicalized; got %v\n", source.GetUrl())
+	}
+
+	outs := source.GetOuts()
+
+	if outs.Metadata == nil || outs.Metadata.CanonicalUrl != server.URL+"/docs" {
+		t.Errorf("Unexpected metadata %+v\n", outs.Metadata)
+	}
+
+	var links []string
+	for _, l := range outs.Links {
+		links = append(links, strings.TrimPrefix(l.Url, server.URL)+" "+strings.Replace(strings.Join(l.Aliases, ","), server.URL, "", -1))
+	}
+	expectedLinks := "/docs /docs/,/Docs/index.html,/docs?utm_source=mail|/other /other/"
+	if strings.Join(links, "|") != expectedLinks {
+		t.Errorf("Unexpected links %q\n", links)
+	}
+
+	if len(outs.Assets) != 1 || outs.Assets[0].Url != server.URL+"/img/logo.png" || len(outs.Assets[0].Aliases) != 1 {
+		t.Errorf("Unexpected assets %+v\n", outs.Assets)
+	}
+}
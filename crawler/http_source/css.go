@@ -0,0 +1,56 @@
+package http_source
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
+var cssCommentRegexp = regexp.MustCompile(`(?s)/\*.*?\*/`)
+var cssImportRegexp = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*)?(?:"([^"]*)"|'([^']*)'|([^\s'"();]+))`)
+var cssUrlRegexp = regexp.MustCompile(`(?i)\burl\(\s*(?:"([^"]*)"|'([^']*)'|([^\s'"()]*))\s*\)`)
+
+// findCssReferences finds the URLs in the @import rules and url() values of a
+// stylesheet, in order of appearance, with imports first. Imports are other
+// stylesheets, and the rest are assets.
+func findCssReferences(css string) []tagUrl {
+	css = cssCommentRegexp.ReplaceAllString(css, "")
+
+	var refs []tagUrl
+	seen := make(map[string]bool)
+
+	add := func(match []string, kind urlKind) {
+		// Only one of the quoted and unquoted forms matches.
+		u := strings.TrimSpace(match[1] + match[2] + match[3])
+
+		// Fragments refer to elements in the document (e.g. SVG filters).
+		if u == "" || strings.HasPrefix(u, "#") || seen[u] {
+			return
+		}
+		seen[u] = true
+		refs = append(refs, tagUrl{url: u, kind: kind})
+	}
+
+	for _, match := range cssImportRegexp.FindAllStringSubmatch(css, -1) {
+		add(match, urlKindStylesheet)
+	}
+	for _, match := range cssUrlRegexp.FindAllStringSubmatch(css, -1) {
+		add(match, urlKindAsset)
+	}
+
+	return refs
+}
+
+// parseCssDocument finds the assets referred to by a stylesheet at cssUrl.
+// Imported stylesheets can be loaded in turn.
+func parseCssDocument(s *HttpSource, cssUrl *url.URL, reader io.Reader) S.Outs {
+	css, err := io.ReadAll(reader)
+	if err != nil {
+		return S.Outs{}
+	}
+
+	return makeOuts(s, cssUrl, findCssReferences(string(css)))
+}
@@ -0,0 +1,124 @@
+package http_source
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFindCssReferences(t *testing.T) {
+	input := `
+	@import "base.css";
+	@import url('print.css') print;
+	@IMPORT url(theme.css);
+	/* background: url(commented-out.png); */
+	body { background: url(  "bg.png" ) no-repeat; }
+	.a { background-image: url('a.png'), url(b.png); }
+	.b { filter: url(#shadow); mask: url(); }
+	.c { background: url(bg.png); }
+	@font-face { src: url(fonts/f.woff2) format("woff2"), url(data:font/woff;base64,AAAA); }
+	`
+
+	refs := findCssReferences(input)
+
+	var actual []string
+	for _, ref := range refs {
+		actual = append(actual, fmt.Sprintf("%v:%v", ref.url, ref.kind == urlKindStylesheet))
+	}
+
+	expected := "base.css:true print.css:true theme.css:true bg.png:false a.png:false b.png:false fonts/f.woff2:false data:font/woff;base64,AAAA:false"
+	if strings.Join(actual, " ") != expected {
+		t.Errorf("Unexpected CSS references:\n%v\n", strings.Join(actual, " "))
+	}
+}
+
+func TestParseHtmlStyles(t *testing.T) {
+	input := `
+	<link rel="Alternate Stylesheet" href="/css/alt.css">
+	<link rel="icon" href="/favicon.ico">
+	<style>
+	@import "/css/imported.css";
+	body { background: url(images/bg.png); }
+	</style>
+	<div style="background-image: url('/images/div.png')">
+	<a href="/page" style="background: url(/images/link.png)">Page</a>
+	<p>url(not-css.png)</p>
+	`
+
+	outs, _, _ := parseHtml(
+		&HttpSource{
+			url:          "http://foo.com/dir/index.html",
+			host:         "foo.com",
+			protocol:     "http",
+			errorHandler: func(httpUrl string, err error) { panic("Not expecting error") },
+		},
+		mustParseUrl("http://foo.com/dir/index.html"),
+		strings.NewReader(input),
+	)
+
+	if len(outs.Links) != 1 || outs.Links[0].Url != "http://foo.com/page" {
+		t.Errorf("Unexpected links %+v\n", outs.Links)
+	}
+
+	type expectedAsset struct {
+		url      string
+		loadable bool
+	}
+
+	expected := []expectedAsset{
+		{"http://foo.com/css/alt.css", true},
+		{"http://foo.com/favicon.ico", false},
+		{"http://foo.com/css/imported.css", true},
+		{"http://foo.com/dir/images/bg.png", false},
+		{"http://foo.com/images/div.png", false},
+		{"http://foo.com/images/link.png", false},
+	}
+
+	if len(outs.Assets) != len(expected) {
+		t.Fatalf("Unexpected assets %+v\n", outs.Assets)
+	}
+
+	for i, e := range expected {
+		a := outs.Assets[i]
+		if a.Url != e.url || (a.Source != nil) != e.loadable {
+			t.Errorf("Expected asset %v (loadable: %v); got %+v\n", e.url, e.loadable, a)
+		}
+	}
+}
+
+func TestGetOutsCss(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.WriteHeader(404)
+		case "/css/site.css":
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			fmt.Fprintf(w, `@import "../theme.css"; h1 { background: url(../img/h1.png); } a { background: url(http://otherdomain.com/a.png); }`)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	source, err := MakeSource(server.URL+"/css/site.css", func(errorUrl string, err error) {
+		t.Errorf("Unexpected error for %v: %v\n", errorUrl, err)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	outs := source.GetOuts()
+	if len(outs.Links) != 0 || len(outs.Assets) != 2 {
+		t.Fatalf("Unexpected outs %+v\n", outs)
+	}
+
+	if outs.Assets[0].Url != server.URL+"/theme.css" || outs.Assets[0].Source == nil || outs.Assets[1].Url != server.URL+"/img/h1.png" || outs.Assets[1].Source != nil {
+		t.Errorf("Unexpected assets %+v\n", outs.Assets)
+	}
+
+	if outs.Metadata.ContentLength <= 0 {
+		t.Errorf("Expected the length of the stylesheet to be counted; got %v\n", outs.Metadata.ContentLength)
+	}
+}
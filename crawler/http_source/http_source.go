@@ -1,12 +1,14 @@
 package http_source
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 
 type StatusCodeError struct {
 	statusCode string
+	code       int
 }
 
 func (e *StatusCodeError) Error() string {
@@ -30,15 +33,146 @@ func (e *BadProtocolError) Error() string {
 	return fmt.Sprintf("Protocol '%v' not supported", e.protocol)
 }
 
+type RobotsDisallowedError struct{}
+
+func (e *RobotsDisallowedError) Error() string {
+	return "Disallowed by robots.txt"
+}
+
+// NotCachedError is implemented by the errors that transports which only serve
+// cached responses (like http_cache.Transport in offline mode) give for
+// responses that aren't cached, so that they can be told apart from the server
+// being unreachable.
+type NotCachedError interface {
+	error
+	NotCached() bool
+}
+
+// isNotCached returns whether err is, or wraps, a NotCachedError.
+func isNotCached(err error) bool {
+	var notCached NotCachedError
+	return errors.As(err, &notCached) && notCached.NotCached()
+}
+
+const userAgent = "GoCrawl/1.0"
+
+// session holds the state that is shared between all the sources in a crawl.
+type session struct {
+	client        http.Client
+	robots        *robotsCache
+	canonicalizer Canonicalizer
+
+	// Whether to check the links to other sites.
+	checkExternal bool
+
+	// Whether to check the assets that aren't loaded (e.g. images).
+	checkAssets bool
+
+	// The hosts whose pages are crawled, besides each source's own host.
+	hosts map[string]bool
+
+	retries RetryPolicy
+}
+
 type HttpSource struct {
 	url          string
 	host         string // only load from this domain
 	protocol     string // use this protocol by default for relative links
 	path         string
 	errorHandler func(url string, err error)
+	session      *session
+
+	// If true, we only check that the resource exists, as it's on another
+	// site or is an asset that isn't loaded.
+	checkOnly bool
+}
+
+// Options configures how sources load resources.
+type Options struct {
+	// Used to make HTTP requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// If not nil, applied to the URL of every link and asset (and the URL that
+	// the crawl starts from), so that different URLs for the same resource are
+	// treated as one.
+	Canonicalizer Canonicalizer
+
+	// If true, links to other hosts are included as external links, whose
+	// sources check that they exist (without crawling them).
+	CheckExternalLinks bool
+
+	// If true, assets other than stylesheets (e.g. images and scripts) get
+	// sources that check that they exist, so that broken ones are found.
+	CheckAssets bool
+
+	// Other hosts (e.g. "docs.foo.com") whose pages are crawled too, as well
+	// as the hosts of the URLs that the crawl starts from.
+	Hosts []string
+
+	// How to retry requests that fail temporarily. By default, they aren't
+	// retried.
+	Retries RetryPolicy
 }
 
 func MakeSource(u string, errorHandler func(errorUrl string, err error)) (HttpSource, error) {
+	return MakeSourceWithOptions(u, errorHandler, Options{})
+}
+
+func MakeSourceWithOptions(u string, errorHandler func(errorUrl string, err error), options Options) (HttpSource, error) {
+	sources, err := MakeSources([]string{u}, errorHandler, options)
+	if err != nil {
+		return HttpSource{}, err
+	}
+	return sources[0], nil
+}
+
+// MakeSources makes a source for each of the URLs that a crawl starts from.
+// The sources share their options and robots.txt cache, and the pages on the
+// hosts of all of them are crawled.
+func MakeSources(urls []string, errorHandler func(errorUrl string, err error), options Options) ([]HttpSource, error) {
+	sess := &session{
+		client:        http.Client{Timeout: 5 * time.Second, Transport: options.Transport},
+		robots:        newRobotsCache(),
+		canonicalizer: options.Canonicalizer,
+		checkExternal: options.CheckExternalLinks,
+		checkAssets:   options.CheckAssets,
+		hosts:         make(map[string]bool),
+		retries:       options.Retries,
+	}
+
+	for _, host := range options.Hosts {
+		sess.hosts[strings.ToLower(host)] = true
+	}
+
+	var sources []HttpSource
+	for _, u := range urls {
+		if parsed, err := url.Parse(u); err == nil && supportedProtocol(strings.ToLower(parsed.Scheme)) {
+			u = sess.canonicalize(parsed)
+		}
+
+		s, err := makeSource(u, errorHandler, sess)
+		if err != nil {
+			return nil, err
+		}
+		sess.hosts[s.host] = true
+		sources = append(sources, s)
+	}
+
+	return sources, nil
+}
+
+// canonicalize normalizes a URL and applies the session's canonicalization
+// rules to it.
+func (sess *session) canonicalize(u *url.URL) string {
+	canonical := *u
+	normalize(&canonical)
+	if sess.canonicalizer != nil {
+		sess.canonicalizer.Canonicalize(&canonical)
+	}
+	return canonical.String()
+}
+
+func makeSource(u string, errorHandler func(errorUrl string, err error), sess *session) (HttpSource, error) {
 	var s HttpSource
 
 	parsed, err := url.Parse(u)
@@ -55,92 +189,440 @@ func MakeSource(u string, errorHandler func(errorUrl string, err error)) (HttpSo
 	s.protocol = strings.ToLower(parsed.Scheme)
 	s.path = parsed.Path
 	s.errorHandler = errorHandler
+	s.session = sess
 	return s, nil
 }
 
+// NewSource makes a source for another URL that shares this source's options
+// and robots.txt cache.
+func (s *HttpSource) NewSource(u string) (HttpSource, error) {
+	return makeSource(u, s.errorHandler, s.session)
+}
+
+// NewExternalSource makes a source for a resource on another site, which
+// checks that it exists (without finding any links or assets).
+func (s *HttpSource) NewExternalSource(u string) (HttpSource, error) {
+	newSource, err := makeSource(u, s.errorHandler, s.session)
+	newSource.checkOnly = true
+	return newSource, err
+}
+
 func (s *HttpSource) GetUrl() string {
 	return s.url
 }
 
-func (s *HttpSource) GetOuts() (outs S.Outs) {
-	fmt.Fprintf(os.Stderr, "GET %v\n", s.url)
-	client := http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(s.url)
+func (s *HttpSource) GetOuts() S.Outs {
+	return s.GetOutsContext(context.Background())
+}
+
+// GetOutsContext is like GetOuts, but abandons the request if ctx is
+// cancelled. Errors caused by cancellation are not passed to the error
+// handler.
+func (s *HttpSource) GetOutsContext(ctx context.Context) (outs S.Outs) {
+	parsedUrl, err := url.Parse(s.url)
 	if err != nil {
 		s.errorHandler(s.url, err)
 		return
 	}
 
+	robots := s.session.robots.get(ctx, &s.session.client, parsedUrl)
+	if ctx.Err() != nil {
+		return
+	}
+	if !robots.rules.allowed(robotsPath(parsedUrl)) {
+		s.errorHandler(s.url, &RobotsDisallowedError{})
+		return
+	}
+
+	// The Crawl-delay is left to the caller (e.g. a polite_source), so that
+	// other hosts aren't held up while we wait.
+	defer func() {
+		if outs.Metadata != nil {
+			outs.Metadata.CrawlDelay = robots.rules.crawlDelay
+		}
+	}()
+
+	if s.checkOnly {
+		return s.check(ctx)
+	}
+
+	resp, metadata := s.request(ctx, "GET")
+	outs.Metadata = metadata
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	finalUrl := resp.Request.URL.String()
+
 	if resp.StatusCode != 200 {
-		s.errorHandler(s.url, &StatusCodeError{statusCode: resp.Status})
+		s.errorHandler(s.url, &StatusCodeError{statusCode: resp.Status, code: resp.StatusCode})
 		return outs
 	}
 
-	contentType := resp.Header["Content-Type"]
-	if len(contentType) > 0 && strings.HasPrefix(contentType[0], "text/html") {
-		// URL may have changed due to redirect. If we got redirected to a new
-		// domain, ignore it.
-		finalUrl := resp.Request.URL.String()
+	isHtml := strings.HasPrefix(outs.Metadata.ContentType, "text/html")
+	isCss := strings.HasPrefix(outs.Metadata.ContentType, "text/css")
+	if isHtml || isCss {
+		// If we got redirected to a new domain, ignore it.
 		parsed, err := url.Parse(finalUrl)
-		if err == nil && hostMatches(s.host, parsed.Host) {
-			outs = parseHtml(s, parsed.Path, resp.Body)
+		if err == nil && (hostMatches(s.host, parsed.Host) || s.inScope(strings.ToLower(parsed.Host))) {
+			body := &countingReader{reader: resp.Body}
+			var pageOuts S.Outs
+			if isHtml {
+				pageOuts, outs.Metadata.CanonicalUrl, outs.Metadata.Title = parseHtml(s, parsed, body)
+			} else {
+				pageOuts = parseCssDocument(s, parsed, body)
+			}
+			outs.Links = pageOuts.Links
+			outs.Assets = pageOuts.Assets
+			if outs.Metadata.ContentLength < 0 {
+				outs.Metadata.ContentLength = body.n
+			}
+		}
+	}
+
+	return outs
+}
+
+// check finds out whether a resource exists with a HEAD request, falling back
+// to a GET request if the server doesn't seem to support HEAD requests.
+// Checked resources have no links or assets, as we don't crawl other sites or
+// parse assets other than stylesheets.
+func (s *HttpSource) check(ctx context.Context) (outs S.Outs) {
+	resp, metadata := s.request(ctx, "HEAD")
+	if resp != nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 400 && resp.StatusCode != http.StatusTooManyRequests {
+			resp, metadata = s.request(ctx, "GET")
+			if resp != nil {
+				resp.Body.Close()
+			}
 		}
 	}
 
+	outs.Metadata = metadata
+	if resp != nil && resp.StatusCode >= 400 {
+		s.errorHandler(s.url, &StatusCodeError{statusCode: resp.Status, code: resp.StatusCode})
+	}
 	return outs
 }
 
-func parseHtml(s *HttpSource, newPath string, reader io.Reader) (outs S.Outs) {
+// request makes a request for the source's URL, retrying it according to the
+// session's retry policy, and describes the final response. If no response is
+// received, the response is nil, and so is the metadata if ctx was cancelled.
+// Otherwise, the caller must close the response's body.
+func (s *HttpSource) request(ctx context.Context, method string) (*http.Response, *S.Metadata) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url, nil)
+	if err != nil {
+		s.errorHandler(s.url, err)
+		return nil, nil
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	for attempts := 1; ; attempts++ {
+		resp, metadata, err := s.attempt(req)
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, nil
+		}
+		metadata.Attempts = attempts
+
+		var statusCode int
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+
+		var delay time.Duration
+		retry := isTransient(statusCode, err)
+		if retry {
+			delay, retry = s.session.retries.delay(attempts, metadata.RetryAfter)
+		}
+
+		if !retry {
+			if err != nil {
+				s.errorHandler(s.url, err)
+			}
+			return resp, metadata
+		}
+
+		problem := metadata.Error
+		if resp != nil {
+			problem = resp.Status
+			resp.Body.Close()
+		}
+		fmt.Fprintf(os.Stderr, "Retrying %v in %v (%v)\n", s.url, delay.Round(time.Millisecond), problem)
+
+		if sleep(ctx, delay) != nil {
+			return nil, nil
+		}
+	}
+}
+
+// attempt makes a single request and describes the response, or the error if
+// there was no response.
+func (s *HttpSource) attempt(req *http.Request) (*http.Response, *S.Metadata, error) {
+	fmt.Fprintf(os.Stderr, "%v %v\n", req.Method, s.url)
+
+	start := time.Now()
+	resp, err := s.session.client.Do(req)
+	if err != nil {
+		return nil, &S.Metadata{
+			ContentLength: -1,
+			ResponseTime:  time.Since(start),
+			Error:         err.Error(),
+		}, err
+	}
+
+	metadata := &S.Metadata{
+		StatusCode:    resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		ResponseTime:  time.Since(start),
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		metadata.LastModified = lastModified
+	}
+
+	// URL may have changed due to redirect.
+	if finalUrl := resp.Request.URL.String(); finalUrl != s.url {
+		metadata.RedirectUrl = finalUrl
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		metadata.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+
+	return resp, metadata, nil
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. It returns 0 if the value is missing or
+// invalid, or the date has passed.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// countingReader counts the bytes read from a reader, so that we can determine
+// the length of a response with no Content-Length header.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// parseHtml finds the links and assets in an HTML document at pageUrl, along
+// with the canonical URL given by its <link rel="canonical"> and its title, if
+// any. Relative URLs are resolved against the document's base URL, which is
+// given by its first <base> element with an href, if any.
+func parseHtml(s *HttpSource, pageUrl *url.URL, reader io.Reader) (outs S.Outs, canonicalUrl, title string) {
 	z := H.NewTokenizer(reader)
 
-	existingLinks := make(map[string]bool)
-	existingAssets := make(map[string]bool)
+	base := pageUrl
+	foundBase := false
+	foundTitle := false
+
+	// The <base> element applies to the whole document, so we can't resolve
+	// the URLs until we've seen all of it.
+	var urls []tagUrl
 
 	tokenize(z, func(tagName string, attributes map[string]string) {
-		url, ok := getUrlFromTagAttributes(attributes)
-		if !ok {
-			return
+		if href, ok := attributes["href"]; ok && tagName == "base" && !foundBase {
+			foundBase = true
+			if parsed, err := pageUrl.Parse(strings.TrimSpace(href)); err == nil && supportedProtocol(parsed.Scheme) {
+				base = parsed
+			}
 		}
 
-		normalizedUrl, ok := normalizeUrl(s.protocol, s.host, newPath, url)
+		if style := attributes["style"]; style != "" {
+			urls = append(urls, findCssReferences(style)...)
+		}
+
+		urls = append(urls, getUrlsFromTag(tagName, attributes)...)
+	}, func(tagName, text string) {
+		switch {
+		case tagName == "style":
+			urls = append(urls, findCssReferences(text)...)
+		case tagName == "title" && !foundTitle:
+			foundTitle = true
+			title = strings.Join(strings.Fields(text), " ")
+		}
+	})
+
+	var others []tagUrl
+	for _, tu := range urls {
+		if tu.kind != urlKindCanonical {
+			others = append(others, tu)
+		} else if canonicalUrl == "" {
+			if normalizedUrl, ok := s.normalizeUrl(base, tu.url); ok {
+				canonicalUrl = s.canonicalize(normalizedUrl)
+			}
+		}
+	}
+
+	return makeOuts(s, base, others), canonicalUrl, title
+}
+
+// makeOuts resolves the URLs found in a document against its base URL, and
+// makes links and assets of those that are on the hosts we're crawling. URLs
+// that are the same once canonicalized are combined, and the others are
+// recorded as aliases.
+func makeOuts(s *HttpSource, base *url.URL, urls []tagUrl) (outs S.Outs) {
+	linkIndexes := make(map[string]int)
+	assetIndexes := make(map[string]int)
+
+	for _, tu := range urls {
+		normalizedUrl, ok := s.normalizeUrl(base, tu.url)
 		if !ok {
-			return
+			if tu.kind == urlKindLink && s.session != nil && s.session.checkExternal {
+				addExternalLink(s, base, tu.url, &outs, linkIndexes)
+			}
+			continue
+		}
+
+		canonicalUrl := s.canonicalize(normalizedUrl)
+
+		if tu.kind == urlKindLink {
+			if i, ok := linkIndexes[canonicalUrl]; ok {
+				outs.Links[i].Aliases = addAlias(outs.Links[i].Aliases, canonicalUrl, normalizedUrl)
+				continue
+			}
+		} else if i, ok := assetIndexes[canonicalUrl]; ok {
+			outs.Assets[i].Aliases = addAlias(outs.Assets[i].Aliases, canonicalUrl, normalizedUrl)
+			continue
 		}
 
-		newSource, err := MakeSource(normalizedUrl, s.errorHandler)
+		newSource, err := s.NewSource(canonicalUrl)
 		if err != nil {
-			s.errorHandler(normalizedUrl, err)
-			return
+			s.errorHandler(canonicalUrl, err)
+			continue
 		}
 
-		if !existingLinks[normalizedUrl] && tagName == "a" {
-			existingLinks[normalizedUrl] = true
-			outs.Links = append(outs.Links, S.Link{Url: normalizedUrl, Source: &newSource})
-		} else if !existingAssets[normalizedUrl] {
-			existingAssets[normalizedUrl] = true
-			outs.Assets = append(outs.Assets, S.Asset{Url: normalizedUrl})
+		aliases := addAlias(nil, canonicalUrl, normalizedUrl)
+
+		switch tu.kind {
+		case urlKindLink:
+			linkIndexes[canonicalUrl] = len(outs.Links)
+			outs.Links = append(outs.Links, S.Link{Url: canonicalUrl, Source: &newSource, Aliases: aliases})
+		case urlKindStylesheet:
+			// Stylesheets are loaded to find the assets that they refer to.
+			assetIndexes[canonicalUrl] = len(outs.Assets)
+			outs.Assets = append(outs.Assets, S.Asset{Url: canonicalUrl, Source: &newSource, Aliases: aliases})
+		default:
+			asset := S.Asset{Url: canonicalUrl, Aliases: aliases}
+			if s.session != nil && s.session.checkAssets {
+				newSource.checkOnly = true
+				asset.Source = &newSource
+			}
+			assetIndexes[canonicalUrl] = len(outs.Assets)
+			outs.Assets = append(outs.Assets, asset)
 		}
-	})
+	}
 
 	return outs
 }
 
-func tokenize(z *H.Tokenizer, f func(tagName string, attributes map[string]string)) {
+// addExternalLink adds a link to another site to outs, unless it's already
+// there. External URLs are normalized, but the site's canonicalization rules
+// don't apply to them.
+func addExternalLink(s *HttpSource, base *url.URL, ref string, outs *S.Outs, linkIndexes map[string]int) {
+	resolved, ok := resolveUrl(base, ref)
+	if !ok {
+		return
+	}
+
+	externalUrl := resolved.String()
+	if _, ok := linkIndexes[externalUrl]; ok {
+		return
+	}
+
+	newSource, err := s.NewExternalSource(externalUrl)
+	if err != nil {
+		s.errorHandler(externalUrl, err)
+		return
+	}
+
+	linkIndexes[externalUrl] = len(outs.Links)
+	outs.Links = append(outs.Links, S.Link{Url: externalUrl, Source: &newSource, External: true})
+}
+
+// canonicalize applies the session's canonicalization rules to a URL returned
+// by normalizeUrl.
+func (s *HttpSource) canonicalize(normalizedUrl string) string {
+	if s.session == nil || s.session.canonicalizer == nil {
+		return normalizedUrl
+	}
+
+	parsed, err := url.Parse(normalizedUrl)
+	if err != nil {
+		return normalizedUrl
+	}
+	return s.session.canonicalize(parsed)
+}
+
+// addAlias adds alias to a list of aliases for canonicalUrl, unless it is the
+// same as canonicalUrl or is already in the list.
+func addAlias(aliases []string, canonicalUrl, alias string) []string {
+	if alias == canonicalUrl {
+		return aliases
+	}
+	for _, a := range aliases {
+		if a == alias {
+			return aliases
+		}
+	}
+	return append(aliases, alias)
+}
+
+// tokenize calls f with the name and attributes of each tag, and
+// text with the name and contents of each <style> and <title> element.
+func tokenize(z *H.Tokenizer, f func(tagName string, attributes map[string]string), text func(tagName, text string)) {
+	textTag := ""
+
 	for {
 		tt := z.Next()
 		if tt == H.ErrorToken && z.Err() == io.EOF {
 			break
 		}
 
+		if tt == H.TextToken && textTag != "" {
+			text(textTag, string(z.Text()))
+		}
+
 		tagNameBytes, _ := z.TagName()
 		tagName := string(tagNameBytes)
+		textTag = ""
+		if tt == H.StartTagToken && (tagName == "style" || tagName == "title") {
+			textTag = tagName
+		}
 
 		attributes := make(map[string]string)
 		for {
 			nameBytes, valBytes, more := z.TagAttr()
 			nameString := string(nameBytes)
 
-			if nameString == "href" || nameString == "src" {
+			// If an attribute is repeated, the first value is used.
+			if _, ok := attributes[nameString]; !ok {
 				attributes[nameString] = string(valBytes)
 			}
 
@@ -153,41 +635,64 @@ func tokenize(z *H.Tokenizer, f func(tagName string, attributes map[string]strin
 	}
 }
 
-func getUrlFromTagAttributes(attributes map[string]string) (string, bool) {
-	if href := attributes["href"]; href != "" {
-		return href, true
-	}
-	if src := attributes["src"]; src != "" {
-		return src, true
+// normalizeUrl resolves a reference to a URL (which may be relative) against a
+// base URL, following RFC 3986, normalizes it and removes its fragment. If the
+// result isn't an HTTP(S) URL on the given host, ok is false.
+func normalizeUrl(host string, base *url.URL, ref string) (normalized string, ok bool) {
+	resolved, ok := resolveUrl(base, ref)
+	if !ok || resolved.Host != host {
+		return "", false
 	}
-	return "", false
+
+	return resolved.String(), true
 }
 
-func normalizeUrl(protocol, host, basePath, httpUrl string) (string, bool) {
-	parsed, err := url.Parse(httpUrl)
-	if err != nil {
+// normalizeUrl is like the normalizeUrl function, but allows URLs on any of
+// the hosts that the crawl covers.
+func (s *HttpSource) normalizeUrl(base *url.URL, ref string) (normalized string, ok bool) {
+	resolved, ok := resolveUrl(base, ref)
+	if !ok || !s.inScope(resolved.Host) {
 		return "", false
 	}
 
-	if parsed.Scheme != "" && !supportedProtocol(parsed.Scheme) {
-		return "", false
+	return resolved.String(), true
+}
+
+// inScope determines whether the pages on a host (which must be normalized)
+// are crawled.
+func (s *HttpSource) inScope(host string) bool {
+	return host == s.host || s.session != nil && s.session.hosts[host]
+}
+
+// InScope determines whether a URL is on one of the hosts that the crawl
+// covers, rather than on another site.
+func (s *HttpSource) InScope(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
 	}
+	normalize(parsed)
+	return s.inScope(parsed.Host)
+}
 
-	if parsed.IsAbs() && strings.ToLower(parsed.Host) != host {
-		return "", false
+// resolveUrl is like normalizeUrl, but allows URLs on any host.
+func resolveUrl(base *url.URL, ref string) (*url.URL, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, false
 	}
 
-	if !parsed.IsAbs() {
-		parsed.Scheme = protocol
-		parsed.Host = host
-		if len(parsed.Path) > 0 && parsed.Path[0] != '/' {
-			parsed.Path = path.Join(path.Dir(basePath), parsed.Path)
-		}
+	resolved := base.ResolveReference(parsed)
+	normalize(resolved)
+
+	if !supportedProtocol(resolved.Scheme) || resolved.Host == "" {
+		return nil, false
 	}
 
-	parsed.Fragment = ""
+	resolved.Fragment = ""
+	resolved.RawFragment = ""
 
-	return parsed.String(), true
+	return resolved, true
 }
 
 func supportedProtocol(protocol string) bool {
@@ -1,8 +1,15 @@
 package http_source
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
+
+	HC "multiverse.io/crawler/crawler/http_cache"
 )
 
 func TestParseHtml(t *testing.T) {
@@ -15,14 +22,14 @@ func TestParseHtml(t *testing.T) {
 	<img src="http://otherdomain.com/foo.jpeg">
 	`
 
-	outs := parseHtml(
+	outs, _, _ := parseHtml(
 		&HttpSource{
 			url:          "http://foo.com",
 			host:         "foo.com",
 			protocol:     "http",
 			errorHandler: func(httpUrl string, err error) { panic("Not expecting error") },
 		},
-		"/",
+		mustParseUrl("http://foo.com/"),
 		strings.NewReader(input),
 	)
 
@@ -50,14 +57,14 @@ func TestParseHtmlErrorHandling(t *testing.T) {
 	<img src="http://otherdomain.com/foo.jpeg">
 	`
 
-	outs := parseHtml(
+	outs, _, _ := parseHtml(
 		&HttpSource{
 			url:          "http://foo.com",
 			host:         "foo.com",
 			protocol:     "http",
 			errorHandler: func(httpUrl string, err error) { panic("Not expecting error") },
 		},
-		"/",
+		mustParseUrl("http://foo.com/"),
 		strings.NewReader(input),
 	)
 
@@ -72,34 +79,254 @@ func TestParseHtmlErrorHandling(t *testing.T) {
 	t.Logf("%+v", outs)
 }
 
+func TestGetOutsMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.WriteHeader(404)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, `<a href="/missing">Missing</a>`)
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Last-Modified", "Wed, 01 Jan 2020 12:00:00 GMT")
+			w.Header().Set("Content-Length", "3")
+			fmt.Fprintf(w, "PDF")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	errors := make(map[string]error)
+	errorHandler := func(errorUrl string, err error) { errors[errorUrl] = err }
+
+	type test struct {
+		path                  string
+		expectedStatusCode    int
+		expectedContentType   string
+		expectedContentLength int64
+		expectedRedirectUrl   string
+	}
+
+	tests := []test{
+		{"/old", 200, "text/html; charset=utf-8", 30, server.URL + "/new"},
+		{"/doc.pdf", 200, "application/pdf", 3, ""},
+		{"/missing", 404, "", 0, ""},
+	}
+
+	for _, tst := range tests {
+		source, err := MakeSource(server.URL+tst.path, errorHandler)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		md := source.GetOuts().Metadata
+		if md == nil {
+			t.Errorf("No metadata for %v\n", tst.path)
+			continue
+		}
+
+		if md.StatusCode != tst.expectedStatusCode || md.ContentType != tst.expectedContentType || md.ContentLength != tst.expectedContentLength || md.RedirectUrl != tst.expectedRedirectUrl || md.Error != "" {
+			t.Errorf("Unexpected metadata for %v: %+v\n", tst.path, md)
+		}
+	}
+
+	source, _ := MakeSource(server.URL+"/doc.pdf", errorHandler)
+	if md := source.GetOuts().Metadata; !md.LastModified.Equal(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected Last-Modified time %v\n", md.LastModified)
+	}
+
+	if _, ok := errors[server.URL+"/missing"].(*StatusCodeError); !ok || len(errors) != 1 {
+		t.Errorf("Unexpected errors: %v\n", errors)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type test struct {
+		value         string
+		expectedDelay time.Duration
+	}
+
+	tests := []test{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"-5", 0},
+		{"soon", 0},
+		{"Wed, 01 Jan 2020 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 Jan 2020 11:00:00 GMT", 0},
+	}
+
+	for _, tst := range tests {
+		delay := parseRetryAfter(tst.value, now)
+		if delay != tst.expectedDelay {
+			t.Errorf("Expected Retry-After '%v' to give %v; got %v\n", tst.value, tst.expectedDelay, delay)
+		}
+	}
+}
+
+func mustParseUrl(s string) *url.URL {
+	parsed, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
 func TestNormalizeUrl(t *testing.T) {
 	type test struct {
-		protocol            string
-		host                string
-		basePath            string
-		url                 string
+		base                string
+		ref                 string
 		expectedUrl         string
 		expectedShouldCrawl bool
 	}
 
 	tests := []test{
-		{"http", "foo.com", "", "index.html", "http://foo.com/index.html", true},
-		{"http", "foo.com", "", "/bar", "http://foo.com/bar", true},
-		{"http", "foo.com", "/", "index.html", "http://foo.com/index.html", true},
-		{"http", "foo.com", "/", "/bar", "http://foo.com/bar", true},
-		{"http", "foo.com", "/", "https://foo.com/amp", "https://foo.com/amp", true},
-		{"http", "foo.com", "/", "https://anotherdomain.com/amp", "", false},
-		{"http", "foo.com", "/", "ftp://foo.com/amp", "", false},
+		{"http://foo.com", "index.html", "http://foo.com/index.html", true},
+		{"http://foo.com", "/bar", "http://foo.com/bar", true},
+		{"http://foo.com/", "index.html", "http://foo.com/index.html", true},
+		{"http://foo.com/", "/bar", "http://foo.com/bar", true},
+		{"http://foo.com/", "https://foo.com/amp", "https://foo.com/amp", true},
+		{"http://foo.com/", "https://anotherdomain.com/amp", "", false},
+		{"http://foo.com/", "ftp://foo.com/amp", "", false},
+		{"http://foo.com/", "mailto:someone@foo.com", "", false},
+		{"http://foo.com/", "javascript:void(0)", "", false},
+
+		// Relative paths are resolved against the directory of the base.
+		{"http://foo.com/a/b/c", "d", "http://foo.com/a/b/d", true},
+		{"http://foo.com/a/b/c/", "d", "http://foo.com/a/b/c/d", true},
+		{"http://foo.com/a/b/c", "d/", "http://foo.com/a/b/d/", true},
+		{"http://foo.com/a/b/c", "./d", "http://foo.com/a/b/d", true},
+		{"http://foo.com/a/b/c", ".", "http://foo.com/a/b/", true},
+		{"http://foo.com/a/b/c", "./", "http://foo.com/a/b/", true},
+
+		// Dot segments.
+		{"http://foo.com/a/b/c", "..", "http://foo.com/a/", true},
+		{"http://foo.com/a/b/c", "../", "http://foo.com/a/", true},
+		{"http://foo.com/a/b/c", "../d", "http://foo.com/a/d", true},
+		{"http://foo.com/a/b/c", "../../d", "http://foo.com/d", true},
+		{"http://foo.com/a/b/c", "../../../d", "http://foo.com/d", true},
+		{"http://foo.com/a/b/c", "/./d", "http://foo.com/d", true},
+		{"http://foo.com/a/b/c", "/x/../d", "http://foo.com/d", true},
+		{"http://foo.com/a/b/c", "d/./e/../f", "http://foo.com/a/b/d/f", true},
+		{"http://foo.com/a/b/c", "http://foo.com/x/./y/../z", "http://foo.com/x/z", true},
+
+		// Query-only references keep the path of the base.
+		{"http://foo.com/a/b?x=1", "?page=2", "http://foo.com/a/b?page=2", true},
+		{"http://foo.com/a/b/", "?page=2", "http://foo.com/a/b/?page=2", true},
+		{"http://foo.com/a/b?x=1", "c?page=2", "http://foo.com/a/c?page=2", true},
+
+		// Protocol-relative references take the scheme of the base.
+		{"https://foo.com/a/b", "//foo.com/c", "https://foo.com/c", true},
+		{"http://foo.com/a/b", "//foo.com", "http://foo.com/", true},
+		{"http://foo.com/a/b", "//anotherdomain.com/c", "", false},
+
+		// Empty and fragment-only references are the base itself.
+		{"http://foo.com/a/b?x=1", "", "http://foo.com/a/b?x=1", true},
+		{"http://foo.com/a/b?x=1", "  ", "http://foo.com/a/b?x=1", true},
+		{"http://foo.com/a/b?x=1", "#top", "http://foo.com/a/b?x=1", true},
+		{"http://foo.com/a/b#section", "", "http://foo.com/a/b", true},
+		{"http://foo.com/a/b", "c#section", "http://foo.com/a/c", true},
+
+		{"http://foo.com/a/b", " c ", "http://foo.com/a/c", true},
+
+		// Normalization that doesn't change the resource.
+		{"http://foo.com/", "HTTP://FOO.COM/C", "http://foo.com/C", true},
+		{"http://foo.com/", "http://foo.com:80/c", "http://foo.com/c", true},
+		{"http://foo.com/", "https://foo.com:443/c", "https://foo.com/c", true},
+		{"http://foo.com/", "http://foo.com:8080/c", "", false},
+		{"http://foo.com/", "/%7euser/a%2fb%3F?q=%7e%2f", "http://foo.com/~user/a%2Fb%3F?q=~%2F", true},
 	}
 
 	for _, tst := range tests {
-		normalized, shouldCrawl := normalizeUrl(tst.protocol, tst.host, tst.basePath, tst.url)
+		normalized, shouldCrawl := normalizeUrl("foo.com", mustParseUrl(tst.base), tst.ref)
 		if shouldCrawl != tst.expectedShouldCrawl {
-			t.Errorf("Expected (%v, %v, %v, %v) to have shouldCrawl=%v; got %v", tst.protocol, tst.host, tst.basePath, tst.url, tst.expectedShouldCrawl, shouldCrawl)
-
+			t.Errorf("Expected '%v' relative to %v to have shouldCrawl=%v; got %v\n", tst.ref, tst.base, tst.expectedShouldCrawl, shouldCrawl)
 		}
 		if normalized != tst.expectedUrl {
-			t.Errorf("Expected (%v, %v, %v, %v) to normalized to %v; got %v", tst.protocol, tst.host, tst.basePath, tst.url, tst.expectedUrl, normalized)
+			t.Errorf("Expected '%v' relative to %v to normalize to %v; got %v\n", tst.ref, tst.base, tst.expectedUrl, normalized)
+		}
+	}
+}
+
+func TestParseHtmlBase(t *testing.T) {
+	type test struct {
+		base          string
+		expectedLinks string
+	}
+
+	tests := []test{
+		{``, "http://foo.com/dir/page.html http://foo.com/root http://foo.com/dir/index.html?page=2"},
+		{`<base href="/other/">`, "http://foo.com/other/page.html http://foo.com/root http://foo.com/other/?page=2"},
+		{`<base href="sub/index.html">`, "http://foo.com/dir/sub/page.html http://foo.com/root http://foo.com/dir/sub/index.html?page=2"},
+		{`<base href="https://foo.com/x/">`, "https://foo.com/x/page.html https://foo.com/root https://foo.com/x/?page=2"},
+		// Links to another host aren't crawled.
+		{`<base href="http://otherdomain.com/">`, ""},
+		// Only the first <base> with an href counts.
+		{`<base target="_blank"><base href="/first/"><base href="/second/">`, "http://foo.com/first/page.html http://foo.com/root http://foo.com/first/?page=2"},
+		// A <base> that isn't HTTP(S) is ignored.
+		{`<base href="javascript:void(0)">`, "http://foo.com/dir/page.html http://foo.com/root http://foo.com/dir/index.html?page=2"},
+	}
+
+	for _, tst := range tests {
+		// The <base> applies to URLs that come before it too.
+		input := `<a href="page.html">Page</a>` + tst.base + `<a href="/root">Root</a><a href="?page=2">Next</a>`
+
+		outs, _, _ := parseHtml(
+			&HttpSource{
+				url:          "http://foo.com",
+				host:         "foo.com",
+				protocol:     "http",
+				errorHandler: func(httpUrl string, err error) { panic("Not expecting error") },
+			},
+			mustParseUrl("http://foo.com/dir/index.html"),
+			strings.NewReader(input),
+		)
+
+		var links []string
+		for _, l := range outs.Links {
+			links = append(links, l.Url)
+		}
+		if strings.Join(links, " ") != tst.expectedLinks {
+			t.Errorf("Expected links '%v' with %v; got %v\n", tst.expectedLinks, tst.base, links)
+		}
+	}
+}
+
+func TestParseHtmlTitle(t *testing.T) {
+	type test struct {
+		input         string
+		expectedTitle string
+	}
+
+	tests := []test{
+		{`<html><head><title>Home</title></head></html>`, "Home"},
+		{`<title>
+		  Fish &amp; Chips <b>not bold</b>
+		</title><style>a { color: red }</style>`, "Fish & Chips <b>not bold</b>"},
+		{`<title>First</title><svg><title>Second</title></svg>`, "First"},
+		{`<h1>No title</h1>`, ""},
+	}
+
+	for _, tst := range tests {
+		_, _, title := parseHtml(
+			&HttpSource{
+				url:          "http://foo.com",
+				host:         "foo.com",
+				protocol:     "http",
+				errorHandler: func(httpUrl string, err error) { panic("Not expecting error") },
+			},
+			mustParseUrl("http://foo.com/"),
+			strings.NewReader(tst.input),
+		)
+
+		if title != tst.expectedTitle {
+			t.Errorf("Expected title %q for %v; got %q\n", tst.expectedTitle, tst.input, title)
 		}
 	}
 }
@@ -128,3 +355,278 @@ func TestHostMatches(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckExternalLinks(t *testing.T) {
+	var requests []string
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(404)
+			return
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.URL.Path == "/ok":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/never-crawled">Link</a>`)
+		case r.URL.Path == "/nohead" && r.Method == "HEAD":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/nohead":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer external.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `
+		<a href="/internal">Internal</a>
+		<a href="%[1]v/ok#top">OK</a>
+		<a href="%[1]v/ok">OK again</a>
+		<a href="%[1]v/nohead">No HEAD</a>
+		<a href="%[1]v/missing">Missing</a>
+		<a href="mailto:someone@foo.com">Mail</a>
+		<img src="%[1]v/image.png">
+		`, external.URL)
+	}))
+	defer server.Close()
+
+	errors := make(map[string]error)
+	errorHandler := func(errorUrl string, err error) { errors[errorUrl] = err }
+
+	for _, check := range []bool{false, true} {
+		source, err := MakeSourceWithOptions(server.URL+"/", errorHandler, Options{CheckExternalLinks: check})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		outs := source.GetOuts()
+
+		if len(outs.Assets) != 0 {
+			t.Errorf("Expected external assets to be ignored; got %+v\n", outs.Assets)
+		}
+
+		var links []string
+		for _, l := range outs.Links {
+			links = append(links, fmt.Sprintf("%v:%v", strings.Replace(l.Url, external.URL, "external", 1), l.External))
+		}
+		expectedLinks := server.URL + "/internal:false"
+		if check {
+			expectedLinks += " external/ok:true external/nohead:true external/missing:true"
+		}
+		if strings.Join(links, " ") != expectedLinks {
+			t.Errorf("Unexpected links %v\n", links)
+		}
+	}
+
+	source, _ := MakeSourceWithOptions(server.URL+"/", errorHandler, Options{CheckExternalLinks: true})
+	links := source.GetOuts().Links
+
+	type test struct {
+		statusCode       int
+		expectedRequests string
+	}
+
+	tests := []test{
+		{200, "HEAD /ok"},
+		{200, "HEAD /nohead GET /nohead"},
+		{404, "HEAD /missing GET /missing"},
+	}
+
+	for i, tst := range tests {
+		requests = nil
+		outs := links[i+1].Source.GetOuts()
+
+		if outs.Metadata == nil || outs.Metadata.StatusCode != tst.statusCode || len(outs.Links) != 0 || len(outs.Assets) != 0 {
+			t.Errorf("Unexpected outs for %v: %+v\n", links[i+1].Url, outs)
+		}
+		if strings.Join(requests, " ") != tst.expectedRequests {
+			t.Errorf("Unexpected requests for %v: %v\n", links[i+1].Url, requests)
+		}
+	}
+
+	if _, ok := errors[external.URL+"/missing"].(*StatusCodeError); !ok {
+		t.Errorf("Expected a status code error for the missing external link\n")
+	}
+}
+
+func TestCheckAssets(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(404)
+			return
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `
+			<link rel="stylesheet" href="/style.css">
+			<img src="/image.png">
+			<script src="/missing.js"></script>
+			`)
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	errors := make(map[string]error)
+	errorHandler := func(errorUrl string, err error) { errors[errorUrl] = err }
+
+	for _, check := range []bool{false, true} {
+		source, err := MakeSourceWithOptions(server.URL+"/", errorHandler, Options{CheckAssets: check})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		var assets []string
+		for _, a := range source.GetOuts().Assets {
+			assets = append(assets, fmt.Sprintf("%v:%v", strings.TrimPrefix(a.Url, server.URL), a.Source != nil))
+		}
+		expectedAssets := fmt.Sprintf("/style.css:true /image.png:%[1]v /missing.js:%[1]v", check)
+		if strings.Join(assets, " ") != expectedAssets {
+			t.Errorf("Unexpected assets %v\n", assets)
+		}
+	}
+
+	source, _ := MakeSourceWithOptions(server.URL+"/", errorHandler, Options{CheckAssets: true})
+	assets := source.GetOuts().Assets
+
+	type test struct {
+		statusCode       int
+		expectedRequests string
+	}
+
+	tests := []test{
+		{200, "HEAD /image.png"},
+		{404, "HEAD /missing.js GET /missing.js"},
+	}
+
+	for i, tst := range tests {
+		requests = nil
+		outs := assets[i+1].Source.GetOuts()
+
+		if outs.Metadata == nil || outs.Metadata.StatusCode != tst.statusCode || len(outs.Links) != 0 || len(outs.Assets) != 0 {
+			t.Errorf("Unexpected outs for %v: %+v\n", assets[i+1].Url, outs)
+		}
+		if strings.Join(requests, " ") != tst.expectedRequests {
+			t.Errorf("Unexpected requests for %v: %v\n", assets[i+1].Url, requests)
+		}
+	}
+
+	if _, ok := errors[server.URL+"/missing.js"].(*StatusCodeError); !ok {
+		t.Errorf("Expected a status code error for the missing script\n")
+	}
+}
+
+func TestCheckAssetsOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<img src="/image.png"><img src="/uncached.png">`)
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	// Cache everything but /uncached.png.
+	dir := t.TempDir()
+	client := &http.Client{Transport: &HC.Transport{Dir: dir}}
+	for _, path := range []string{"/robots.txt", "/", "/image.png"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		resp.Body.Close()
+	}
+
+	errors := make(map[string]error)
+	source, err := MakeSourceWithOptions(server.URL+"/", func(errorUrl string, err error) {
+		errors[errorUrl] = err
+	}, Options{Transport: &HC.Transport{Dir: dir, Offline: true}, CheckAssets: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	assets := source.GetOuts().Assets
+	if len(assets) != 2 {
+		t.Fatalf("Unexpected assets %+v\n", assets)
+	}
+
+	// The cached image is checked with the cached response to its GET request.
+	outs := assets[0].Source.GetOuts()
+	if outs.Metadata == nil || outs.Metadata.StatusCode != 200 || outs.Metadata.IsBroken() || errors[assets[0].Url] != nil {
+		t.Errorf("Expected the cached image to be found; got %+v (error %v)\n", outs.Metadata, errors[assets[0].Url])
+	}
+
+	outs = assets[1].Source.GetOuts()
+	if outs.Metadata == nil || !outs.Metadata.IsBroken() {
+		t.Errorf("Expected the uncached image to fail; got %+v\n", outs.Metadata)
+	}
+}
+
+func TestMakeSources(t *testing.T) {
+	var servers [3]*httptest.Server
+	for i := range servers {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.WriteHeader(404)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `
+			<a href="/page">Page</a>
+			<a href="%v/other">Other seed</a>
+			<a href="%v/third">Third</a>
+			`, servers[1].URL, servers[2].URL)
+		}))
+		defer servers[i].Close()
+	}
+
+	errorHandler := func(errorUrl string, err error) {}
+
+	for _, hosts := range [][]string{nil, {strings.TrimPrefix(strings.ToUpper(servers[2].URL), "HTTP://")}} {
+		sources, err := MakeSources([]string{servers[0].URL, servers[1].URL + "/"}, errorHandler, Options{Hosts: hosts})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		if len(sources) != 2 || sources[0].GetUrl() != servers[0].URL+"/" || sources[1].GetUrl() != servers[1].URL+"/" {
+			t.Fatalf("Unexpected sources %+v\n", sources)
+		}
+
+		// The links to the other seed's host are followed from both seeds, and
+		// the links to the third host only if it's listed.
+		for _, source := range sources {
+			var links []string
+			for _, l := range source.GetOuts().Links {
+				links = append(links, l.Url)
+			}
+
+			expected := []string{source.GetUrl() + "page", servers[1].URL + "/other"}
+			if hosts != nil {
+				expected = append(expected, servers[2].URL+"/third")
+			}
+			if strings.Join(links, " ") != strings.Join(expected, " ") {
+				t.Errorf("Unexpected links from %v: %v\n", source.GetUrl(), links)
+			}
+		}
+
+		if !sources[0].InScope(servers[1].URL+"/a") || sources[0].InScope(servers[2].URL+"/a") != (hosts != nil) {
+			t.Errorf("Unexpected scope for hosts %v\n", hosts)
+		}
+	}
+}
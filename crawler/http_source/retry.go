@@ -0,0 +1,100 @@
+package http_source
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how requests that fail in ways that are likely to be
+// temporary (timeouts, reset connections, and 429, 502, 503 and 504 responses)
+// are retried. The zero value never retries.
+type RetryPolicy struct {
+	// The maximum number of times to retry a request.
+	MaxRetries int
+
+	// How long to wait before the first retry. Each retry after that waits
+	// twice as long as the one before. The actual wait is randomly between
+	// half of this and all of it, so that requests that failed together
+	// aren't retried together.
+	InitialBackoff time.Duration
+
+	// The longest to wait before a retry. If the server asks us to wait
+	// longer than this with a Retry-After header, we give up instead. 0 means
+	// no limit.
+	MaxBackoff time.Duration
+}
+
+// delay determines how long to wait before retrying a request that has been
+// attempted the given number of times, or returns false if it shouldn't be
+// retried. retryAfter is the wait that the server asked for, if any.
+func (p *RetryPolicy) delay(attempts int, retryAfter time.Duration) (time.Duration, bool) {
+	if attempts > p.MaxRetries {
+		return 0, false
+	}
+
+	backoff := p.InitialBackoff
+	for i := 1; i < attempts && (p.MaxBackoff == 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff > 0 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	if retryAfter > 0 {
+		if p.MaxBackoff > 0 && retryAfter > p.MaxBackoff {
+			return 0, false
+		}
+		if retryAfter > backoff {
+			backoff = retryAfter
+		}
+	}
+
+	return backoff, true
+}
+
+// isTransient determines whether a request that got a response with the given
+// status code (if err is nil) or failed with err might succeed if it were
+// retried.
+func isTransient(statusCode int, err error) bool {
+	if err == nil {
+		switch statusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// The server closed the connection without responding.
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sleep waits for d, or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
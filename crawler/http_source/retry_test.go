@@ -0,0 +1,177 @@
+package http_source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	type test struct {
+		attempts   int
+		retryAfter time.Duration
+		min, max   time.Duration
+		ok         bool
+	}
+
+	tests := []test{
+		{1, 0, 50 * time.Millisecond, 100 * time.Millisecond, true},
+		{2, 0, 100 * time.Millisecond, 200 * time.Millisecond, true},
+		{3, 0, 200 * time.Millisecond, 400 * time.Millisecond, true},
+		{5, 0, 500 * time.Millisecond, time.Second, true},
+		{6, 0, 0, 0, false},
+
+		// Retry-After is honored if it's longer than the backoff, and we give
+		// up if it's longer than MaxBackoff.
+		{1, 800 * time.Millisecond, 800 * time.Millisecond, 800 * time.Millisecond, true},
+		{3, 10 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, true},
+		{1, 2 * time.Second, 0, 0, false},
+	}
+
+	for _, tst := range tests {
+		for i := 0; i < 20; i++ {
+			delay, ok := p.delay(tst.attempts, tst.retryAfter)
+			if ok != tst.ok || ok && (delay < tst.min || delay > tst.max) {
+				t.Errorf("Unexpected delay %v, %v after %v attempts with Retry-After %v\n", delay, ok, tst.attempts, tst.retryAfter)
+				break
+			}
+		}
+	}
+
+	if _, ok := (&RetryPolicy{}).delay(1, 0); ok {
+		t.Errorf("Expected the zero policy not to retry\n")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, code := range []int{429, 502, 503, 504} {
+		if !isTransient(code, nil) {
+			t.Errorf("Expected status %v to be transient\n", code)
+		}
+	}
+	for _, code := range []int{200, 404, 500} {
+		if isTransient(code, nil) {
+			t.Errorf("Expected status %v not to be transient\n", code)
+		}
+	}
+	if isTransient(0, context.Canceled) || isTransient(0, fmt.Errorf("bad URL")) {
+		t.Errorf("Expected cancellation and other errors not to be transient\n")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(404)
+			return
+		}
+		requests = append(requests, r.URL.Path)
+
+		n := 0
+		for _, p := range requests {
+			if p == r.URL.Path {
+				n++
+			}
+		}
+
+		switch {
+		case r.URL.Path == "/flaky" && n == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/flaky" && n == 2:
+			// Close the connection without responding.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case r.URL.Path == "/flaky":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/page">Page</a>`)
+		case r.URL.Path == "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/later":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	type test struct {
+		path        string
+		statusCode  int
+		attempts    int
+		nLinks      int
+		nErrors     int
+		retryPolicy RetryPolicy
+	}
+
+	policy := RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Minute}
+
+	tests := []test{
+		{"/flaky", 200, 3, 1, 0, policy},
+		{"/flaky", 502, 1, 0, 1, RetryPolicy{}},
+		{"/flaky", 0, 2, 0, 1, RetryPolicy{MaxRetries: 1, InitialBackoff: time.Millisecond}},
+		{"/down", 503, 3, 0, 1, policy},
+		{"/later", 503, 1, 0, 1, policy},
+		{"/missing", 404, 1, 0, 1, policy},
+	}
+
+	for _, tst := range tests {
+		requests = nil
+		var errors []error
+		errorHandler := func(errorUrl string, err error) { errors = append(errors, err) }
+
+		// (Without keep-alives, so that the client doesn't retry the request
+		// itself when the connection is closed.)
+		source, err := MakeSourceWithOptions(server.URL+tst.path, errorHandler, Options{
+			Transport: &http.Transport{DisableKeepAlives: true},
+			Retries:   tst.retryPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		outs := source.GetOuts()
+
+		if outs.Metadata == nil || outs.Metadata.StatusCode != tst.statusCode || outs.Metadata.Attempts != tst.attempts || len(outs.Links) != tst.nLinks {
+			t.Errorf("Unexpected outs for %v with %+v: %+v\n", tst.path, tst.retryPolicy, outs.Metadata)
+		}
+		if len(requests) != tst.attempts {
+			t.Errorf("Expected %v requests for %v; got %v\n", tst.attempts, tst.path, strings.Join(requests, " "))
+		}
+		if len(errors) != tst.nErrors {
+			t.Errorf("Expected %v errors for %v; got %v\n", tst.nErrors, tst.path, errors)
+		}
+	}
+}
+
+func TestRetriesCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	errorHandler := func(errorUrl string, err error) {
+		t.Errorf("Unexpected error for %v: %v\n", errorUrl, err)
+	}
+
+	source, _ := MakeSourceWithOptions(server.URL+"/", errorHandler, Options{Retries: RetryPolicy{MaxRetries: 5, InitialBackoff: time.Hour}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The wait before retrying is abandoned, as is the request.
+	if outs := source.GetOutsContext(ctx); outs.Metadata != nil {
+		t.Errorf("Expected no metadata when cancelled; got %+v\n", outs.Metadata)
+	}
+}
@@ -0,0 +1,294 @@
+package http_source
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The product token that we look for in the User-agent lines of robots.txt.
+const robotsAgent = "gocrawl"
+
+// RFC 9309 requires crawlers to parse at least the first 500 KiB of a
+// robots.txt file.
+const maxRobotsBytes = 500 * 1024
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRules is the set of rules from a robots.txt file that apply to us.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+
+	// The URLs in Sitemap lines, which apply to every user agent.
+	sitemaps []string
+}
+
+var allowAll = robotsRules{}
+var disallowAll = robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+
+// parseRobots parses a robots.txt file and returns the rules that apply to the
+// given user agent. If there are groups for the user agent, these are combined;
+// otherwise the groups for '*' are used.
+func parseRobots(reader io.Reader, agent string) robotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	var sitemaps []string
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(io.LimitReader(reader, maxRobotsBytes))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+
+		if key == "user-agent" {
+			if !lastWasAgent {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		}
+
+		lastWasAgent = false
+		if key == "sitemap" {
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "allow", "disallow":
+			// An empty Disallow line disallows nothing.
+			if value != "" {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	agent = strings.ToLower(agent)
+
+	result := robotsRules{sitemaps: sitemaps}
+	found := false
+	for _, wanted := range []string{agent, "*"} {
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if a == wanted {
+					found = true
+					result.rules = append(result.rules, g.rules...)
+					if g.crawlDelay > result.crawlDelay {
+						result.crawlDelay = g.crawlDelay
+					}
+					break
+				}
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	return result
+}
+
+// allowed determines whether a path (including any query string) may be
+// fetched. The longest matching pattern wins, and Allow wins a tie.
+func (r *robotsRules) allowed(p string) bool {
+	if p == "/robots.txt" {
+		return true
+	}
+
+	allow := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatches(rule.pattern, p) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			longest = len(rule.pattern)
+			allow = rule.allow
+		}
+	}
+
+	return allow
+}
+
+// robotsPatternMatches matches a path against a robots.txt path pattern, where
+// '*' matches any sequence of characters and a trailing '$' anchors the
+// pattern to the end of the path.
+func robotsPatternMatches(pattern, p string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(p, parts[0]) {
+		return false
+	}
+	p = p[len(parts[0]):]
+
+	if len(parts) == 1 {
+		return !anchored || p == ""
+	}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(p, part)
+		if i < 0 {
+			return false
+		}
+		p = p[i+len(part):]
+	}
+
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(p, last)
+	}
+	return strings.Contains(p, last)
+}
+
+type robotsEntry struct {
+	once  sync.Once
+	rules robotsRules
+
+	// When we last fetched a sitemap from the host (see wait).
+	mutex       sync.Mutex
+	lastRequest time.Time
+}
+
+// robotsCache fetches each host's robots.txt at most once per crawl.
+type robotsCache struct {
+	mutex   sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{entries: make(map[string]*robotsEntry)}
+}
+
+func (c *robotsCache) get(ctx context.Context, client *http.Client, u *url.URL) *robotsEntry {
+	key := strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host)
+
+	c.mutex.Lock()
+	entry := c.entries[key]
+	if entry == nil {
+		entry = &robotsEntry{}
+		c.entries[key] = entry
+	}
+	c.mutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.rules = fetchRobots(ctx, client, key+"/robots.txt")
+	})
+
+	return entry
+}
+
+func fetchRobots(ctx context.Context, client *http.Client, robotsUrl string) robotsRules {
+	fmt.Fprintf(os.Stderr, "GET %v\n", robotsUrl)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsUrl, nil)
+	if err != nil {
+		return disallowAll
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if isNotCached(err) {
+		// We're working offline, and never fetched it, so we can't tell
+		// whether the site has one.
+		fmt.Fprintf(os.Stderr, "%v isn't cached, so everything is allowed\n", robotsUrl)
+		return allowAll
+	}
+	if err != nil {
+		// The site is unreachable, so we must assume that everything is
+		// disallowed.
+		return disallowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(resp.Body, robotsAgent)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return allowAll
+	default:
+		return disallowAll
+	}
+}
+
+// wait blocks until the host's Crawl-delay (if any) has elapsed since the last
+// sitemap that we fetched from it, or until ctx is cancelled. Sitemaps are
+// fetched before the crawl starts, so nothing else is held up; the delay
+// between pages is left to whoever makes the requests (see
+// Metadata.CrawlDelay).
+func (e *robotsEntry) wait(ctx context.Context) error {
+	if e.rules.crawlDelay == 0 {
+		return nil
+	}
+
+	e.mutex.Lock()
+	now := time.Now()
+	next := e.lastRequest.Add(e.rules.crawlDelay)
+	if next.Before(now) {
+		next = now
+	}
+	e.lastRequest = next
+	e.mutex.Unlock()
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func robotsPath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return p
+}
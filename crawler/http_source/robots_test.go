@@ -0,0 +1,226 @@
+package http_source
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	HC "multiverse.io/crawler/crawler/http_cache"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+func TestRobotsPatternMatches(t *testing.T) {
+	type test struct {
+		pattern        string
+		path           string
+		expectedResult bool
+	}
+
+	tests := []test{
+		{"/", "/", true},
+		{"/", "/foo", true},
+		{"/foo", "/foo", true},
+		{"/foo", "/foobar", true},
+		{"/foo", "/bar/foo", false},
+		{"/foo$", "/foo", true},
+		{"/foo$", "/foobar", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/dir/index.php?x=1", true},
+		{"/*.php", "/index.html", false},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"/a*c$", "/abcabc", true},
+		{"*", "/anything", true},
+		{"/search?", "/search?q=1", true},
+		{"/search?", "/search", false},
+	}
+
+	for _, tst := range tests {
+		result := robotsPatternMatches(tst.pattern, tst.path)
+		if result != tst.expectedResult {
+			t.Errorf("Test if %v matches pattern %v; expected %v, got %v\n", tst.path, tst.pattern, tst.expectedResult, result)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	input := `
+	# A comment
+	User-agent: *
+	Disallow: /private
+	Allow: /private/public
+	Crawl-delay: 2
+
+	User-agent: SomeOtherBot
+	User-agent: GoCrawl # a comment
+	Disallow: /
+	Allow: /docs/
+	Allow: /$
+
+	Sitemap: http://foo.com/sitemap.xml
+	`
+
+	gocrawl := parseRobots(strings.NewReader(input), "GoCrawl")
+	if gocrawl.crawlDelay != 0 {
+		t.Errorf("Unexpected crawl delay for GoCrawl: %v\n", gocrawl.crawlDelay)
+	}
+
+	other := parseRobots(strings.NewReader(input), "AnotherBot")
+	if other.crawlDelay != 2*time.Second {
+		t.Errorf("Unexpected crawl delay for AnotherBot: %v\n", other.crawlDelay)
+	}
+
+	for _, rules := range []robotsRules{gocrawl, other} {
+		if len(rules.sitemaps) != 1 || rules.sitemaps[0] != "http://foo.com/sitemap.xml" {
+			t.Errorf("Unexpected sitemaps: %v\n", rules.sitemaps)
+		}
+	}
+
+	type test struct {
+		rules          robotsRules
+		path           string
+		expectedResult bool
+	}
+
+	tests := []test{
+		{gocrawl, "/", true},
+		{gocrawl, "/index.html", false},
+		{gocrawl, "/docs/", true},
+		{gocrawl, "/docs/page", true},
+		{gocrawl, "/private", false},
+		{gocrawl, "/robots.txt", true},
+		{other, "/", true},
+		{other, "/index.html", true},
+		{other, "/private", false},
+		{other, "/private/secret", false},
+		{other, "/private/public", true},
+		{other, "/private/publicity", true},
+	}
+
+	for _, tst := range tests {
+		result := tst.rules.allowed(tst.path)
+		if result != tst.expectedResult {
+			t.Errorf("Test if %v is allowed by %+v; expected %v, got %v\n", tst.path, tst.rules, tst.expectedResult, result)
+		}
+	}
+}
+
+func TestParseRobotsAllowWinsTie(t *testing.T) {
+	rules := parseRobots(strings.NewReader("User-agent: *\nDisallow: /page\nAllow: /page\n"), "GoCrawl")
+	if !rules.allowed("/page") {
+		t.Errorf("Expected Allow to win over Disallow for a pattern of equal length\n")
+	}
+}
+
+func TestGetOutsHonorsRobots(t *testing.T) {
+	robotsRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			robotsRequests++
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\n")
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/public">Public</a><a href="/private">Private</a>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+	}))
+	defer server.Close()
+
+	errors := make(map[string]error)
+	source, err := MakeSource(server.URL+"/", func(errorUrl string, err error) {
+		errors[errorUrl] = err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	outs := source.GetOuts()
+	if len(outs.Links) != 2 {
+		t.Fatalf("Unexpected number of links: %v\n", len(outs.Links))
+	}
+
+	for _, link := range outs.Links {
+		link.Source.GetOuts()
+	}
+
+	if robotsRequests != 1 {
+		t.Errorf("Expected robots.txt to be requested once; it was requested %v times\n", robotsRequests)
+	}
+
+	if _, ok := errors[server.URL+"/private"].(*RobotsDisallowedError); !ok {
+		t.Errorf("Expected RobotsDisallowedError for /private; got %v\n", errors[server.URL+"/private"])
+	}
+
+	if len(errors) != 1 {
+		t.Errorf("Unexpected errors: %v\n", errors)
+	}
+}
+
+func TestGetOutsReportsCrawlDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nCrawl-delay: 1\n")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/page">Page</a>`)
+	}))
+	defer server.Close()
+
+	source, err := MakeSource(server.URL+"/", func(errorUrl string, err error) {})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// The delay is left to the caller, rather than waited for.
+	start := time.Now()
+	outs := source.GetOuts()
+	pageOuts := outs.Links[0].Source.GetOuts()
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the Crawl-delay not to be waited for; took %v\n", elapsed)
+	}
+
+	for _, m := range []*S.Metadata{outs.Metadata, pageOuts.Metadata} {
+		if m == nil || m.CrawlDelay != time.Second {
+			t.Errorf("Expected a Crawl-delay of 1s; got %+v\n", m)
+		}
+	}
+}
+
+func TestRobotsNotCachedOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "max-age=3600")
+		fmt.Fprintf(w, `<a href="/page">Page</a>`)
+	}))
+	defer server.Close()
+
+	// Cache the page, but not robots.txt.
+	dir := t.TempDir()
+	client := &http.Client{Transport: &HC.Transport{Dir: dir}}
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	resp.Body.Close()
+
+	errors := make(map[string]error)
+	source, err := MakeSourceWithOptions(server.URL+"/", func(errorUrl string, err error) {
+		errors[errorUrl] = err
+	}, Options{Transport: &HC.Transport{Dir: dir, Offline: true}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	outs := source.GetOuts()
+	if len(outs.Links) != 1 || len(errors) != 0 {
+		t.Errorf("Expected the cached page to be loaded; got links %+v and errors %v\n", outs.Links, errors)
+	}
+}
@@ -0,0 +1,191 @@
+package http_source
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
+// The sitemaps protocol limits sitemaps to 50,000 URLs and 50 MiB
+// (uncompressed).
+const maxSitemapUrls = 50000
+const maxSitemapBytes = 50 * 1024 * 1024
+
+// Sitemap indexes may not list other indexes, but we allow a little nesting.
+const maxSitemapIndexDepth = 2
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapXml is either a <urlset> (listing pages) or a <sitemapindex>
+// (listing other sitemaps).
+type sitemapXml struct {
+	XMLName  xml.Name
+	Urls     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// GetSitemap finds the pages on this source's host that are listed in its
+// sitemaps. These are the sitemaps named in robots.txt, plus /sitemap.xml.
+// Sitemap indexes are followed, and sitemaps may be gzipped. Sitemaps that
+// can't be loaded are passed to the error handler, except for a missing
+// /sitemap.xml.
+func (s *HttpSource) GetSitemap(ctx context.Context) []S.Link {
+	parsedUrl, err := url.Parse(s.url)
+	if err != nil {
+		s.errorHandler(s.url, err)
+		return nil
+	}
+
+	robots := s.session.robots.get(ctx, &s.session.client, parsedUrl)
+
+	defaultSitemap := s.protocol + "://" + s.host + "/sitemap.xml"
+	sitemapUrls := append(append([]string{}, robots.rules.sitemaps...), defaultSitemap)
+
+	var links []S.Link
+	seenSitemaps := make(map[string]bool)
+	linkIndexes := make(map[string]int)
+
+	var load func(sitemapUrl string, depth int)
+	load = func(sitemapUrl string, depth int) {
+		if seenSitemaps[sitemapUrl] || ctx.Err() != nil {
+			return
+		}
+		seenSitemaps[sitemapUrl] = true
+
+		sitemap, err := s.fetchSitemap(ctx, robots, sitemapUrl)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if statusErr, ok := err.(*StatusCodeError); ok && sitemapUrl == defaultSitemap && statusErr.code == http.StatusNotFound {
+				return
+			}
+			s.errorHandler(sitemapUrl, err)
+			return
+		}
+
+		for _, loc := range sitemap.Sitemaps {
+			if depth < maxSitemapIndexDepth {
+				load(strings.TrimSpace(loc.Loc), depth+1)
+			}
+		}
+
+		base, _ := url.Parse(sitemapUrl)
+		for _, loc := range sitemap.Urls {
+			normalizedUrl, ok := normalizeUrl(s.host, base, loc.Loc)
+			if !ok {
+				continue
+			}
+
+			canonicalUrl := s.canonicalize(normalizedUrl)
+			if i, ok := linkIndexes[canonicalUrl]; ok {
+				links[i].Aliases = addAlias(links[i].Aliases, canonicalUrl, normalizedUrl)
+				continue
+			}
+
+			newSource, err := s.NewSource(canonicalUrl)
+			if err != nil {
+				s.errorHandler(canonicalUrl, err)
+				continue
+			}
+			linkIndexes[canonicalUrl] = len(links)
+			links = append(links, S.Link{Url: canonicalUrl, Source: &newSource, Aliases: addAlias(nil, canonicalUrl, normalizedUrl)})
+		}
+	}
+
+	for _, sitemapUrl := range sitemapUrls {
+		load(sitemapUrl, 0)
+	}
+
+	return links
+}
+
+func (s *HttpSource) fetchSitemap(ctx context.Context, robots *robotsEntry, sitemapUrl string) (*sitemapXml, error) {
+	parsed, err := url.Parse(sitemapUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supportedProtocol(parsed.Scheme) {
+		return nil, &BadProtocolError{protocol: parsed.Scheme}
+	}
+
+	// Sitemaps on other hosts are subject to their own robots.txt.
+	if !hostMatches(s.host, parsed.Host) {
+		robots = s.session.robots.get(ctx, &s.session.client, parsed)
+	}
+	if !robots.rules.allowed(robotsPath(parsed)) {
+		return nil, &RobotsDisallowedError{}
+	}
+	if err := robots.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "GET %v\n", sitemapUrl)
+	req, err := http.NewRequestWithContext(ctx, "GET", sitemapUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := s.session.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, &StatusCodeError{statusCode: resp.Status, code: resp.StatusCode}
+	}
+
+	return parseSitemap(resp.Body)
+}
+
+// parseSitemap parses a sitemap or sitemap index, which may be gzipped.
+func parseSitemap(reader io.Reader) (*sitemapXml, error) {
+	buffered := bufio.NewReader(reader)
+
+	// Gzipped sitemaps are often served without a Content-Encoding, so we
+	// check for the gzip magic number.
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	} else {
+		reader = buffered
+	}
+
+	var sitemap sitemapXml
+	if err := xml.NewDecoder(io.LimitReader(reader, maxSitemapBytes)).Decode(&sitemap); err != nil {
+		return nil, err
+	}
+
+	switch sitemap.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, fmt.Errorf("Not a sitemap: found <%v> element", sitemap.XMLName.Local)
+	}
+
+	if len(sitemap.Urls) > maxSitemapUrls {
+		sitemap.Urls = sitemap.Urls[:maxSitemapUrls]
+	}
+	if len(sitemap.Sitemaps) > maxSitemapUrls {
+		sitemap.Sitemaps = sitemap.Sitemaps[:maxSitemapUrls]
+	}
+
+	return &sitemap, nil
+}
@@ -0,0 +1,113 @@
+package http_source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testUrlset = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]v/a</loc><lastmod>2020-01-01</lastmod></url>
+  <url>
+    <loc>
+      %[1]v/b#section
+    </loc>
+  </url>
+  <url><loc>http://otherdomain.com/c</loc></url>
+</urlset>`
+
+func gzipString(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	urlset := fmt.Sprintf(testUrlset, "http://foo.com")
+
+	for _, input := range [][]byte{[]byte(urlset), gzipString(t, urlset)} {
+		sitemap, err := parseSitemap(bytes.NewReader(input))
+		if err != nil {
+			t.Errorf("Unexpected error: %v\n", err)
+			continue
+		}
+		if len(sitemap.Urls) != 3 || sitemap.Urls[0].Loc != "http://foo.com/a" || len(sitemap.Sitemaps) != 0 {
+			t.Errorf("Unexpected sitemap: %+v\n", sitemap)
+		}
+	}
+
+	index := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>http://foo.com/sitemap1.xml</loc></sitemap>
+	<sitemap><loc>http://foo.com/sitemap2.xml.gz</loc></sitemap>
+	</sitemapindex>`
+	sitemap, err := parseSitemap(strings.NewReader(index))
+	if err != nil || len(sitemap.Sitemaps) != 2 || sitemap.Sitemaps[1].Loc != "http://foo.com/sitemap2.xml.gz" || len(sitemap.Urls) != 0 {
+		t.Errorf("Unexpected sitemap index: %+v, %v\n", sitemap, err)
+	}
+
+	for _, input := range []string{"<html><body></body></html>", "not xml at all"} {
+		if _, err := parseSitemap(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected error for %v\n", input)
+		}
+	}
+}
+
+func TestGetSitemap(t *testing.T) {
+	var serverUrl string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\n\nSitemap: %v/maps/index.xml\n", serverUrl)
+		case "/maps/index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%[1]v/maps/1.xml.gz</loc></sitemap><sitemap><loc>%[1]v/maps/2.xml</loc></sitemap><sitemap><loc>%[1]v/private/3.xml</loc></sitemap></sitemapindex>`, serverUrl)
+		case "/maps/1.xml.gz":
+			w.Write(gzipString(t, fmt.Sprintf(testUrlset, serverUrl)))
+		case "/maps/2.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]v/a</loc></url><url><loc>%[1]v/d</loc></url></urlset>`, serverUrl)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	serverUrl = server.URL
+
+	errors := make(map[string]error)
+	source, err := MakeSource(server.URL+"/", func(errorUrl string, err error) {
+		errors[errorUrl] = err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	links := source.GetSitemap(context.Background())
+
+	var urls []string
+	for _, l := range links {
+		urls = append(urls, l.Url)
+		if l.Source.GetUrl() != l.Url {
+			t.Errorf("Source for %v has URL %v\n", l.Url, l.Source.GetUrl())
+		}
+	}
+
+	expected := []string{server.URL + "/a", server.URL + "/b", server.URL + "/d"}
+	if strings.Join(urls, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected sitemap %v; got %v\n", expected, urls)
+	}
+
+	// The missing /sitemap.xml isn't an error, but the disallowed sitemap is.
+	if _, ok := errors[server.URL+"/private/3.xml"].(*RobotsDisallowedError); !ok || len(errors) != 1 {
+		t.Errorf("Unexpected errors: %v\n", errors)
+	}
+}
@@ -1,10 +1,14 @@
 // Package limited_source wraps a Source with limits on the depth of traversal
 // from the origin and the total number of requests. If either is exceeded, the
 // Source 'lies' and says that the page in question has no assets and no links.
+// External links are never followed, so they are checked one level beyond the
+// depth limit, like the other links from the pages at that depth.
 package limited_source
 
 import (
+	"context"
 	"sync/atomic"
+	"time"
 
 	S "multiverse.io/crawler/crawler/source"
 )
@@ -15,6 +19,7 @@ type LimitedSource struct {
 	maxDepth         uint64
 	totalRequestsPtr *uint64
 	depth            uint64
+	external         bool
 }
 
 func (s *LimitedSource) GetUrl() string {
@@ -22,42 +27,100 @@ func (s *LimitedSource) GetUrl() string {
 }
 
 func (s *LimitedSource) GetOuts() S.Outs {
+	return s.GetOutsContext(context.Background())
+}
+
+func (s *LimitedSource) GetOutsContext(ctx context.Context) S.Outs {
 	// GetOuts() will be called from multiple threads, so we must use an atomic
 	// update for the request counter.
 	newTotalRequests := atomic.AddUint64(s.totalRequestsPtr, 1)
 
-	if s.depth > s.maxDepth || newTotalRequests > s.maxTotalRequests {
+	if s.tooDeep() || newTotalRequests > s.maxTotalRequests {
+		S.Release(s.source)
 		return S.Outs{}
 	}
 
-	origOuts := s.source.GetOuts()
+	origOuts := S.GetOutsContext(ctx, s.source)
 
 	newLinks := make([]S.Link, len(origOuts.Links))
 	for i, l := range origOuts.Links {
-		newLinks[i].Url = l.Url
+		newLinks[i] = l
 		newLinks[i].Source = &LimitedSource{
 			source:           l.Source,
 			maxTotalRequests: s.maxTotalRequests,
 			maxDepth:         s.maxDepth,
 			totalRequestsPtr: s.totalRequestsPtr,
 			depth:            s.depth + 1,
+			external:         l.External,
+		}
+	}
+
+	newAssets := make([]S.Asset, len(origOuts.Assets))
+	for i, a := range origOuts.Assets {
+		newAssets[i] = a
+		if a.Source != nil {
+			newAssets[i].Source = &LimitedSource{
+				source:           a.Source,
+				maxTotalRequests: s.maxTotalRequests,
+				maxDepth:         s.maxDepth,
+				totalRequestsPtr: s.totalRequestsPtr,
+				depth:            s.depth + 1,
+			}
 		}
 	}
 
 	return S.Outs{
-		Assets: origOuts.Assets,
-		Links:  newLinks,
+		Assets:   newAssets,
+		Links:    newLinks,
+		Metadata: origOuts.Metadata,
 	}
 }
 
+// Reserve reserves the right to load the wrapped source, unless it is too deep
+// to be loaded at all or the requests have run out, in which case it won't be
+// loaded and needn't wait.
+func (s *LimitedSource) Reserve() (bool, time.Time) {
+	if s.tooDeep() || atomic.LoadUint64(s.totalRequestsPtr) >= s.maxTotalRequests {
+		return true, time.Time{}
+	}
+	return S.Reserve(s.source)
+}
+
+func (s *LimitedSource) Release() {
+	S.Release(s.source)
+}
+
+func (s *LimitedSource) tooDeep() bool {
+	if s.external {
+		return s.depth > s.maxDepth+1
+	}
+	return s.depth > s.maxDepth
+}
+
 func MakeSource(source S.Source, maxTotalRequests, maxDepth uint64) *LimitedSource {
 	var totalRequests uint64
 
+	return MakeSourceWithCounter(source, maxTotalRequests, maxDepth, 0, &totalRequests)
+}
+
+// MakeSourceWithCounter makes a source at the given depth which counts
+// requests using *totalRequests. This is useful for resuming a crawl, where
+// there are multiple sources to start from and some requests have already been
+// made.
+func MakeSourceWithCounter(source S.Source, maxTotalRequests, maxDepth, depth uint64, totalRequests *uint64) *LimitedSource {
 	return &LimitedSource{
 		source:           source,
 		maxTotalRequests: maxTotalRequests,
 		maxDepth:         maxDepth,
-		totalRequestsPtr: &totalRequests,
-		depth:            0,
+		totalRequestsPtr: totalRequests,
+		depth:            depth,
 	}
 }
+
+// MakeExternalSourceWithCounter is like MakeSourceWithCounter, but for a link
+// to another site, which is checked one level beyond the depth limit.
+func MakeExternalSourceWithCounter(source S.Source, maxTotalRequests, maxDepth, depth uint64, totalRequests *uint64) *LimitedSource {
+	s := MakeSourceWithCounter(source, maxTotalRequests, maxDepth, depth, totalRequests)
+	s.external = true
+	return s
+}
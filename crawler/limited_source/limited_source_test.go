@@ -1,8 +1,13 @@
 package limited_source
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	C "multiverse.io/crawler/crawler"
+	P "multiverse.io/crawler/crawler/polite_source"
+	S "multiverse.io/crawler/crawler/source"
 	MS "multiverse.io/crawler/crawler/test_helpers/mock_source"
 )
 
@@ -51,3 +56,115 @@ func TestLimitedSource(t *testing.T) {
 		t.Errorf("Unexpectedly got links from over max reqs page")
 	}
 }
+
+func TestLimitedSourceWithCounter(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/page1": []string{"/page2"},
+			"/page2": []string{"/page3"},
+			"/page3": []string{"/page1"},
+		},
+		Assets: map[string][]string{},
+	}
+
+	// 8 of 10 requests have already been made, and we're starting at depth 1.
+	totalRequests := uint64(8)
+	page1 := MakeSourceWithCounter(&MS.MockSource{Universe: &universe, Url: "/page1"}, 10, 2, 1, &totalRequests)
+	page3 := MakeSourceWithCounter(&MS.MockSource{Universe: &universe, Url: "/page3"}, 10, 2, 1, &totalRequests)
+
+	page2Outs := page1.GetOuts().Links[0].Source.GetOuts()
+	if len(page2Outs.Links) != 1 {
+		t.Errorf("Unexpectedly got no links from page within limits")
+	}
+
+	if len(page2Outs.Links[0].Source.GetOuts().Links) != 0 {
+		t.Errorf("Unexpectedly got links from over depth page")
+	}
+
+	if totalRequests != 11 {
+		t.Errorf("Expected shared request counter to be 11, got %v", totalRequests)
+	}
+
+	if len(page3.GetOuts().Links) != 0 {
+		t.Errorf("Unexpectedly got links from over max reqs page")
+	}
+}
+
+func TestLimitedSourceChecksExternalLinksBeyondMaxDepth(t *testing.T) {
+	loaded := &S.Metadata{StatusCode: 200}
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":      []string{"/page1", "http://other.com/"},
+			"/page1": []string{"/page2", "http://other.com/1"},
+		},
+		Assets:   map[string][]string{},
+		External: map[string]bool{"http://other.com/": true, "http://other.com/1": true},
+		Metadata: map[string]*S.Metadata{
+			"/page1":             loaded,
+			"/page2":             loaded,
+			"http://other.com/":  loaded,
+			"http://other.com/1": loaded,
+		},
+	}
+
+	limitedSource := MakeSource(
+		&MS.MockSource{Universe: &universe, Url: "/"},
+		10, // maxTotalRequests
+		0,  // maxDepth
+	)
+
+	// The links from the root are beyond the depth limit, but the external
+	// one is still checked.
+	links := limitedSource.GetOuts().Links
+	if outs := links[0].Source.GetOuts(); outs.Metadata != nil {
+		t.Errorf("Unexpectedly loaded over depth page\n")
+	}
+	if outs := links[1].Source.GetOuts(); outs.Metadata == nil {
+		t.Errorf("Expected the external link from the deepest page to be checked\n")
+	}
+
+	// External links found further down aren't.
+	var totalRequests uint64
+	page1 := MakeSourceWithCounter(&MS.MockSource{Universe: &universe, Url: "/page1"}, 10, 0, 1, &totalRequests)
+	if outs := page1.GetOuts(); outs.Metadata != nil {
+		t.Errorf("Unexpectedly loaded over depth page\n")
+	}
+	external := MakeExternalSourceWithCounter(&MS.MockSource{Universe: &universe, Url: "http://other.com/1"}, 10, 0, 2, &totalRequests)
+	if outs := external.GetOuts(); outs.Metadata != nil {
+		t.Errorf("Unexpectedly checked external link two levels over the depth limit\n")
+	}
+
+	external = MakeExternalSourceWithCounter(&MS.MockSource{Universe: &universe, Url: "http://other.com/1"}, 10, 0, 1, &totalRequests)
+	if outs := external.GetOuts(); outs.Metadata == nil {
+		t.Errorf("Expected a resumed external link one level over the depth limit to be checked\n")
+	}
+}
+
+func TestLimitedSourceOverMaxReqsDoesNotWaitForHost(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links:  map[string][]string{"http://a.com/": nil},
+		Assets: map[string][]string{},
+	}
+	for i := 0; i < 20; i++ {
+		url := fmt.Sprintf("http://a.com/page%v", i)
+		universe.Links["http://a.com/"] = append(universe.Links["http://a.com/"], url)
+	}
+
+	// Only the root is loaded; the pages it links to are over the request
+	// limit, so they shouldn't each wait out the host's delay.
+	source := MakeSource(
+		P.MakeSource(&MS.MockSource{Universe: &universe, Url: "http://a.com/"}, P.Options{MinDelay: 200 * time.Millisecond}),
+		1,  // maxTotalRequests
+		10, // maxDepth
+	)
+
+	start := time.Now()
+	root := C.Crawl(source, C.AssetsModeIgnoreAssets)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the crawl to finish without waiting for the host; took %v\n", elapsed)
+	}
+
+	if len(root.Out) != 20 || root.Out[0].Node.Metadata != nil {
+		t.Errorf("Expected 20 unloaded pages; got %v edges\n", len(root.Out))
+	}
+}
@@ -0,0 +1,260 @@
+// Package polite_source wraps a Source so that it limits the number of
+// concurrent requests to each host, and waits a minimum time between starting
+// requests to the same host. If a host asks us to back off with a Retry-After
+// header, no more requests are made to it until that time has passed, and if
+// its robots.txt gives a longer Crawl-delay than the minimum, that is waited
+// between its requests instead.
+//
+// A PoliteSource waits in GetOuts unless the right to make its request was
+// reserved first with Reserve, which doesn't wait, so a crawler can leave
+// requests to a busy host queued while its workers load others.
+package polite_source
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
+type Options struct {
+	// The maximum number of requests to make to a host at once. 0 means no
+	// limit.
+	MaxConcurrency int
+
+	// The minimum time between starting requests to a host.
+	MinDelay time.Duration
+}
+
+// Hosts tracks the requests made to each host. It is shared by all the sources
+// in a crawl.
+type Hosts struct {
+	options Options
+
+	mutex sync.Mutex
+	hosts map[string]*host
+}
+
+type host struct {
+	slots chan struct{} // nil if there is no concurrency limit
+
+	mutex      sync.Mutex
+	next       time.Time     // the earliest time we may start the next request
+	crawlDelay time.Duration // from the host's robots.txt, once known
+}
+
+func NewHosts(options Options) *Hosts {
+	return &Hosts{options: options, hosts: make(map[string]*host)}
+}
+
+func (h *Hosts) get(name string) *host {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	result := h.hosts[name]
+	if result == nil {
+		result = &host{}
+		if h.options.MaxConcurrency > 0 {
+			result.slots = make(chan struct{}, h.options.MaxConcurrency)
+		}
+		h.hosts[name] = result
+	}
+
+	return result
+}
+
+type PoliteSource struct {
+	source S.Source
+	hosts  *Hosts
+
+	// Whether Reserve has taken a slot for the request and started the
+	// host's delay.
+	reserved bool
+}
+
+func (s *PoliteSource) GetUrl() string {
+	return s.source.GetUrl()
+}
+
+func (s *PoliteSource) GetOuts() S.Outs {
+	return s.GetOutsContext(context.Background())
+}
+
+func (s *PoliteSource) GetOutsContext(ctx context.Context) S.Outs {
+	h := s.hosts.get(hostName(s.source.GetUrl()))
+
+	if s.reserved {
+		s.reserved = false
+		if h.slots != nil {
+			defer func() { <-h.slots }()
+		}
+	} else {
+		if h.slots != nil {
+			select {
+			case h.slots <- struct{}{}:
+				defer func() { <-h.slots }()
+			case <-ctx.Done():
+				return S.Outs{}
+			}
+		}
+
+		if err := h.wait(ctx, s.hosts.options.MinDelay); err != nil {
+			return S.Outs{}
+		}
+	}
+
+	start := time.Now()
+	origOuts := S.GetOutsContext(ctx, s.source)
+
+	if origOuts.Metadata != nil && origOuts.Metadata.CrawlDelay > 0 {
+		h.setCrawlDelay(origOuts.Metadata.CrawlDelay, start)
+	}
+	if origOuts.Metadata != nil && origOuts.Metadata.RetryAfter > 0 {
+		h.backOff(origOuts.Metadata.RetryAfter)
+	}
+
+	newLinks := make([]S.Link, len(origOuts.Links))
+	for i, l := range origOuts.Links {
+		newLinks[i] = l
+		newLinks[i].Source = &PoliteSource{source: l.Source, hosts: s.hosts}
+	}
+
+	newAssets := make([]S.Asset, len(origOuts.Assets))
+	for i, a := range origOuts.Assets {
+		newAssets[i] = a
+		if a.Source != nil {
+			newAssets[i].Source = &PoliteSource{source: a.Source, hosts: s.hosts}
+		}
+	}
+
+	return S.Outs{
+		Assets:   newAssets,
+		Links:    newLinks,
+		Metadata: origOuts.Metadata,
+	}
+}
+
+// Reserve takes a slot for the request and starts the host's delay if the
+// request may start now. Otherwise, it returns when the host's delay ends, or
+// the zero time if the host already has as many requests in progress as it
+// may.
+func (s *PoliteSource) Reserve() (bool, time.Time) {
+	if s.reserved {
+		return true, time.Time{}
+	}
+
+	h := s.hosts.get(hostName(s.source.GetUrl()))
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	if h.next.After(now) {
+		return false, h.next
+	}
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		default:
+			return false, time.Time{}
+		}
+	}
+
+	h.next = now.Add(h.delay(s.hosts.options.MinDelay))
+	s.reserved = true
+	return true, time.Time{}
+}
+
+// Release gives back the slot taken by Reserve, if any.
+func (s *PoliteSource) Release() {
+	if !s.reserved {
+		return
+	}
+	s.reserved = false
+
+	if h := s.hosts.get(hostName(s.source.GetUrl())); h.slots != nil {
+		<-h.slots
+	}
+}
+
+// wait blocks until we may start a request to the host, or until ctx is
+// cancelled.
+func (h *host) wait(ctx context.Context, minDelay time.Duration) error {
+	h.mutex.Lock()
+	now := time.Now()
+	start := h.next
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(h.delay(minDelay))
+	h.mutex.Unlock()
+
+	if !start.After(now) {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// delay returns the time to leave between starting requests to the host: the
+// greater of minDelay and its Crawl-delay. The host's mutex must be held.
+func (h *host) delay(minDelay time.Duration) time.Duration {
+	if h.crawlDelay > minDelay {
+		return h.crawlDelay
+	}
+	return minDelay
+}
+
+// setCrawlDelay records the host's Crawl-delay, which the response to a
+// request started at start has told us, and keeps the next request from
+// starting until it has passed since then.
+func (h *host) setCrawlDelay(d time.Duration, start time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.crawlDelay = d
+	if next := start.Add(d); next.After(h.next) {
+		h.next = next
+	}
+}
+
+// backOff stops requests to the host from starting for the given time.
+func (h *host) backOff(d time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if until := time.Now().Add(d); until.After(h.next) {
+		h.next = until
+	}
+}
+
+func hostName(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+func MakeSource(source S.Source, options Options) *PoliteSource {
+	return MakeSourceWithHosts(source, NewHosts(options))
+}
+
+// MakeSourceWithHosts makes a source that shares the given Hosts with other
+// sources. This is useful for resuming a crawl, where there are multiple
+// sources to start from.
+func MakeSourceWithHosts(source S.Source, hosts *Hosts) *PoliteSource {
+	return &PoliteSource{source: source, hosts: hosts}
+}
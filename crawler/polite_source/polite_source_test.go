@@ -0,0 +1,222 @@
+package polite_source
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	S "multiverse.io/crawler/crawler/source"
+	MS "multiverse.io/crawler/crawler/test_helpers/mock_source"
+)
+
+// concurrencySource records the maximum number of its requests that were in
+// progress at once.
+type concurrencySource struct {
+	url   string
+	delay time.Duration
+
+	mutex   *sync.Mutex
+	current *int
+	max     *int
+}
+
+func (s *concurrencySource) GetUrl() string {
+	return s.url
+}
+
+func (s *concurrencySource) GetOuts() S.Outs {
+	s.mutex.Lock()
+	*s.current++
+	if *s.current > *s.max {
+		*s.max = *s.current
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mutex.Lock()
+	*s.current--
+	s.mutex.Unlock()
+
+	return S.Outs{}
+}
+
+func TestPoliteSourceLimitsConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	current := map[string]*int{"a.com": new(int), "b.com": new(int)}
+	max := map[string]*int{"a.com": new(int), "b.com": new(int)}
+
+	hosts := NewHosts(Options{MaxConcurrency: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		for _, host := range []string{"a.com", "b.com"} {
+			source := MakeSourceWithHosts(&concurrencySource{
+				url:     "http://" + host + "/",
+				delay:   20 * time.Millisecond,
+				mutex:   &mutex,
+				current: current[host],
+				max:     max[host],
+			}, hosts)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				source.GetOuts()
+			}()
+		}
+	}
+	wg.Wait()
+
+	for host, m := range max {
+		if *m != 2 {
+			t.Errorf("Expected 2 concurrent requests to %v; got %v\n", host, *m)
+		}
+	}
+}
+
+func TestPoliteSourceDelaysRequests(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"http://a.com/":  []string{"http://a.com/1", "http://b.com/"},
+			"http://a.com/1": []string{},
+		},
+	}
+
+	source := MakeSource(&MS.MockSource{Universe: &universe, Url: "http://a.com/"}, Options{MinDelay: 100 * time.Millisecond})
+
+	start := time.Now()
+	outs := source.GetOuts()
+
+	// A different host isn't delayed.
+	outs.Links[1].Source.GetOuts()
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("Request to another host was delayed by %v\n", elapsed)
+	}
+
+	outs.Links[0].Source.GetOuts()
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Second request to the same host was only delayed by %v\n", elapsed)
+	}
+}
+
+func TestPoliteSourceHonorsRetryAfter(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"http://a.com/": []string{"http://a.com/1"},
+		},
+		Metadata: map[string]*S.Metadata{
+			"http://a.com/": &S.Metadata{StatusCode: 429, RetryAfter: 100 * time.Millisecond},
+		},
+	}
+
+	source := MakeSource(&MS.MockSource{Universe: &universe, Url: "http://a.com/"}, Options{})
+
+	start := time.Now()
+	outs := source.GetOuts()
+	outs.Links[0].Source.GetOuts()
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Request after Retry-After was only delayed by %v\n", elapsed)
+	}
+}
+
+func TestPoliteSourceHonorsCrawlDelay(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"http://a.com/": []string{"http://a.com/1", "http://a.com/2"},
+		},
+		Metadata: map[string]*S.Metadata{
+			"http://a.com/":  &S.Metadata{StatusCode: 200, CrawlDelay: 100 * time.Millisecond},
+			"http://a.com/1": &S.Metadata{StatusCode: 200, CrawlDelay: 100 * time.Millisecond},
+		},
+	}
+
+	source := MakeSource(&MS.MockSource{Universe: &universe, Url: "http://a.com/"}, Options{MinDelay: 10 * time.Millisecond})
+
+	start := time.Now()
+	outs := source.GetOuts()
+
+	// The host's Crawl-delay is reported through Reserve rather than waited
+	// for, and applies to every request after the first.
+	ok, retryAt := outs.Links[0].Source.(*PoliteSource).Reserve()
+	if ok || retryAt.Sub(start) < 100*time.Millisecond {
+		t.Errorf("Expected the Crawl-delay to apply; got %v %v\n", ok, retryAt.Sub(start))
+	}
+
+	outs.Links[0].Source.GetOuts()
+	outs.Links[1].Source.GetOuts()
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Requests after Crawl-delay were only delayed by %v\n", elapsed)
+	}
+}
+
+func TestPoliteSourceCancellation(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Metadata: map[string]*S.Metadata{
+			"http://a.com/": &S.Metadata{StatusCode: 503, RetryAfter: time.Hour},
+		},
+	}
+
+	hosts := NewHosts(Options{})
+	MakeSourceWithHosts(&MS.MockSource{Universe: &universe, Url: "http://a.com/"}, hosts).GetOuts()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	outs := MakeSourceWithHosts(&MS.MockSource{Universe: &universe, Url: "http://a.com/"}, hosts).GetOutsContext(ctx)
+	if outs.Metadata != nil {
+		t.Errorf("Expected a cancelled request not to be made\n")
+	}
+}
+
+func TestPoliteSourceReserve(t *testing.T) {
+	universe := MS.MockSourceUniverse{}
+	makeSource := func(u string, hosts *Hosts) *PoliteSource {
+		return MakeSourceWithHosts(&MS.MockSource{Universe: &universe, Url: u}, hosts)
+	}
+
+	hosts := NewHosts(Options{MaxConcurrency: 1})
+	a1, a2, b := makeSource("http://a.com/1", hosts), makeSource("http://a.com/2", hosts), makeSource("http://b.com/", hosts)
+
+	if ok, _ := a1.Reserve(); !ok {
+		t.Fatalf("Couldn't reserve a request to a free host\n")
+	}
+	if ok, retryAt := a2.Reserve(); ok || !retryAt.IsZero() {
+		t.Errorf("Expected a host with no free slots to be busy; got %v %v\n", ok, retryAt)
+	}
+	if ok, _ := b.Reserve(); !ok {
+		t.Errorf("Couldn't reserve a request to another host\n")
+	}
+
+	// A reserved request frees its slot once it's done.
+	a1.GetOuts()
+	if ok, _ := a2.Reserve(); !ok {
+		t.Errorf("Couldn't reserve a request once the host was free\n")
+	}
+
+	// Releasing a reservation frees its slot too.
+	a2.Release()
+	if ok, _ := a1.Reserve(); !ok {
+		t.Errorf("Couldn't reserve a request once a reservation was released\n")
+	}
+
+	hosts = NewHosts(Options{MinDelay: 50 * time.Millisecond})
+	a1, a2 = makeSource("http://a.com/1", hosts), makeSource("http://a.com/2", hosts)
+
+	start := time.Now()
+	a1.Reserve()
+	a1.GetOuts()
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("Reserved request was delayed by %v\n", elapsed)
+	}
+
+	ok, retryAt := a2.Reserve()
+	if ok || retryAt.Sub(start) < 50*time.Millisecond {
+		t.Errorf("Expected the host's delay to apply; got %v %v\n", ok, retryAt.Sub(start))
+	}
+	time.Sleep(time.Until(retryAt))
+	if ok, _ := a2.Reserve(); !ok {
+		t.Errorf("Couldn't reserve a request once the host's delay had passed\n")
+	}
+}
@@ -0,0 +1,257 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+type attributeType int
+
+const (
+	attributeTypeString attributeType = iota
+	attributeTypeInt
+	attributeTypeLong
+	attributeTypeBoolean
+	attributeTypeDouble
+)
+
+func (t attributeType) graphmlName() string {
+	switch t {
+	case attributeTypeInt:
+		return "int"
+	case attributeTypeLong:
+		return "long"
+	case attributeTypeBoolean:
+		return "boolean"
+	case attributeTypeDouble:
+		return "double"
+	}
+	return "string"
+}
+
+func (t attributeType) gexfName() string {
+	switch t {
+	case attributeTypeInt:
+		return "integer"
+	case attributeTypeLong:
+		return "long"
+	case attributeTypeBoolean:
+		return "boolean"
+	case attributeTypeDouble:
+		return "double"
+	}
+	return "string"
+}
+
+// nodeAttribute is an attribute of the nodes in the GraphML and GEXF formats.
+// The attributes that describe the response (those with metadata set) are
+// only given for nodes that were loaded, and are read after loaded.
+type nodeAttribute struct {
+	name     string
+	typ      attributeType
+	metadata bool
+
+	get func(node *G.Node) string
+	set func(node *G.Node, value string) error
+}
+
+var nodeAttributes = []nodeAttribute{
+	{"depth", attributeTypeInt, false,
+		func(node *G.Node) string { return strconv.Itoa(node.Depth) },
+		func(node *G.Node, value string) (err error) {
+			node.Depth, err = strconv.Atoi(value)
+			return
+		}},
+	{"popularity", attributeTypeInt, false,
+		func(node *G.Node) string { return strconv.Itoa(node.Popularity) },
+		func(node *G.Node, value string) (err error) {
+			node.Popularity, err = strconv.Atoi(value)
+			return
+		}},
+	{"pagerank", attributeTypeDouble, false,
+		func(node *G.Node) string { return formatFloat(node.PageRank) },
+		func(node *G.Node, value string) (err error) {
+			node.PageRank, err = strconv.ParseFloat(value, 64)
+			return
+		}},
+	{"hub_score", attributeTypeDouble, false,
+		func(node *G.Node) string { return formatFloat(node.HubScore) },
+		func(node *G.Node, value string) (err error) {
+			node.HubScore, err = strconv.ParseFloat(value, 64)
+			return
+		}},
+	{"authority_score", attributeTypeDouble, false,
+		func(node *G.Node) string { return formatFloat(node.AuthorityScore) },
+		func(node *G.Node, value string) (err error) {
+			node.AuthorityScore, err = strconv.ParseFloat(value, 64)
+			return
+		}},
+	{"betweenness", attributeTypeDouble, false,
+		func(node *G.Node) string { return formatFloat(node.Betweenness) },
+		func(node *G.Node, value string) (err error) {
+			node.Betweenness, err = strconv.ParseFloat(value, 64)
+			return
+		}},
+	{"pure_asset", attributeTypeBoolean, false,
+		func(node *G.Node) string { return strconv.FormatBool(node.PureAsset) },
+		func(node *G.Node, value string) (err error) {
+			node.PureAsset, err = strconv.ParseBool(value)
+			return
+		}},
+	{"external", attributeTypeBoolean, false,
+		func(node *G.Node) string { return strconv.FormatBool(node.External) },
+		func(node *G.Node, value string) (err error) {
+			node.External, err = strconv.ParseBool(value)
+			return
+		}},
+	{"aliases", attributeTypeString, false,
+		func(node *G.Node) string { return strings.Join(node.Aliases, " ") },
+		func(node *G.Node, value string) error {
+			node.Aliases = strings.Fields(value)
+			return nil
+		}},
+	{"loaded", attributeTypeBoolean, false,
+		func(node *G.Node) string { return strconv.FormatBool(node.Metadata != nil) },
+		func(node *G.Node, value string) error {
+			loaded, err := strconv.ParseBool(value)
+			if loaded && node.Metadata == nil {
+				node.Metadata = &S.Metadata{ContentLength: -1}
+			}
+			return err
+		}},
+	{"status_code", attributeTypeInt, true,
+		func(node *G.Node) string { return strconv.Itoa(node.Metadata.StatusCode) },
+		func(node *G.Node, value string) (err error) {
+			node.Metadata.StatusCode, err = strconv.Atoi(value)
+			return
+		}},
+	{"content_type", attributeTypeString, true,
+		func(node *G.Node) string { return node.Metadata.ContentType },
+		func(node *G.Node, value string) error {
+			node.Metadata.ContentType = value
+			return nil
+		}},
+	{"content_length", attributeTypeLong, true,
+		func(node *G.Node) string { return strconv.FormatInt(node.Metadata.ContentLength, 10) },
+		func(node *G.Node, value string) (err error) {
+			node.Metadata.ContentLength, err = strconv.ParseInt(value, 10, 64)
+			return
+		}},
+	{"response_time_ms", attributeTypeLong, true,
+		func(node *G.Node) string { return strconv.FormatInt(node.Metadata.ResponseTime.Milliseconds(), 10) },
+		func(node *G.Node, value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			node.Metadata.ResponseTime = time.Duration(ms) * time.Millisecond
+			return err
+		}},
+	{"last_modified", attributeTypeString, true,
+		func(node *G.Node) string {
+			if node.Metadata.LastModified.IsZero() {
+				return ""
+			}
+			return node.Metadata.LastModified.Format(time.RFC3339)
+		},
+		func(node *G.Node, value string) (err error) {
+			if value != "" {
+				node.Metadata.LastModified, err = time.Parse(time.RFC3339, value)
+			}
+			return
+		}},
+	{"redirect_url", attributeTypeString, true,
+		func(node *G.Node) string { return node.Metadata.RedirectUrl },
+		func(node *G.Node, value string) error {
+			node.Metadata.RedirectUrl = value
+			return nil
+		}},
+	{"canonical_url", attributeTypeString, true,
+		func(node *G.Node) string { return node.Metadata.CanonicalUrl },
+		func(node *G.Node, value string) error {
+			node.Metadata.CanonicalUrl = value
+			return nil
+		}},
+	{"title", attributeTypeString, true,
+		func(node *G.Node) string { return node.Metadata.Title },
+		func(node *G.Node, value string) error {
+			node.Metadata.Title = value
+			return nil
+		}},
+	{"error", attributeTypeString, true,
+		func(node *G.Node) string { return node.Metadata.Error },
+		func(node *G.Node, value string) error {
+			node.Metadata.Error = value
+			return nil
+		}},
+	{"retry_after_ms", attributeTypeLong, true,
+		func(node *G.Node) string { return strconv.FormatInt(node.Metadata.RetryAfter.Milliseconds(), 10) },
+		func(node *G.Node, value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			node.Metadata.RetryAfter = time.Duration(ms) * time.Millisecond
+			return err
+		}},
+	{"crawl_delay_ms", attributeTypeLong, true,
+		func(node *G.Node) string { return strconv.FormatInt(node.Metadata.CrawlDelay.Milliseconds(), 10) },
+		func(node *G.Node, value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			node.Metadata.CrawlDelay = time.Duration(ms) * time.Millisecond
+			return err
+		}},
+	{"attempts", attributeTypeInt, true,
+		func(node *G.Node) string { return strconv.Itoa(node.Metadata.Attempts) },
+		func(node *G.Node, value string) (err error) {
+			node.Metadata.Attempts, err = strconv.Atoi(value)
+			return
+		}},
+}
+
+func nodeAttributeNames() []string {
+	var names []string
+	for _, a := range nodeAttributes {
+		names = append(names, a.name)
+	}
+	return names
+}
+
+// formatFloat formats a float with as many digits as are needed to read it
+// back exactly.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// setNodeAttributes sets the attributes of a node read from a file, given by
+// name. Attributes added by other tools are ignored.
+func setNodeAttributes(node *G.Node, values map[string]string) error {
+	for _, a := range nodeAttributes {
+		value, ok := values[a.name]
+		if !ok {
+			continue
+		}
+		if a.metadata && node.Metadata == nil {
+			return fmt.Errorf("Attribute %v given for %v, which wasn't loaded", a.name, node.Url)
+		}
+		if err := a.set(node, value); err != nil {
+			return fmt.Errorf("Bad value '%v' for attribute %v of %v", value, a.name, node.Url)
+		}
+	}
+	return nil
+}
+
+// sortedNodes returns the nodes reachable from root, starting with root and
+// followed by the others in order of URL.
+func sortedNodes(root *G.Node) []*G.Node {
+	var nodes []*G.Node
+	G.Traverse(root, func(node *G.Node) {
+		if node != root {
+			nodes = append(nodes, node)
+		}
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Url < nodes[j].Url
+	})
+	return append([]*G.Node{root}, nodes...)
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"testing"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+// checkAttributeValues checks that the values given for a node are for
+// declared attributes and parse as their declared types, and that there is a
+// value for every declared attribute (except those that describe the response,
+// if the node wasn't loaded).
+func checkAttributeValues(t *testing.T, format string, node *G.Node, declared, values map[string]string) {
+	for name, value := range values {
+		typ, ok := declared[name]
+		if !ok {
+			t.Errorf("%v value for undeclared attribute %v of %v\n", format, name, node.Url)
+			continue
+		}
+
+		var err error
+		switch typ {
+		case "int", "integer":
+			_, err = strconv.Atoi(value)
+		case "long":
+			_, err = strconv.ParseInt(value, 10, 64)
+		case "double":
+			_, err = strconv.ParseFloat(value, 64)
+		case "boolean":
+			_, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			t.Errorf("%v value '%v' for attribute %v of %v isn't of type %v\n", format, value, name, node.Url, typ)
+		}
+	}
+
+	metadata := make(map[string]bool)
+	for _, a := range nodeAttributes {
+		metadata[a.name] = a.metadata
+	}
+	for name := range declared {
+		if _, ok := values[name]; !ok && (node.Metadata != nil || !metadata[name]) {
+			t.Errorf("No %v value for attribute %v of %v\n", format, name, node.Url)
+		}
+	}
+}
+
+func TestExportedAttributesMatchDeclarations(t *testing.T) {
+	root := makeExportTestGraph()
+	nodes := sortedNodes(root)
+
+	var buf bytes.Buffer
+	if err := WriteGraphML(&buf, root); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	var graphml graphmlFile
+	if err := xml.Unmarshal(buf.Bytes(), &graphml); err != nil {
+		t.Fatalf("Unexpected error reading GraphML: %v\n", err)
+	}
+
+	declared := make(map[string]string)
+	for _, k := range graphml.Keys {
+		if k.For == "node" {
+			declared[k.Id] = k.Type
+		}
+	}
+	if len(declared) != len(nodeAttributes)+1 {
+		t.Errorf("Unexpected GraphML keys %v\n", declared)
+	}
+	for i, n := range graphml.Graph.Nodes {
+		values := make(map[string]string)
+		for _, d := range n.Data {
+			values[d.Key] = d.Value
+		}
+		checkAttributeValues(t, "GraphML", nodes[i], declared, values)
+	}
+
+	buf.Reset()
+	if err := WriteGexf(&buf, root); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	var gexf gexfFile
+	if err := xml.Unmarshal(buf.Bytes(), &gexf); err != nil {
+		t.Fatalf("Unexpected error reading GEXF: %v\n", err)
+	}
+
+	declared = make(map[string]string)
+	for _, attributes := range gexf.Graph.Attributes {
+		if attributes.Class == "node" {
+			for _, a := range attributes.Attributes {
+				declared[a.Id] = a.Type
+			}
+		}
+	}
+	if len(declared) != len(nodeAttributes) {
+		t.Errorf("Unexpected GEXF attributes %v\n", declared)
+	}
+	for i, n := range gexf.Graph.Nodes {
+		values := make(map[string]string)
+		for _, v := range n.AttValues {
+			values[v.For] = v.Value
+		}
+		checkAttributeValues(t, "GEXF", nodes[i], declared, values)
+	}
+}
@@ -0,0 +1,100 @@
+package render
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+// csvNodeColumns are the URL followed by the attributes of nodes, as in the
+// GraphML and GEXF formats.
+var csvNodeColumns = append([]string{"url"}, nodeAttributeNames()...)
+
+var csvEdgeColumns = []string{"source", "target", "kind"}
+
+// WriteCsv writes the graph reachable from root as two CSV tables, each with a
+// header row. nodes gets a row for each node, with a column for each field of
+// the node and of its metadata; aliases are separated by spaces, durations are
+// in milliseconds, and the metadata columns are empty for nodes that weren't
+// loaded. edges gets a row for each edge, with the URLs of its source and
+// target and its kind ("link", "asset", "sitemap" or "seed"). The root is the
+// first node.
+func WriteCsv(nodes, edges io.Writer, root *G.Node) error {
+	nodesWriter := csv.NewWriter(nodes)
+	edgesWriter := csv.NewWriter(edges)
+
+	if err := nodesWriter.Write(csvNodeColumns); err != nil {
+		return err
+	}
+	if err := edgesWriter.Write(csvEdgeColumns); err != nil {
+		return err
+	}
+
+	var err error
+	G.Traverse(root, func(node *G.Node) {
+		if err != nil {
+			return
+		}
+
+		if err = nodesWriter.Write(csvNodeRow(node)); err != nil {
+			return
+		}
+
+		for _, e := range node.Out {
+			if err = edgesWriter.Write([]string{node.Url, e.Node.Url, e.Kind.String()}); err != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	nodesWriter.Flush()
+	edgesWriter.Flush()
+	if err := nodesWriter.Error(); err != nil {
+		return err
+	}
+	return edgesWriter.Error()
+}
+
+// WriteCsvZip writes the tables written by WriteCsv to w as nodes.csv and
+// edges.csv in a zip file.
+func WriteCsvZip(w io.Writer, root *G.Node) error {
+	zw := zip.NewWriter(w)
+
+	var nodes, edges strings.Builder
+	if err := WriteCsv(&nodes, &edges, root); err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		name     string
+		contents string
+	}{{"nodes.csv", nodes.String()}, {"edges.csv", edges.String()}} {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.contents); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func csvNodeRow(node *G.Node) []string {
+	row := []string{node.Url}
+	for _, a := range nodeAttributes {
+		if a.metadata && node.Metadata == nil {
+			row = append(row, "")
+		} else {
+			row = append(row, a.get(node))
+		}
+	}
+	return row
+}
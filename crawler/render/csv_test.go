@@ -0,0 +1,85 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCsv(t *testing.T) {
+	root := makeExportTestGraph()
+	root.Aliases = []string{"http://foo.com/index.html", "http://www.foo.com/"}
+	root.Metadata.LastModified = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	root.Metadata.Attempts = 2
+
+	var nodes, edges strings.Builder
+	if err := WriteCsv(&nodes, &edges, root); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	nodeRows, err := csv.NewReader(strings.NewReader(nodes.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("Couldn't read nodes: %v\n", err)
+	}
+
+	expectedNodes := []string{
+		"url,depth,popularity,pagerank,hub_score,authority_score,betweenness,pure_asset,external,aliases,loaded,status_code,content_type,content_length,response_time_ms,last_modified,redirect_url,canonical_url,title,error,retry_after_ms,crawl_delay_ms,attempts",
+		"http://foo.com/,0,1,0.3,0.25,0.3333333333333333,0.5,false,false,http://foo.com/index.html http://www.foo.com/,true,200,text/html; charset=utf-8,-1,120,2021-03-04T05:06:07Z,,,Foo & <Bar>,,0,0,2",
+	}
+	for i, expected := range expectedNodes {
+		if actual := strings.Join(nodeRows[i], ","); actual != expected {
+			t.Errorf("Unexpected node row %v:\n%v\nExpected:\n%v\n", i, actual, expected)
+		}
+	}
+
+	if len(nodeRows) != 6 {
+		t.Errorf("Expected 5 nodes; got:\n%v\n", nodes.String())
+	}
+	for _, row := range nodeRows {
+		if row[0] == "http://foo.com/orphan" && strings.Join(row, ",") != "http://foo.com/orphan,1,1,0,0,0,0,false,false,,false,,,,,,,,,,,," {
+			t.Errorf("Unexpected row for node that wasn't loaded: %v\n", row)
+		}
+	}
+
+	expectedEdges := `source,target,kind
+http://foo.com/,http://foo.com/start?a=1&b=2,seed
+http://foo.com/,http://foo.com/site.css,asset
+http://foo.com/,"http://bar.com/""quoted""",link
+http://foo.com/,http://foo.com/orphan,sitemap
+`
+	if !strings.HasPrefix(edges.String(), expectedEdges) || strings.Count(edges.String(), "\n") != 7 {
+		t.Errorf("Unexpected edges:\n%v\n", edges.String())
+	}
+}
+
+func TestWriteCsvZip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCsvZip(&buf, makeExportTestGraph()); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Couldn't read zip file: %v\n", err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+
+		r, _ := f.Open()
+		contents, _ := io.ReadAll(r)
+		r.Close()
+		if !strings.HasPrefix(string(contents), "url,") && !strings.HasPrefix(string(contents), "source,") {
+			t.Errorf("Unexpected contents of %v:\n%s\n", f.Name, contents)
+		}
+	}
+
+	if strings.Join(names, " ") != "nodes.csv edges.csv" {
+		t.Errorf("Unexpected files in zip: %v\n", names)
+	}
+}
@@ -0,0 +1,191 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+type DotOptions struct {
+	// If greater than 0, the nodes whose URLs share the same first
+	// ClusterDepth path segments (e.g. "/docs" with a ClusterDepth of 1) are
+	// grouped into a subgraph, if there are at least two of them.
+	ClusterDepth int
+}
+
+// ExportDot renders a graph in Graphviz's DOT language. Nodes are colored and
+// shaped as in ExportHtml, and also have the attributes depth, pure_asset,
+// external and (if they were loaded) status or error. Edges have a kind
+// attribute, which is "link", "asset", "sitemap" or "seed". Sitemap and seed
+// edges are dashed, and don't affect the layout.
+func ExportDot(root *G.Node, options DotOptions) string {
+	parsed, _ := url.Parse(root.Url)
+	stripPrefix := parsed.Scheme + "://" + parsed.Host + "/"
+
+	var nodes []*G.Node
+	G.Traverse(root, func(node *G.Node) {
+		nodes = append(nodes, node)
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Url < nodes[j].Url
+	})
+
+	sitemapStatuses := G.SitemapStatuses(root)
+
+	clusters := make(map[string][]*G.Node)
+	if options.ClusterDepth > 0 {
+		for _, node := range nodes {
+			displayed := displayUrl(stripPrefix, node.Url)
+			if node.Url == stripPrefix {
+				displayed = "/"
+			}
+			prefix := pathPrefix(displayed, options.ClusterDepth)
+			clusters[prefix] = append(clusters[prefix], node)
+		}
+	}
+
+	var prefixes []string
+	for prefix, clusterNodes := range clusters {
+		if len(clusterNodes) >= 2 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %v {\n", dotQuote(root.Url))
+	fmt.Fprintf(&sb, "  node [style=filled];\n")
+
+	clustered := make(map[*G.Node]bool)
+	for i, prefix := range prefixes {
+		fmt.Fprintf(&sb, "  subgraph cluster_%v {\n", i)
+		fmt.Fprintf(&sb, "    label=%v;\n", dotQuote(prefix))
+		for _, node := range clusters[prefix] {
+			clustered[node] = true
+			fmt.Fprintf(&sb, "    %v\n", dotNode(stripPrefix, node, sitemapStatuses[node]))
+		}
+		fmt.Fprintf(&sb, "  }\n")
+	}
+
+	for _, node := range nodes {
+		if !clustered[node] {
+			fmt.Fprintf(&sb, "  %v\n", dotNode(stripPrefix, node, sitemapStatuses[node]))
+		}
+	}
+
+	for _, node := range nodes {
+		for _, e := range node.Out {
+			fmt.Fprintf(&sb, "  %v -> %v [%v];\n", dotQuote(node.Url), dotQuote(e.Node.Url), dotEdgeAttributes(e.Kind))
+		}
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func dotNode(stripPrefix string, node *G.Node, sitemapStatus G.SitemapStatus) string {
+	color := "blue"
+	switch {
+	case node.Depth == 0:
+		color = "red"
+	case node.Metadata != nil && node.Metadata.IsBroken():
+		color = "orange"
+	case node.External:
+		color = "violet"
+	case sitemapStatus == G.SitemapStatusSitemapOnly:
+		color = "teal"
+	case node.PureAsset:
+		color = "grey"
+	}
+
+	label := displayUrl(stripPrefix, node.Url)
+	shape := "ellipse"
+	if m := node.Metadata; m != nil {
+		if m.IsBroken() {
+			problem := m.Error
+			if problem == "" {
+				problem = fmt.Sprint(m.StatusCode)
+			}
+			label += " [" + problem + "]"
+		} else if !strings.HasPrefix(m.ContentType, "text/html") {
+			shape = "diamond"
+		}
+	}
+
+	attributes := []string{
+		"label=" + dotQuote(label),
+		"URL=" + dotQuote(node.Url),
+		"shape=" + shape,
+		"fillcolor=" + color,
+		fmt.Sprintf("depth=%v", node.Depth),
+		fmt.Sprintf("pure_asset=%v", node.PureAsset),
+		fmt.Sprintf("external=%v", node.External),
+	}
+	if m := node.Metadata; m != nil {
+		if m.Error != "" {
+			attributes = append(attributes, "error="+dotQuote(m.Error))
+		} else {
+			attributes = append(attributes, fmt.Sprintf("status=%v", m.StatusCode))
+		}
+	}
+
+	return fmt.Sprintf("%v [%v];", dotQuote(node.Url), strings.Join(attributes, ", "))
+}
+
+func dotEdgeAttributes(kind G.EdgeKind) string {
+	switch kind {
+	case G.EdgeKindAsset:
+		return "kind=asset, color=grey"
+	case G.EdgeKindSitemap:
+		return "kind=sitemap, color=teal, style=dashed, constraint=false"
+	case G.EdgeKindSeed:
+		return "kind=seed, color=red, style=dashed, constraint=false"
+	}
+	return "kind=" + kind.String() + ", color=blue"
+}
+
+// dotQuote makes a DOT string literal.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// displayUrl strips the scheme and host of the root from a URL, as in
+// render.js.
+func displayUrl(prefix, u string) string {
+	if u == prefix || !strings.HasPrefix(u, prefix) {
+		return u
+	}
+	return "/" + strings.TrimPrefix(u[len(prefix):], "/")
+}
+
+// pathPrefix returns the first n segments of the path of a URL as displayed by
+// displayUrl, ignoring its query. URLs on other hosts keep their scheme and
+// host.
+func pathPrefix(displayed string, n int) string {
+	base := ""
+	if !strings.HasPrefix(displayed, "/") {
+		if parsed, err := url.Parse(displayed); err == nil {
+			base = parsed.Scheme + "://" + parsed.Host
+			displayed = parsed.EscapedPath()
+		}
+	}
+
+	if i := strings.IndexByte(displayed, '?'); i >= 0 {
+		displayed = displayed[:i]
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(displayed, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) > n {
+		segments = segments[:n]
+	}
+
+	return base + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+func makeDotTestGraph() *G.Node {
+	root := &G.Node{Url: "http://foo.com/", Metadata: &S.Metadata{StatusCode: 200, ContentType: "text/html"}}
+	docs := &G.Node{Url: "http://foo.com/docs/", Depth: 1, Metadata: &S.Metadata{StatusCode: 200, ContentType: "text/html"}}
+	page := &G.Node{Url: "http://foo.com/docs/a?q=\"x\"", Depth: 2, Metadata: &S.Metadata{StatusCode: 404, ContentType: "text/html"}}
+	css := &G.Node{Url: "http://foo.com/site.css", Depth: 1, PureAsset: true, Metadata: &S.Metadata{StatusCode: 200, ContentType: "text/css"}}
+	ext := &G.Node{Url: "http://bar.com/docs/b", Depth: 2, External: true, Metadata: &S.Metadata{Error: "timeout"}}
+	orphan := &G.Node{Url: "http://foo.com/orphan", Depth: 1}
+	root.Out = []G.Edge{{Kind: G.EdgeKindAsset, Node: css}, {Kind: G.EdgeKindLink, Node: docs}, {Kind: G.EdgeKindSitemap, Node: orphan}}
+	docs.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: page}, {Kind: G.EdgeKindLink, Node: ext}}
+	return root
+}
+
+func TestExportDot(t *testing.T) {
+	dot := ExportDot(makeDotTestGraph(), DotOptions{})
+
+	expected := `digraph "http://foo.com/" {
+  node [style=filled];
+  "http://bar.com/docs/b" [label="http://bar.com/docs/b [timeout]", URL="http://bar.com/docs/b", shape=ellipse, fillcolor=orange, depth=2, pure_asset=false, external=true, error="timeout"];
+  "http://foo.com/" [label="http://foo.com/", URL="http://foo.com/", shape=ellipse, fillcolor=red, depth=0, pure_asset=false, external=false, status=200];
+  "http://foo.com/docs/" [label="/docs/", URL="http://foo.com/docs/", shape=ellipse, fillcolor=blue, depth=1, pure_asset=false, external=false, status=200];
+  "http://foo.com/docs/a?q=\"x\"" [label="/docs/a?q=\"x\" [404]", URL="http://foo.com/docs/a?q=\"x\"", shape=ellipse, fillcolor=orange, depth=2, pure_asset=false, external=false, status=404];
+  "http://foo.com/orphan" [label="/orphan", URL="http://foo.com/orphan", shape=ellipse, fillcolor=teal, depth=1, pure_asset=false, external=false];
+  "http://foo.com/site.css" [label="/site.css", URL="http://foo.com/site.css", shape=diamond, fillcolor=grey, depth=1, pure_asset=true, external=false, status=200];
+  "http://foo.com/" -> "http://foo.com/site.css" [kind=asset, color=grey];
+  "http://foo.com/" -> "http://foo.com/docs/" [kind=link, color=blue];
+  "http://foo.com/" -> "http://foo.com/orphan" [kind=sitemap, color=teal, style=dashed, constraint=false];
+  "http://foo.com/docs/" -> "http://foo.com/docs/a?q=\"x\"" [kind=link, color=blue];
+  "http://foo.com/docs/" -> "http://bar.com/docs/b" [kind=link, color=blue];
+}
+`
+	if dot != expected {
+		t.Errorf("Unexpected DOT output:\n%v\n", dot)
+	}
+}
+
+func TestExportDotClusters(t *testing.T) {
+	dot := ExportDot(makeDotTestGraph(), DotOptions{ClusterDepth: 1})
+
+	// Only /docs has more than one node; bar.com/docs is a different prefix.
+	if strings.Count(dot, "subgraph") != 1 || !strings.Contains(dot, "  subgraph cluster_0 {\n    label=\"/docs\";\n    \"http://foo.com/docs/\" [") || !strings.Contains(dot, "\n    \"http://foo.com/docs/a?q=") {
+		t.Errorf("Unexpected clusters:\n%v\n", dot)
+	}
+
+	type test struct {
+		displayed string
+		n         int
+		expected  string
+	}
+
+	tests := []test{
+		{"/", 1, "/"},
+		{"/docs", 1, "/docs"},
+		{"/docs/", 1, "/docs"},
+		{"/docs/a/b.html?q=a/b", 1, "/docs"},
+		{"/docs/a/b.html?q=a/b", 2, "/docs/a"},
+		{"/search?q=a/b", 2, "/search"},
+		{"http://bar.com/docs/b", 1, "http://bar.com/docs"},
+	}
+
+	for _, tst := range tests {
+		if actual := pathPrefix(tst.displayed, tst.n); actual != tst.expected {
+			t.Errorf("Expected prefix %v of %v to be %v; got %v\n", tst.n, tst.displayed, tst.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+const gexfNamespace = "http://gexf.net/1.3"
+
+type gexfFile struct {
+	XMLName        xml.Name  `xml:"gexf"`
+	Xmlns          string    `xml:"xmlns,attr"`
+	XmlnsXsi       string    `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation string    `xml:"xsi:schemaLocation,attr,omitempty"`
+	Version        string    `xml:"version,attr"`
+	Meta           gexfMeta  `xml:"meta"`
+	Graph          gexfGraph `xml:"graph"`
+}
+
+type gexfMeta struct {
+	Creator string `xml:"creator"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Mode            string           `xml:"mode,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	Id    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	Id        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	Id        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// WriteGexf writes the graph reachable from root to w in GEXF 1.3 format, for
+// Gephi. Each node is labelled with its URL and has the same attributes as in
+// WriteGraphML. Each edge is labelled with its kind, and also has it as the
+// kind attribute. The root is the first node.
+func WriteGexf(w io.Writer, root *G.Node) error {
+	file := gexfFile{
+		Xmlns:          gexfNamespace,
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: gexfNamespace + " http://gexf.net/1.3/gexf.xsd",
+		Version:        "1.3",
+		Meta:           gexfMeta{Creator: "GoCrawl"},
+		Graph:          gexfGraph{DefaultEdgeType: "directed", Mode: "static"},
+	}
+
+	nodeAttributeDecls := gexfAttributes{Class: "node"}
+	for _, a := range nodeAttributes {
+		nodeAttributeDecls.Attributes = append(nodeAttributeDecls.Attributes, gexfAttribute{Id: a.name, Title: a.name, Type: a.typ.gexfName()})
+	}
+	file.Graph.Attributes = []gexfAttributes{
+		nodeAttributeDecls,
+		{Class: "edge", Attributes: []gexfAttribute{{Id: "kind", Title: "kind", Type: "string"}}},
+	}
+
+	nodes := sortedNodes(root)
+	ids := make(map[*G.Node]string)
+	for i, node := range nodes {
+		ids[node] = fmt.Sprintf("n%v", i)
+	}
+
+	for _, node := range nodes {
+		n := gexfNode{Id: ids[node], Label: node.Url}
+		for _, a := range nodeAttributes {
+			if !a.metadata || node.Metadata != nil {
+				n.AttValues = append(n.AttValues, gexfAttValue{For: a.name, Value: a.get(node)})
+			}
+		}
+		file.Graph.Nodes = append(file.Graph.Nodes, n)
+
+		for _, e := range node.Out {
+			file.Graph.Edges = append(file.Graph.Edges, gexfEdge{
+				Id:        fmt.Sprintf("e%v", len(file.Graph.Edges)),
+				Source:    ids[node],
+				Target:    ids[e.Node],
+				Label:     e.Kind.String(),
+				AttValues: []gexfAttValue{{For: "kind", Value: e.Kind.String()}},
+			})
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(file); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadGexf reads a graph written by WriteGexf and returns its root node.
+// Attributes that WriteGexf doesn't write are ignored.
+func ReadGexf(r io.Reader) (*G.Node, error) {
+	var file gexfFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	if len(file.Graph.Nodes) == 0 {
+		return nil, fmt.Errorf("No nodes in GEXF file")
+	}
+
+	// The attribute values refer to the attributes by id, which needn't be
+	// the same as their titles in files written by other tools.
+	titles := make(map[string]map[string]string)
+	for _, decls := range file.Graph.Attributes {
+		if titles[decls.Class] == nil {
+			titles[decls.Class] = make(map[string]string)
+		}
+		for _, a := range decls.Attributes {
+			titles[decls.Class][a.Id] = a.Title
+		}
+	}
+
+	idToNode := make(map[string]*G.Node)
+	for _, n := range file.Graph.Nodes {
+		values := make(map[string]string)
+		for _, v := range n.AttValues {
+			values[titles["node"][v.For]] = v.Value
+		}
+
+		node := &G.Node{Url: n.Label, Out: []G.Edge{}}
+		if node.Url == "" {
+			return nil, fmt.Errorf("Node %v has no label", n.Id)
+		}
+		if err := setNodeAttributes(node, values); err != nil {
+			return nil, err
+		}
+		idToNode[n.Id] = node
+	}
+
+	for _, e := range file.Graph.Edges {
+		from, to := idToNode[e.Source], idToNode[e.Target]
+		if from == nil || to == nil {
+			return nil, fmt.Errorf("Edge from %v to %v refers to unknown node", e.Source, e.Target)
+		}
+
+		kind := G.EdgeKindLink
+		for _, v := range e.AttValues {
+			if titles["edge"][v.For] == "kind" {
+				if err := kind.UnmarshalText([]byte(v.Value)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		from.Out = append(from.Out, G.Edge{Kind: kind, Node: to})
+	}
+
+	return idToNode[file.Graph.Nodes[0].Id], nil
+}
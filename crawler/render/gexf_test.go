@@ -0,0 +1,41 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGexfRoundTrip(t *testing.T) {
+	root := makeExportTestGraph()
+
+	var buf bytes.Buffer
+	if err := WriteGexf(&buf, root); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		`<gexf xmlns="http://gexf.net/1.3"`,
+		`version="1.3"`,
+		`<graph defaultedgetype="directed" mode="static">`,
+		`<attributes class="node">`,
+		`<attribute id="depth" title="depth" type="integer"></attribute>`,
+		`<attribute id="external" title="external" type="boolean"></attribute>`,
+		`<attribute id="response_time_ms" title="response_time_ms" type="long"></attribute>`,
+		`<attribute id="betweenness" title="betweenness" type="double"></attribute>`,
+		`<node id="n0" label="http://foo.com/">`,
+		`<attvalue for="title" value="Foo &amp; &lt;Bar&gt;"></attvalue>`,
+		`<edge id="e0" source="n0" target="n4" label="seed">`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected GEXF output to contain %v:\n%v\n", expected, output)
+		}
+	}
+
+	read, err := ReadGexf(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error reading GEXF: %v\n", err)
+	}
+	checkRoundTrip(t, "GEXF", root, read)
+}
@@ -0,0 +1,163 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+const graphmlNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphmlFile struct {
+	XMLName        xml.Name     `xml:"graphml"`
+	Xmlns          string       `xml:"xmlns,attr"`
+	XmlnsXsi       string       `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation string       `xml:"xsi:schemaLocation,attr,omitempty"`
+	Keys           []graphmlKey `xml:"key"`
+	Graph          graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	Id   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	Id          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph reachable from root to w in GraphML format,
+// for tools such as yEd and Gephi. Each node has a label attribute with its
+// URL, the attributes depth, popularity, pagerank, hub_score, authority_score,
+// betweenness, pure_asset, external, aliases (separated by spaces) and loaded,
+// and, if it was loaded, status_code, content_type, content_length,
+// response_time_ms, last_modified, redirect_url, canonical_url, title, error,
+// retry_after_ms and attempts. Each edge has a kind attribute, which is
+// "link", "asset", "sitemap" or "seed". The root is the first node.
+func WriteGraphML(w io.Writer, root *G.Node) error {
+	file := graphmlFile{
+		Xmlns:          graphmlNamespace,
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: graphmlNamespace + " http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd",
+		Keys:           []graphmlKey{{Id: "label", For: "node", Name: "label", Type: "string"}},
+		Graph:          graphmlGraph{Id: "G", EdgeDefault: "directed"},
+	}
+	for _, a := range nodeAttributes {
+		file.Keys = append(file.Keys, graphmlKey{Id: a.name, For: "node", Name: a.name, Type: a.typ.graphmlName()})
+	}
+	file.Keys = append(file.Keys, graphmlKey{Id: "kind", For: "edge", Name: "kind", Type: "string"})
+
+	nodes := sortedNodes(root)
+	ids := make(map[*G.Node]string)
+	for i, node := range nodes {
+		ids[node] = fmt.Sprintf("n%v", i)
+	}
+
+	for _, node := range nodes {
+		n := graphmlNode{Id: ids[node], Data: []graphmlData{{Key: "label", Value: node.Url}}}
+		for _, a := range nodeAttributes {
+			if !a.metadata || node.Metadata != nil {
+				n.Data = append(n.Data, graphmlData{Key: a.name, Value: a.get(node)})
+			}
+		}
+		file.Graph.Nodes = append(file.Graph.Nodes, n)
+
+		for _, e := range node.Out {
+			file.Graph.Edges = append(file.Graph.Edges, graphmlEdge{
+				Source: ids[node],
+				Target: ids[e.Node],
+				Data:   []graphmlData{{Key: "kind", Value: e.Kind.String()}},
+			})
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(file); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadGraphML reads a graph written by WriteGraphML and returns its root node.
+// Attributes that WriteGraphML doesn't write are ignored.
+func ReadGraphML(r io.Reader) (*G.Node, error) {
+	var file graphmlFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	if len(file.Graph.Nodes) == 0 {
+		return nil, fmt.Errorf("No nodes in GraphML file")
+	}
+
+	// The data elements refer to the keys by id, which needn't be the same as
+	// their names in files written by other tools.
+	keyNames := make(map[string]string)
+	for _, k := range file.Keys {
+		keyNames[k.Id] = k.Name
+	}
+
+	idToNode := make(map[string]*G.Node)
+	for _, n := range file.Graph.Nodes {
+		values := make(map[string]string)
+		for _, d := range n.Data {
+			values[keyNames[d.Key]] = d.Value
+		}
+
+		node := &G.Node{Url: values["label"], Out: []G.Edge{}}
+		if node.Url == "" {
+			return nil, fmt.Errorf("Node %v has no label", n.Id)
+		}
+		if err := setNodeAttributes(node, values); err != nil {
+			return nil, err
+		}
+		idToNode[n.Id] = node
+	}
+
+	for _, e := range file.Graph.Edges {
+		from, to := idToNode[e.Source], idToNode[e.Target]
+		if from == nil || to == nil {
+			return nil, fmt.Errorf("Edge from %v to %v refers to unknown node", e.Source, e.Target)
+		}
+
+		kind := G.EdgeKindLink
+		for _, d := range e.Data {
+			if keyNames[d.Key] == "kind" {
+				if err := kind.UnmarshalText([]byte(d.Value)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		from.Out = append(from.Out, G.Edge{Kind: kind, Node: to})
+	}
+
+	return idToNode[file.Graph.Nodes[0].Id], nil
+}
@@ -0,0 +1,100 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+// makeExportTestGraph makes a graph with every kind of edge and every
+// attribute that the GraphML and GEXF formats carry.
+func makeExportTestGraph() *G.Node {
+	root := &G.Node{Url: "http://foo.com/", Out: []G.Edge{}, Popularity: 1, PageRank: 0.3, HubScore: 0.25, AuthorityScore: 1.0 / 3, Betweenness: 0.5, Metadata: &S.Metadata{
+		StatusCode: 200, ContentType: "text/html; charset=utf-8", ContentLength: -1, ResponseTime: 120 * time.Millisecond, Title: "Foo & <Bar>",
+	}}
+	seed := &G.Node{Url: "http://foo.com/start?a=1&b=2", Out: []G.Edge{}, Popularity: 1, Aliases: []string{"http://foo.com/start?b=2&a=1", "http://foo.com/Start?a=1&b=2"}, Metadata: &S.Metadata{
+		StatusCode: 200, ContentType: "text/html", ContentLength: 512, LastModified: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		RedirectUrl: "http://foo.com/started", CanonicalUrl: "http://foo.com/start", RetryAfter: 2 * time.Second, CrawlDelay: time.Second, Attempts: 3,
+	}}
+	css := &G.Node{Url: "http://foo.com/site.css", Out: []G.Edge{}, Depth: 1, Popularity: 2, PureAsset: true, Metadata: &S.Metadata{
+		StatusCode: 200, ContentType: "text/css", ContentLength: 100,
+	}}
+	ext := &G.Node{Url: "http://bar.com/\"quoted\"", Out: []G.Edge{}, Depth: 1, Popularity: 1, External: true, Metadata: &S.Metadata{
+		ContentLength: -1, Error: "timeout",
+	}}
+	orphan := &G.Node{Url: "http://foo.com/orphan", Out: []G.Edge{}, Depth: 1, Popularity: 1}
+	root.Out = []G.Edge{{Kind: G.EdgeKindSeed, Node: seed}, {Kind: G.EdgeKindAsset, Node: css}, {Kind: G.EdgeKindLink, Node: ext}, {Kind: G.EdgeKindSitemap, Node: orphan}}
+	seed.Out = []G.Edge{{Kind: G.EdgeKindAsset, Node: css}, {Kind: G.EdgeKindLink, Node: root}}
+	return root
+}
+
+func checkRoundTrip(t *testing.T, format string, expected, actual *G.Node) {
+	expectedJson, _ := json.Marshal(G.ToCrawlFile(G.CrawlInfo{}, expected))
+	actualJson, _ := json.Marshal(G.ToCrawlFile(G.CrawlInfo{}, actual))
+	if string(expectedJson) != string(actualJson) {
+		t.Errorf("Graph changed by %v round trip:\n%s\nExpected:\n%s\n", format, actualJson, expectedJson)
+	}
+
+	// The crawl file doesn't include the metrics.
+	if expected.PageRank != actual.PageRank || expected.HubScore != actual.HubScore || expected.AuthorityScore != actual.AuthorityScore || expected.Betweenness != actual.Betweenness {
+		t.Errorf("Metrics changed by %v round trip: %+v\n", format, actual)
+	}
+}
+
+func TestGraphMLRoundTrip(t *testing.T) {
+	root := makeExportTestGraph()
+
+	var buf bytes.Buffer
+	if err := WriteGraphML(&buf, root); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		`<graphml xmlns="http://graphml.graphdrawing.org/xmlns"`,
+		`<key id="depth" for="node" attr.name="depth" attr.type="int"></key>`,
+		`<key id="pure_asset" for="node" attr.name="pure_asset" attr.type="boolean"></key>`,
+		`<key id="content_length" for="node" attr.name="content_length" attr.type="long"></key>`,
+		`<key id="pagerank" for="node" attr.name="pagerank" attr.type="double"></key>`,
+		`<key id="kind" for="edge" attr.name="kind" attr.type="string"></key>`,
+		`<graph id="G" edgedefault="directed">`,
+		`<data key="title">Foo &amp; &lt;Bar&gt;</data>`,
+		`<edge source="n0" target="n4">`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected GraphML output to contain %v:\n%v\n", expected, output)
+		}
+	}
+
+	// The node that wasn't loaded has no response attributes.
+	if strings.Count(output, `<data key="status_code">`) != 4 {
+		t.Errorf("Expected 4 status codes:\n%v\n", output)
+	}
+
+	read, err := ReadGraphML(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error reading GraphML: %v\n", err)
+	}
+	checkRoundTrip(t, "GraphML", root, read)
+}
+
+func TestReadGraphMLErrors(t *testing.T) {
+	tests := []string{
+		`<graphml`,
+		`<graphml><graph edgedefault="directed"></graph></graphml>`,
+		`<graphml><key id="d0" for="node" attr.name="label" attr.type="string"></key><graph edgedefault="directed"><node id="a"><data key="d0">http://foo.com/</data></node><edge source="a" target="b"></edge></graph></graphml>`,
+		`<graphml><key id="d0" for="node" attr.name="label" attr.type="string"></key><key id="d1" for="node" attr.name="depth" attr.type="int"></key><graph edgedefault="directed"><node id="a"><data key="d0">http://foo.com/</data><data key="d1">x</data></node></graph></graphml>`,
+		`<graphml><key id="d0" for="node" attr.name="label" attr.type="string"></key><key id="d1" for="node" attr.name="title" attr.type="string"></key><graph edgedefault="directed"><node id="a"><data key="d0">http://foo.com/</data><data key="d1">Foo</data></node></graph></graphml>`,
+	}
+
+	for _, tst := range tests {
+		if _, err := ReadGraphML(strings.NewReader(tst)); err == nil {
+			t.Errorf("Expected an error reading %v\n", tst)
+		}
+	}
+}
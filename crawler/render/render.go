@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 
+	D "multiverse.io/crawler/crawler/diff"
 	G "multiverse.io/crawler/crawler/graph"
 )
 
@@ -19,11 +21,41 @@ type NodeMetadata struct {
 	Depth      int
 	Popularity int
 	PureAsset  bool
+	External   bool
+
+	// From graph.ComputeMetrics; zero in a diff.
+	PageRank       float64
+	HubScore       float64
+	AuthorityScore float64
+	Betweenness    float64
+
+	// The following are zero values if the node wasn't loaded.
+	Loaded         bool
+	Broken         bool
+	StatusCode     int
+	ContentType    string
+	ContentLength  int64
+	ResponseTimeMs int64
+	RedirectUrl    string
+	Error          string
+
+	// Other URLs for the resource that were merged into this node.
+	Aliases []string
+
+	// "added", "removed", "changed" or "unchanged" in a diff; empty otherwise.
+	DiffStatus string
+
+	// "linked only", "sitemap only" or "both" if the crawl used the site's
+	// sitemaps and the node is a page; empty otherwise.
+	Sitemap string
 }
 
 type Link struct {
 	IsAsset bool
 	ToUrl   string
+
+	// "added", "removed" or "unchanged" in a diff; empty otherwise.
+	DiffStatus string
 }
 
 type GraphJson struct {
@@ -35,10 +67,23 @@ func GraphToJson(node *G.Node) GraphJson {
 	links := make(map[string][]Link)
 	nodeMetadata := make(map[string]NodeMetadata)
 
+	// There's an edge from the root to every page in the sitemap, which would
+	// swamp the graph, so we show whether each page is in the sitemap instead.
+	// Likewise, the other seeds are shown as roots rather than being linked to
+	// from the root.
+	sitemapStatuses := G.SitemapStatuses(node)
+	usedSitemap := false
+	for _, status := range sitemapStatuses {
+		if status == G.SitemapStatusSitemapOnly || status == G.SitemapStatusBoth {
+			usedSitemap = true
+			break
+		}
+	}
+
 	G.Traverse(node, func(node *G.Node) {
 		links[node.Url] = []Link{}
 		for _, out := range node.Out {
-			if out.Node == node {
+			if out.Node == node || out.Kind == G.EdgeKindSitemap || out.Kind == G.EdgeKindSeed {
 				continue
 			}
 
@@ -50,12 +95,34 @@ func GraphToJson(node *G.Node) GraphJson {
 					})
 		}
 
-		nodeMetadata[node.Url] =
-			NodeMetadata{
-				Depth:      node.Depth,
-				Popularity: node.Popularity,
-				PureAsset:  node.PureAsset,
-			}
+		md := NodeMetadata{
+			Depth:          node.Depth,
+			Popularity:     node.Popularity,
+			PureAsset:      node.PureAsset,
+			External:       node.External,
+			PageRank:       node.PageRank,
+			HubScore:       node.HubScore,
+			AuthorityScore: node.AuthorityScore,
+			Betweenness:    node.Betweenness,
+			Aliases:        node.Aliases,
+		}
+
+		if status := sitemapStatuses[node]; usedSitemap && status != G.SitemapStatusNone {
+			md.Sitemap = status.String()
+		}
+
+		if m := node.Metadata; m != nil {
+			md.Loaded = true
+			md.Broken = m.IsBroken()
+			md.StatusCode = m.StatusCode
+			md.ContentType = m.ContentType
+			md.ContentLength = m.ContentLength
+			md.ResponseTimeMs = m.ResponseTime.Milliseconds()
+			md.RedirectUrl = m.RedirectUrl
+			md.Error = m.Error
+		}
+
+		nodeMetadata[node.Url] = md
 	})
 
 	return GraphJson{
@@ -64,19 +131,92 @@ func GraphToJson(node *G.Node) GraphJson {
 	}
 }
 
+// DiffToJson converts a diff to the same form as GraphToJson, using the
+// metadata from the new crawl for pages that weren't removed. URLs are
+// relative to the roots of the crawls.
+func DiffToJson(d D.Diff) GraphJson {
+	links := make(map[string][]Link)
+	nodeMetadata := make(map[string]NodeMetadata)
+
+	for _, p := range d.Pages {
+		links[p.Url] = []Link{}
+		for _, l := range p.Links {
+			if l.Url == p.Url || l.Kind == G.EdgeKindSitemap || l.Kind == G.EdgeKindSeed {
+				continue
+			}
+
+			links[p.Url] =
+				append(links[p.Url],
+					Link{
+						IsAsset:    l.Kind == G.EdgeKindAsset,
+						ToUrl:      l.Url,
+						DiffStatus: l.Status.String(),
+					})
+		}
+
+		info := p.New
+		if info == nil {
+			info = p.Old
+		}
+
+		nodeMetadata[p.Url] = NodeMetadata{
+			Depth:      info.Depth,
+			Popularity: info.Popularity,
+			PureAsset:  info.PureAsset,
+			Loaded:     info.StatusCode != 0,
+			StatusCode: info.StatusCode,
+			DiffStatus: p.Status.String(),
+		}
+	}
+
+	return GraphJson{
+		Links:        links,
+		NodeMetadata: nodeMetadata,
+	}
+}
+
+type HtmlOptions struct {
+	// The metric that nodes are sized by: "popularity", "pagerank", "hub",
+	// "authority" or "betweenness". If empty, nodes are all the same size.
+	SizeBy string
+}
+
+// SizeMetrics are the values of HtmlOptions.SizeBy other than "".
+var SizeMetrics = []string{"popularity", "pagerank", "hub", "authority", "betweenness"}
+
 func ExportHtml(node *G.Node) string {
+	return ExportHtmlWithOptions(node, HtmlOptions{})
+}
+
+// ExportHtmlWithOptions is like ExportHtml, but takes additional options.
+func ExportHtmlWithOptions(node *G.Node, options HtmlOptions) string {
 	parsed, _ := url.Parse(node.Url)
 	var stripPrefix string = parsed.Scheme + "://" + parsed.Host + "/"
-	stripPrefixJson, _ := json.Marshal(stripPrefix)
 
-	graphJson := GraphToJson(node)
+	var rootUrls []string
+	for _, r := range G.Roots(node) {
+		rootUrls = append(rootUrls, r.Url)
+	}
+
+	return exportHtml("Graph for "+strings.Join(rootUrls, ", "), stripPrefix, options.SizeBy, GraphToJson(node))
+}
+
+// ExportDiffHtml renders a diff as a graph, with added, removed and changed
+// pages and links highlighted.
+func ExportDiffHtml(d D.Diff) string {
+	return exportHtml("Diff of "+d.OldRoot+" and "+d.NewRoot, "", "", DiffToJson(d))
+}
+
+func exportHtml(title, stripPrefix, sizeBy string, graphJson GraphJson) string {
+	stripPrefixJson, _ := json.Marshal(stripPrefix)
+	sizeByJson, _ := json.Marshal(sizeBy)
 	marshaledLinks, _ := json.Marshal(graphJson.Links)
 	marshaledNodeMetadata, _ := json.Marshal(graphJson.NodeMetadata)
 	return fmt.Sprintf(`
 	<!DOCTYPE html>
 	<html>
 	<head>
-	  <title>Graph for %s</title>
+	  <title>%s</title>
 		<style>
 		  body {
 				width: 100vw;
@@ -92,6 +232,7 @@ func ExportHtml(node *G.Node) string {
 		</script>
 		<script>
 		const STRIP_PREFIX = %s;
+		const SIZE_BY = %s;
 		const GRAPH = %s;
 		const NODE_METADATA = %s;
 		</script>
@@ -102,5 +243,5 @@ func ExportHtml(node *G.Node) string {
 	<body>
 	</body>
 	</html>
-	`, node.Url, cytoscapeSrc, stripPrefixJson, marshaledLinks, marshaledNodeMetadata, renderSrc)
+	`, title, cytoscapeSrc, stripPrefixJson, sizeByJson, marshaledLinks, marshaledNodeMetadata, renderSrc)
 }
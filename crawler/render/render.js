@@ -1,9 +1,22 @@
 const COL_WIDTH = 5;
+const SLOW_RESPONSE_MS = 1000;
+const MIN_NODE_SIZE = 30;
+const MAX_NODE_SIZE = 300;
+
+// The NODE_METADATA fields of the metrics that nodes can be sized by.
+const SIZE_METRICS = {
+  popularity: 'Popularity',
+  pagerank: 'PageRank',
+  hub: 'HubScore',
+  authority: 'AuthorityScore',
+  betweenness: 'Betweenness'
+};
 
 function renderGraph() {
   let graph = makeInitialGraph();
 
   const nodeToRow = getNodeRows(GRAPH, NODE_METADATA);
+  const maxMetric = getMaxMetric(NODE_METADATA, SIZE_BY);
 
   let i = 0;
   for (const k of Object.keys(GRAPH)) {
@@ -12,11 +25,14 @@ function renderGraph() {
     graph.elements.push({
       data: {
         id: k,
-        label: sk,
+        label: nodeLabel(sk, NODE_METADATA[k]),
         col: getNodeCol(NODE_METADATA[k].Depth, i),
         row: nodeToRow[k],
         color: nodeColor(NODE_METADATA[k]),
-        labelColor: labelColor(NODE_METADATA[k])
+        labelColor: labelColor(NODE_METADATA[k]),
+        shape: nodeShape(NODE_METADATA[k]),
+        borderWidth: isSlow(NODE_METADATA[k]) ? 20 : 0,
+        size: nodeSize(NODE_METADATA[k], SIZE_BY, maxMetric)
       }
     });
 
@@ -25,7 +41,7 @@ function renderGraph() {
         data: {
           source: k,
           target: links.ToUrl,
-          color: arrowColor(links.IsAsset)
+          color: arrowColor(links)
         }
       });
     }
@@ -57,7 +73,12 @@ function makeInitialGraph() {
           label: 'data(label)',
           color: 'data(labelColor)',
           'font-size': '50pt',
-          'background-color': 'data(color)'
+          'background-color': 'data(color)',
+          shape: 'data(shape)',
+          'border-width': 'data(borderWidth)',
+          'border-color': 'gold',
+          width: 'data(size)',
+          height: 'data(size)'
         }
       },
       {
@@ -76,24 +97,92 @@ function makeInitialGraph() {
   };
 }
 
+const DIFF_COLORS = {added: 'green', removed: 'purple', changed: 'gold'};
+const DIFF_LABEL_COLORS = {added: 'darkgreen', removed: 'purple', changed: 'darkgoldenrod'};
+
 function nodeColor(metadata) {
+  if (DIFF_COLORS[metadata.DiffStatus])
+    return DIFF_COLORS[metadata.DiffStatus];
   if (metadata.Depth == 0)
     return 'red';
+  if (metadata.Broken)
+    return 'orange';
+  if (metadata.External)
+    return 'violet';
+  if (metadata.Sitemap == 'sitemap only')
+    return 'teal';
   if (metadata.PureAsset)
     return 'grey';
   return 'blue';
 }
 
 function labelColor(metadata) {
+  if (DIFF_LABEL_COLORS[metadata.DiffStatus])
+    return DIFF_LABEL_COLORS[metadata.DiffStatus];
   if (metadata.Depth == 0)
     return 'red';
+  if (metadata.Broken)
+    return 'darkorange';
+  if (metadata.External)
+    return 'darkviolet';
+  if (metadata.Sitemap == 'sitemap only')
+    return 'teal';
   if (metadata.PureAsset)
     return 'darkgrey';
   return 'darkblue';
 }
 
-function arrowColor(isAsset) {
-  if (isAsset)
+// Broken nodes are labeled with their status code (or error), and slow nodes
+// with their response time. Nodes that other URLs were merged into show how
+// many there were.
+function nodeLabel(url, metadata) {
+  let label = url;
+  if (metadata.Broken)
+    label += ' [' + (metadata.StatusCode || metadata.Error) + ']';
+  else if (isSlow(metadata))
+    label += ' [' + metadata.ResponseTimeMs + 'ms]';
+  if (metadata.Aliases && metadata.Aliases.length > 0)
+    label += ' (+' + metadata.Aliases.length + ' aliases)';
+  return label;
+}
+
+// Loaded resources that aren't HTML are shown as diamonds.
+function nodeShape(metadata) {
+  if (metadata.Loaded && !metadata.Broken && metadata.ContentType.indexOf('text/html') != 0)
+    return 'diamond';
+  return 'ellipse';
+}
+
+function isSlow(metadata) {
+  return metadata.Loaded && metadata.ResponseTimeMs >= SLOW_RESPONSE_MS;
+}
+
+// The largest value of the metric that nodes are sized by, or 0 if they aren't.
+function getMaxMetric(nodeMetadata, sizeBy) {
+  const field = SIZE_METRICS[sizeBy];
+  let max = 0;
+  if (field) {
+    for (const metadata of Object.values(nodeMetadata))
+      max = Math.max(max, metadata[field] || 0);
+  }
+  return max;
+}
+
+// Nodes are sized so that their area is proportional to the chosen metric,
+// relative to the node with its largest value. Nodes are all the smallest size
+// if no metric is chosen.
+function nodeSize(metadata, sizeBy, maxMetric) {
+  const field = SIZE_METRICS[sizeBy];
+  if (!field || !(maxMetric > 0))
+    return MIN_NODE_SIZE;
+  const fraction = Math.sqrt((metadata[field] || 0) / maxMetric);
+  return MIN_NODE_SIZE + fraction * (MAX_NODE_SIZE - MIN_NODE_SIZE);
+}
+
+function arrowColor(link) {
+  if (DIFF_COLORS[link.DiffStatus])
+    return DIFF_COLORS[link.DiffStatus];
+  if (link.IsAsset)
     return 'grey';
   return 'blue';
 }
@@ -146,4 +235,11 @@ if (typeof exports == 'undefined') {
 } else {
   exports.displayUrl = displayUrl;
   exports.getNodeRows = getNodeRows;
+  exports.nodeLabel = nodeLabel;
+  exports.nodeShape = nodeShape;
+  exports.nodeColor = nodeColor;
+  exports.labelColor = labelColor;
+  exports.arrowColor = arrowColor;
+  exports.getMaxMetric = getMaxMetric;
+  exports.nodeSize = nodeSize;
 }
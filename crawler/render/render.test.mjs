@@ -1,5 +1,5 @@
 import { expect } from 'chai'
-import { displayUrl, getNodeRows } from './render.js' 
+import { displayUrl, getNodeRows, nodeLabel, nodeShape, nodeColor, labelColor, arrowColor, getMaxMetric, nodeSize } from './render.js' 
 
 describe('displayUrl', () => {
   it('yields empty string if stripping empty string from empty string', () => {
@@ -44,3 +44,88 @@ describe('getNodeRows', () => {
     expect(rows).to.deep.equal(expectedOrder);
   });
 });
+
+describe('nodeLabel', () => {
+  it('yields the URL for a node that loaded quickly', () => {
+    expect(nodeLabel("/foo", {Loaded: true, StatusCode: 200, ResponseTimeMs: 10})).to.equal("/foo");
+  });
+  it('yields the URL for a node that was not loaded', () => {
+    expect(nodeLabel("/foo", {Loaded: false})).to.equal("/foo");
+  });
+  it('includes the status code or error for a broken node', () => {
+    expect(nodeLabel("/foo", {Loaded: true, Broken: true, StatusCode: 404})).to.equal("/foo [404]");
+    expect(nodeLabel("/foo", {Loaded: true, Broken: true, StatusCode: 0, Error: "timeout"})).to.equal("/foo [timeout]");
+  });
+  it('includes the response time for a slow node', () => {
+    expect(nodeLabel("/foo", {Loaded: true, StatusCode: 200, ResponseTimeMs: 2500})).to.equal("/foo [2500ms]");
+  });
+  it('shows the number of aliases', () => {
+    expect(nodeLabel("/foo", {Loaded: true, StatusCode: 200, ResponseTimeMs: 10, Aliases: ["/foo/", "/Foo"]})).to.equal("/foo (+2 aliases)");
+    expect(nodeLabel("/foo", {Loaded: true, Broken: true, StatusCode: 404, Aliases: ["/foo/"]})).to.equal("/foo [404] (+1 aliases)");
+    expect(nodeLabel("/foo", {Loaded: true, StatusCode: 200, ResponseTimeMs: 10, Aliases: null})).to.equal("/foo");
+  });
+});
+
+describe('nodeShape', () => {
+  it('yields a diamond for loaded resources that are not HTML', () => {
+    expect(nodeShape({Loaded: true, ContentType: "application/pdf"})).to.equal("diamond");
+    expect(nodeShape({Loaded: true, ContentType: "text/html; charset=utf-8"})).to.equal("ellipse");
+    expect(nodeShape({Loaded: false, ContentType: ""})).to.equal("ellipse");
+  });
+});
+
+describe('nodeColor', () => {
+  it('colors the root red', () => {
+    expect(nodeColor({Depth: 0})).to.equal("red");
+  });
+  it('colors added, removed and changed pages in a diff', () => {
+    expect(nodeColor({Depth: 0, DiffStatus: "changed"})).to.equal("gold");
+    expect(nodeColor({Depth: 1, DiffStatus: "added"})).to.equal("green");
+    expect(nodeColor({Depth: 1, DiffStatus: "removed"})).to.equal("purple");
+    expect(nodeColor({Depth: 1, DiffStatus: "unchanged"})).to.equal("blue");
+  });
+  it('colors pages that are only in the sitemap teal', () => {
+    expect(nodeColor({Depth: 1, Sitemap: "sitemap only"})).to.equal("teal");
+    expect(nodeColor({Depth: 1, Sitemap: "both"})).to.equal("blue");
+    expect(nodeColor({Depth: 1, Broken: true, Sitemap: "sitemap only"})).to.equal("orange");
+  });
+  it('colors external links violet unless they are broken', () => {
+    expect(nodeColor({Depth: 1, External: true, Loaded: true, StatusCode: 200})).to.equal("violet");
+    expect(nodeColor({Depth: 1, External: true, Loaded: true, Broken: true, StatusCode: 404})).to.equal("orange");
+    expect(labelColor({Depth: 1, External: true})).to.equal("darkviolet");
+  });
+});
+
+describe('arrowColor', () => {
+  it('colors links and assets', () => {
+    expect(arrowColor({IsAsset: true, DiffStatus: ""})).to.equal("grey");
+    expect(arrowColor({IsAsset: false, DiffStatus: ""})).to.equal("blue");
+  });
+  it('colors added and removed links in a diff', () => {
+    expect(arrowColor({IsAsset: true, DiffStatus: "added"})).to.equal("green");
+    expect(arrowColor({IsAsset: false, DiffStatus: "removed"})).to.equal("purple");
+    expect(arrowColor({IsAsset: false, DiffStatus: "unchanged"})).to.equal("blue");
+  });
+});
+
+describe('nodeSize', () => {
+  const metadata = {A: {PageRank: 0.5, Popularity: 1}, B: {PageRank: 0.125, Popularity: 3}, C: {PageRank: 0, Popularity: 0}};
+
+  it('finds the largest value of the chosen metric', () => {
+    expect(getMaxMetric(metadata, 'pagerank')).to.equal(0.5);
+    expect(getMaxMetric(metadata, 'popularity')).to.equal(3);
+    expect(getMaxMetric(metadata, '')).to.equal(0);
+  });
+  it('gives every node the smallest size if no metric is chosen', () => {
+    expect(nodeSize(metadata.A, '', 0)).to.equal(30);
+    expect(nodeSize(metadata.A, 'unknown', 0.5)).to.equal(30);
+  });
+  it('makes the area of a node proportional to the metric', () => {
+    expect(nodeSize(metadata.A, 'pagerank', 0.5)).to.equal(300);
+    expect(nodeSize(metadata.B, 'pagerank', 0.5)).to.equal(165);
+    expect(nodeSize(metadata.C, 'pagerank', 0.5)).to.equal(30);
+  });
+  it('copes with a metric that is zero for every node', () => {
+    expect(nodeSize(metadata.C, 'betweenness', 0)).to.equal(30);
+  });
+});
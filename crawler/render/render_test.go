@@ -3,8 +3,11 @@ package render
 import (
 	"strings"
 	"testing"
+	"time"
 
+	D "multiverse.io/crawler/crawler/diff"
 	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
 )
 
 func TestGraphToJson(t *testing.T) {
@@ -52,6 +55,88 @@ func TestGraphToJson(t *testing.T) {
 	if !hasExpectedMetadata {
 		t.Errorf("Bad node metadata %+v\n", json.NodeMetadata)
 	}
+
+	hasExpectedResponseMetadata :=
+		json.NodeMetadata["A"].Loaded &&
+			!json.NodeMetadata["A"].Broken &&
+			json.NodeMetadata["A"].StatusCode == 200 &&
+			json.NodeMetadata["A"].ContentType == "text/html" &&
+			json.NodeMetadata["A"].ContentLength == 1234 &&
+			json.NodeMetadata["A"].ResponseTimeMs == 1500 &&
+			json.NodeMetadata["B"].Loaded &&
+			json.NodeMetadata["B"].Broken &&
+			json.NodeMetadata["B"].StatusCode == 404 &&
+			!json.NodeMetadata["D"].Loaded
+
+	if !hasExpectedResponseMetadata {
+		t.Errorf("Bad response metadata %+v\n", json.NodeMetadata)
+	}
+
+	if json.NodeMetadata["A"].Sitemap != "" {
+		t.Errorf("Unexpected sitemap status without a sitemap: %v\n", json.NodeMetadata["A"].Sitemap)
+	}
+}
+
+func TestGraphToJsonWithMetrics(t *testing.T) {
+	root := makeTestGraph()
+	G.ComputeMetrics(G.NewGraph(root), G.MetricsOptions{})
+
+	json := GraphToJson(root)
+	if md := json.NodeMetadata["A"]; md.PageRank != root.PageRank || md.HubScore != root.HubScore || md.PageRank == 0 || md.HubScore == 0 {
+		t.Errorf("Unexpected metrics for A: %+v\n", md)
+	}
+	if md := json.NodeMetadata["C"]; md.AuthorityScore == 0 || md.HubScore != 0 {
+		t.Errorf("Unexpected metrics for C: %+v\n", md)
+	}
+	if md := json.NodeMetadata["D"]; md.PageRank != 0 || md.AuthorityScore != 0 {
+		t.Errorf("Expected no metrics for a pure asset; got %+v\n", md)
+	}
+}
+
+func TestGraphToJsonWithSitemap(t *testing.T) {
+	root := makeTestGraph()
+	e := &G.Node{Url: "E", Depth: 1}
+	var b *G.Node
+	for _, out := range root.Out {
+		if out.Node.Url == "B" {
+			b = out.Node
+		}
+	}
+	root.Out = append(root.Out, G.Edge{Kind: G.EdgeKindSitemap, Node: b}, G.Edge{Kind: G.EdgeKindSitemap, Node: e})
+
+	json := GraphToJson(root)
+
+	// Sitemap edges aren't drawn.
+	if len(json.Links["A"]) != 2 {
+		t.Errorf("Expected 2 links from A, got %+v\n", json.Links["A"])
+	}
+
+	expected := map[string]string{"A": "linked only", "B": "both", "C": "linked only", "D": "", "E": "sitemap only"}
+	for url, status := range expected {
+		if json.NodeMetadata[url].Sitemap != status {
+			t.Errorf("Expected sitemap status '%v' for %v, got '%v'\n", status, url, json.NodeMetadata[url].Sitemap)
+		}
+	}
+}
+
+func TestGraphToJsonWithSeeds(t *testing.T) {
+	root := makeTestGraph()
+	e := &G.Node{Url: "E", Depth: 0}
+	root.Out = append(root.Out, G.Edge{Kind: G.EdgeKindSeed, Node: e})
+
+	json := GraphToJson(root)
+
+	// Seed edges aren't drawn, but the seeds are roots.
+	if len(json.Links["A"]) != 2 {
+		t.Errorf("Expected 2 links from A, got %+v\n", json.Links["A"])
+	}
+	if md, ok := json.NodeMetadata["E"]; !ok || md.Depth != 0 {
+		t.Errorf("Expected E to be a root, got %+v\n", md)
+	}
+
+	if html := ExportHtml(root); !strings.Contains(html, "<title>Graph for A, E</title>") {
+		t.Errorf("Expected the title to list the seeds\n")
+	}
 }
 
 func TestExportHtml(t *testing.T) {
@@ -62,6 +147,46 @@ func TestExportHtml(t *testing.T) {
 	if !(strings.Contains(html, "<!DOCTYPE html>") && strings.Contains(html, "const STRIP_PREFIX =") && strings.Contains(html, "const GRAPH =") && strings.Contains(html, "const NODE_METADATA =")) {
 		t.Errorf("Bad html output.\n")
 	}
+
+	if !strings.Contains(html, `const SIZE_BY = "";`) {
+		t.Errorf("Expected nodes not to be sized by default.\n")
+	}
+
+	if html := ExportHtmlWithOptions(root, HtmlOptions{SizeBy: "pagerank"}); !strings.Contains(html, `const SIZE_BY = "pagerank";`) {
+		t.Errorf("Expected nodes to be sized by PageRank.\n")
+	}
+}
+
+func TestDiffToJson(t *testing.T) {
+	oldRoot := makeTestGraph()
+	newRoot := makeTestGraph()
+	// Remove the link from B to C, and add a new page E linked from A.
+	e := &G.Node{Url: "E", Depth: 1, Popularity: 1}
+	newRoot.Out[0].Node.Out = newRoot.Out[0].Node.Out[1:]
+	newRoot.Out = append(newRoot.Out, G.Edge{Kind: G.EdgeKindLink, Node: e})
+
+	json := DiffToJson(D.Compare(oldRoot, newRoot))
+
+	if len(json.Links) != 5 {
+		t.Errorf("Expected 5 entries for 'links', got %v\n", len(json.Links))
+	}
+
+	b := json.Links["B"]
+	if len(b) != 2 || b[0].ToUrl != "C" || b[0].DiffStatus != "removed" || b[1].ToUrl != "D" || b[1].DiffStatus != "unchanged" {
+		t.Errorf("Bad outward edges for B %+v\n", b)
+	}
+
+	if json.NodeMetadata["A"].DiffStatus != "changed" || json.NodeMetadata["B"].DiffStatus != "changed" || json.NodeMetadata["D"].DiffStatus != "unchanged" || json.NodeMetadata["E"].DiffStatus != "added" {
+		t.Errorf("Bad node metadata %+v\n", json.NodeMetadata)
+	}
+}
+
+func TestExportDiffHtml(t *testing.T) {
+	html := ExportDiffHtml(D.Compare(makeTestGraph(), makeTestGraph()))
+
+	if !(strings.Contains(html, "<!DOCTYPE html>") && strings.Contains(html, "const STRIP_PREFIX =") && strings.Contains(html, "const GRAPH =") && strings.Contains(html, "const NODE_METADATA =")) {
+		t.Errorf("Bad html output.\n")
+	}
 }
 
 func makeTestGraph() *G.Node {
@@ -73,8 +198,8 @@ func makeTestGraph() *G.Node {
 	//
 	//     (edges point down unless otherwise indicated)
 	//
-	a := &G.Node{Url: "A", Depth: 0, Popularity: 1, PureAsset: false}
-	b := &G.Node{Url: "B", Depth: 1, Popularity: 1, PureAsset: false}
+	a := &G.Node{Url: "A", Depth: 0, Popularity: 1, PureAsset: false, Metadata: &S.Metadata{StatusCode: 200, ContentType: "text/html", ContentLength: 1234, ResponseTime: 1500 * time.Millisecond}}
+	b := &G.Node{Url: "B", Depth: 1, Popularity: 1, PureAsset: false, Metadata: &S.Metadata{StatusCode: 404, ContentType: "text/html", ContentLength: -1}}
 	c := &G.Node{Url: "C", Depth: 1, Popularity: 2, PureAsset: false}
 	d := &G.Node{Url: "D", Depth: 2, Popularity: 2, PureAsset: true}
 	a.Out = []G.Edge{{G.EdgeKindLink, b}, {G.EdgeKindLink, c}}
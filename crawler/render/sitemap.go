@@ -0,0 +1,170 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+// The sitemaps protocol limits each sitemap to 50,000 URLs and 50 MiB.
+const maxSitemapUrls = 50000
+const maxSitemapBytes = 50 * 1024 * 1024
+
+// Longer URLs aren't allowed in sitemaps.
+const maxSitemapUrlLength = 2048
+
+const sitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type SitemapFile struct {
+	Name    string
+	Content []byte
+}
+
+type sitemapUrl struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod,omitempty"`
+	Priority string `xml:"priority"`
+}
+
+type sitemapUrlset struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Urls    []sitemapUrl `xml:"url"`
+}
+
+type sitemapIndexEntry struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name            `xml:"sitemapindex"`
+	Xmlns    string              `xml:"xmlns,attr"`
+	Sitemaps []sitemapIndexEntry `xml:"sitemap"`
+}
+
+// ExportSitemap makes a sitemap of the HTML pages in a graph that were loaded
+// successfully. Only the pages with the same scheme and host as the root are
+// included, as the sitemaps protocol requires. The result is a single file, sitemap.xml, unless there are too
+// many pages for one sitemap. In that case, the pages are split between
+// sitemap-1.xml, sitemap-2.xml and so on, and sitemap.xml is an index of
+// these, which must be served from baseUrl. If baseUrl is empty, the root of
+// the site is used.
+//
+// Each page's lastmod is its Last-Modified time, if known, and its priority
+// decreases with its depth.
+func ExportSitemap(root *G.Node, baseUrl string) []SitemapFile {
+	// Leave room for the XML header and the <urlset> element.
+	return exportSitemap(root, baseUrl, maxSitemapUrls, maxSitemapBytes-1024)
+}
+
+func exportSitemap(root *G.Node, baseUrl string, maxUrls, maxBytes int) []SitemapFile {
+	if baseUrl == "" {
+		if parsed, err := url.Parse(root.Url); err == nil {
+			baseUrl = parsed.Scheme + "://" + parsed.Host + "/"
+		}
+	}
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+
+	site := siteOf(root.Url)
+	var pages []*G.Node
+	G.Traverse(root, func(node *G.Node) {
+		if inSitemap(node) && siteOf(node.Url) == site {
+			pages = append(pages, node)
+		}
+	})
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Depth != pages[j].Depth {
+			return pages[i].Depth < pages[j].Depth
+		}
+		return pages[i].Url < pages[j].Url
+	})
+
+	// Split the pages into sitemaps that are within the limits.
+	var sitemaps []sitemapUrlset
+	current := sitemapUrlset{Xmlns: sitemapXmlns}
+	currentBytes := 0
+	for _, page := range pages {
+		if len(page.Url) > maxSitemapUrlLength {
+			continue
+		}
+
+		entry := sitemapUrl{
+			Loc:      page.Url,
+			Priority: sitemapPriority(page.Depth),
+		}
+		if lastModified := page.Metadata.LastModified; !lastModified.IsZero() {
+			entry.LastMod = lastModified.UTC().Format(time.RFC3339)
+		}
+
+		// This is how the entry appears in the sitemap, less a newline.
+		entryXml, _ := xml.MarshalIndent(entry, "  ", "  ")
+		entryBytes := len(entryXml) + 1
+
+		if len(current.Urls) > 0 && (len(current.Urls) == maxUrls || currentBytes+entryBytes > maxBytes) {
+			sitemaps = append(sitemaps, current)
+			current = sitemapUrlset{Xmlns: sitemapXmlns}
+			currentBytes = 0
+		}
+		current.Urls = append(current.Urls, entry)
+		currentBytes += entryBytes
+	}
+	sitemaps = append(sitemaps, current)
+
+	if len(sitemaps) == 1 {
+		return []SitemapFile{{Name: "sitemap.xml", Content: marshalSitemap(sitemaps[0])}}
+	}
+
+	index := sitemapIndex{Xmlns: sitemapXmlns}
+	var files []SitemapFile
+	for i, sitemap := range sitemaps {
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		index.Sitemaps = append(index.Sitemaps, sitemapIndexEntry{Loc: baseUrl + name})
+		files = append(files, SitemapFile{Name: name, Content: marshalSitemap(sitemap)})
+	}
+
+	return append([]SitemapFile{{Name: "sitemap.xml", Content: marshalSitemap(index)}}, files...)
+}
+
+// inSitemap determines whether a node is an HTML page on the site that was
+// loaded successfully (and not redirected elsewhere).
+func inSitemap(node *G.Node) bool {
+	m := node.Metadata
+	return !node.PureAsset &&
+		!node.External &&
+		m != nil &&
+		m.StatusCode == 200 &&
+		m.RedirectUrl == "" &&
+		strings.HasPrefix(m.ContentType, "text/html")
+}
+
+// siteOf returns the scheme and host of a URL, which the URLs in a sitemap
+// must share, or "" if it can't be parsed.
+func siteOf(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host)
+}
+
+// sitemapPriority gives the root a priority of 1.0, and each level below it
+// 0.2 less, down to a minimum of 0.1.
+func sitemapPriority(depth int) string {
+	priority := 10 - 2*depth
+	if priority < 1 {
+		priority = 1
+	}
+	return fmt.Sprintf("%d.%d", priority/10, priority%10)
+}
+
+func marshalSitemap(v interface{}) []byte {
+	content, _ := xml.MarshalIndent(v, "", "  ")
+	return append([]byte(xml.Header), append(content, '\n')...)
+}
@@ -0,0 +1,150 @@
+package render
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+func makeSitemapTestGraph() *G.Node {
+	html := func(lastModified time.Time) *S.Metadata {
+		return &S.Metadata{StatusCode: 200, ContentType: "text/html; charset=utf-8", LastModified: lastModified}
+	}
+
+	root := &G.Node{Url: "http://foo.com/", Depth: 0, Metadata: html(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))}
+	b := &G.Node{Url: "http://foo.com/b?x=1&y=2", Depth: 1, Metadata: html(time.Time{})}
+	a := &G.Node{Url: "http://foo.com/a", Depth: 1, Metadata: html(time.Time{})}
+	deep := &G.Node{Url: "http://foo.com/a/b/c/d/e/f", Depth: 6, Metadata: html(time.Time{})}
+	missing := &G.Node{Url: "http://foo.com/missing", Depth: 1, Metadata: &S.Metadata{StatusCode: 404, ContentType: "text/html"}}
+	redirect := &G.Node{Url: "http://foo.com/old", Depth: 1, Metadata: &S.Metadata{StatusCode: 200, ContentType: "text/html", RedirectUrl: "http://foo.com/a"}}
+	pdf := &G.Node{Url: "http://foo.com/doc.pdf", Depth: 1, Metadata: &S.Metadata{StatusCode: 200, ContentType: "application/pdf"}}
+	unloaded := &G.Node{Url: "http://foo.com/unloaded", Depth: 2}
+	asset := &G.Node{Url: "http://foo.com/style.css", Depth: 1, PureAsset: true}
+
+	root.Out = []G.Edge{
+		{Kind: G.EdgeKindAsset, Node: asset},
+		{Kind: G.EdgeKindLink, Node: a},
+		{Kind: G.EdgeKindLink, Node: b},
+		{Kind: G.EdgeKindLink, Node: missing},
+		{Kind: G.EdgeKindLink, Node: redirect},
+		{Kind: G.EdgeKindLink, Node: pdf},
+	}
+	a.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: deep}, {Kind: G.EdgeKindLink, Node: unloaded}}
+
+	return root
+}
+
+func TestExportSitemap(t *testing.T) {
+	files := ExportSitemap(makeSitemapTestGraph(), "")
+	if len(files) != 1 || files[0].Name != "sitemap.xml" {
+		t.Fatalf("Expected a single sitemap.xml, got %v files\n", len(files))
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>http://foo.com/</loc>
+    <lastmod>2020-01-02T03:04:05Z</lastmod>
+    <priority>1.0</priority>
+  </url>
+  <url>
+    <loc>http://foo.com/a</loc>
+    <priority>0.8</priority>
+  </url>
+  <url>
+    <loc>http://foo.com/b?x=1&amp;y=2</loc>
+    <priority>0.8</priority>
+  </url>
+  <url>
+    <loc>http://foo.com/a/b/c/d/e/f</loc>
+    <priority>0.1</priority>
+  </url>
+</urlset>
+`
+	if string(files[0].Content) != expected {
+		t.Errorf("Unexpected sitemap:\n%s\n", files[0].Content)
+	}
+}
+
+func TestExportSitemapOnlyIncludesRootHost(t *testing.T) {
+	html := &S.Metadata{StatusCode: 200, ContentType: "text/html"}
+	root := &G.Node{Url: "http://foo.com/", Metadata: html}
+	other := &G.Node{Url: "http://bar.com/", Metadata: html}
+	otherPage := &G.Node{Url: "http://bar.com/page", Depth: 1, Metadata: html}
+	secure := &G.Node{Url: "https://foo.com/secure", Depth: 1, Metadata: html}
+	page := &G.Node{Url: "http://FOO.com/page", Depth: 1, Metadata: html}
+
+	root.Out = []G.Edge{{Kind: G.EdgeKindSeed, Node: other}, {Kind: G.EdgeKindLink, Node: page}, {Kind: G.EdgeKindLink, Node: secure}}
+	other.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: otherPage}}
+
+	files := ExportSitemap(root, "")
+	if len(files) != 1 {
+		t.Fatalf("Expected a single sitemap.xml, got %v files\n", len(files))
+	}
+
+	var urlset sitemapUrlset
+	if err := xml.Unmarshal(files[0].Content, &urlset); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if len(urlset.Urls) != 2 || urlset.Urls[0].Loc != "http://foo.com/" || urlset.Urls[1].Loc != "http://FOO.com/page" {
+		t.Errorf("Expected only the pages on the root's host; got %+v\n", urlset.Urls)
+	}
+}
+
+func TestExportSitemapIndex(t *testing.T) {
+	files := exportSitemap(makeSitemapTestGraph(), "https://cdn.foo.com/maps", 3, 1000)
+	if len(files) != 3 || files[0].Name != "sitemap.xml" || files[1].Name != "sitemap-1.xml" || files[2].Name != "sitemap-2.xml" {
+		t.Fatalf("Unexpected files %v\n", files)
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(files[0].Content, &index); err != nil {
+		t.Fatalf("Couldn't parse index: %v\n", err)
+	}
+	if len(index.Sitemaps) != 2 || index.Sitemaps[0].Loc != "https://cdn.foo.com/maps/sitemap-1.xml" || index.Sitemaps[1].Loc != "https://cdn.foo.com/maps/sitemap-2.xml" {
+		t.Errorf("Unexpected index %+v\n", index)
+	}
+
+	var urlsets [2]sitemapUrlset
+	for i := range urlsets {
+		if err := xml.Unmarshal(files[i+1].Content, &urlsets[i]); err != nil {
+			t.Fatalf("Couldn't parse sitemap: %v\n", err)
+		}
+	}
+	if len(urlsets[0].Urls) != 3 || len(urlsets[1].Urls) != 1 || urlsets[1].Urls[0].Loc != "http://foo.com/a/b/c/d/e/f" {
+		t.Errorf("Unexpected sitemaps %+v\n", urlsets)
+	}
+}
+
+func TestExportSitemapSplitsBySize(t *testing.T) {
+	// Each entry is about 80 bytes (or 120 with a lastmod), so there should be
+	// 2 entries per sitemap at most.
+	files := exportSitemap(makeSitemapTestGraph(), "", 100, 200)
+	if len(files) < 3 {
+		t.Fatalf("Expected an index and at least 2 sitemaps, got %v files\n", len(files))
+	}
+
+	total := 0
+	for _, f := range files[1:] {
+		var urlset sitemapUrlset
+		if err := xml.Unmarshal(f.Content, &urlset); err != nil || len(urlset.Urls) == 0 || len(urlset.Urls) > 2 {
+			t.Errorf("Unexpected sitemap %v: %s\n", f.Name, f.Content)
+		}
+		total += len(urlset.Urls)
+	}
+	if total != 4 {
+		t.Errorf("Expected 4 pages in the sitemaps, got %v\n", total)
+	}
+}
+
+func TestSitemapPriority(t *testing.T) {
+	expected := []string{"1.0", "0.8", "0.6", "0.4", "0.2", "0.1", "0.1"}
+	for depth, priority := range expected {
+		if p := sitemapPriority(depth); p != priority {
+			t.Errorf("Expected priority %v for depth %v, got %v\n", priority, depth, p)
+		}
+	}
+}
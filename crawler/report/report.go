@@ -0,0 +1,96 @@
+// Package report summarizes problems found in a crawl graph.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	G "multiverse.io/crawler/crawler/graph"
+)
+
+type BrokenLink struct {
+	Url        string
+	StatusCode int    // 0 if no response was received
+	Error      string // set if no response was received
+	Referrers  []string
+	InSitemap  bool // whether it's listed in the site's sitemaps
+}
+
+// BrokenLinks finds every node in a graph that failed to load, along with the
+// pages that refer to it. Assets are only included if they were loaded or
+// checked (see http_source.Options.CheckAssets). The results are ordered by
+// URL.
+func BrokenLinks(g *G.Graph) []BrokenLink {
+	brokenLinks := []BrokenLink{}
+	for _, node := range g.Nodes() {
+		if node.Metadata == nil || !node.Metadata.IsBroken() {
+			continue
+		}
+
+		referrers := []string{}
+		seen := make(map[string]bool)
+		inSitemap := false
+		for _, e := range g.InEdges(node.Url) {
+			if e.Kind == G.EdgeKindSitemap {
+				inSitemap = true
+			} else if e.Kind != G.EdgeKindSeed && e.Node != node && !seen[e.Node.Url] {
+				seen[e.Node.Url] = true
+				referrers = append(referrers, e.Node.Url)
+			}
+		}
+		sort.Strings(referrers)
+
+		brokenLinks = append(brokenLinks, BrokenLink{
+			Url:        node.Url,
+			StatusCode: node.Metadata.StatusCode,
+			Error:      node.Metadata.Error,
+			Referrers:  referrers,
+			InSitemap:  inSitemap,
+		})
+	}
+
+	sort.Slice(brokenLinks, func(i, j int) bool {
+		return brokenLinks[i].Url < brokenLinks[j].Url
+	})
+
+	return brokenLinks
+}
+
+func WriteText(w io.Writer, brokenLinks []BrokenLink) error {
+	if len(brokenLinks) == 0 {
+		_, err := fmt.Fprintf(w, "No broken links found.\n")
+		return err
+	}
+
+	for _, bl := range brokenLinks {
+		problem := bl.Error
+		if problem == "" {
+			problem = fmt.Sprintf("status %v", bl.StatusCode)
+		}
+
+		if _, err := fmt.Fprintf(w, "%v (%v)\n", bl.Url, problem); err != nil {
+			return err
+		}
+		for _, r := range bl.Referrers {
+			if _, err := fmt.Fprintf(w, "    referred to by %v\n", r); err != nil {
+				return err
+			}
+		}
+		if bl.InSitemap {
+			if _, err := fmt.Fprintf(w, "    listed in sitemap\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%v broken link(s) found.\n", len(brokenLinks))
+	return err
+}
+
+func WriteJson(w io.Writer, brokenLinks []BrokenLink) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(brokenLinks)
+}
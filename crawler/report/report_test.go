@@ -0,0 +1,111 @@
+package report
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	G "multiverse.io/crawler/crawler/graph"
+	S "multiverse.io/crawler/crawler/source"
+)
+
+func TestBrokenLinks(t *testing.T) {
+	brokenLinks := BrokenLinks(G.NewGraph(makeTestGraph()))
+
+	if len(brokenLinks) != 2 {
+		t.Fatalf("Expected 2 broken links, got %v\n", len(brokenLinks))
+	}
+
+	c, d := brokenLinks[0], brokenLinks[1]
+
+	if c.Url != "C" || c.StatusCode != 404 || c.Error != "" || len(c.Referrers) != 2 || c.Referrers[0] != "A" || c.Referrers[1] != "B" {
+		t.Errorf("Unexpected broken link %+v\n", c)
+	}
+
+	if d.Url != "D" || d.StatusCode != 0 || d.Error != "timeout" || len(d.Referrers) != 1 || d.Referrers[0] != "B" {
+		t.Errorf("Unexpected broken link %+v\n", d)
+	}
+}
+
+func TestBrokenLinksFromSeed(t *testing.T) {
+	root := makeTestGraph()
+	e := &G.Node{Url: "E", Metadata: &S.Metadata{StatusCode: 500}}
+	root.Out = append(root.Out, G.Edge{Kind: G.EdgeKindSeed, Node: e})
+
+	// A seed isn't referred to by the root.
+	brokenLinks := BrokenLinks(G.NewGraph(root))
+	if len(brokenLinks) != 3 || brokenLinks[2].Url != "E" || len(brokenLinks[2].Referrers) != 0 {
+		t.Errorf("Unexpected broken links %+v\n", brokenLinks)
+	}
+}
+
+func TestBrokenLinksInSitemap(t *testing.T) {
+	root := makeTestGraph()
+	d := root.Out[0].Node.Out[1].Node
+	e := &G.Node{Url: "E", Metadata: &S.Metadata{StatusCode: 410}}
+	root.Out = append(root.Out, G.Edge{Kind: G.EdgeKindSitemap, Node: d}, G.Edge{Kind: G.EdgeKindSitemap, Node: e})
+
+	brokenLinks := BrokenLinks(G.NewGraph(root))
+	if len(brokenLinks) != 3 || brokenLinks[0].InSitemap || !brokenLinks[1].InSitemap || !brokenLinks[2].InSitemap {
+		t.Fatalf("Unexpected broken links %+v\n", brokenLinks)
+	}
+
+	// The sitemap edges don't make the root a referrer.
+	if len(brokenLinks[1].Referrers) != 1 || len(brokenLinks[2].Referrers) != 0 {
+		t.Errorf("Unexpected referrers %+v\n", brokenLinks)
+	}
+
+	var sb strings.Builder
+	if err := WriteText(&sb, brokenLinks); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	expected := "C (status 404)\n    referred to by A\n    referred to by B\nD (timeout)\n    referred to by B\n    listed in sitemap\nE (status 410)\n    listed in sitemap\n3 broken link(s) found.\n"
+	if sb.String() != expected {
+		t.Errorf("Unexpected text report:\n%v\n", sb.String())
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteText(&sb, BrokenLinks(G.NewGraph(makeTestGraph()))); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	expected := "C (status 404)\n    referred to by A\n    referred to by B\nD (timeout)\n    referred to by B\n2 broken link(s) found.\n"
+	if sb.String() != expected {
+		t.Errorf("Unexpected text report:\n%v\n", sb.String())
+	}
+}
+
+func TestWriteJson(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteJson(&sb, BrokenLinks(G.NewGraph(makeTestGraph()))); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var brokenLinks []BrokenLink
+	if err := json.Unmarshal([]byte(sb.String()), &brokenLinks); err != nil {
+		t.Fatalf("Couldn't parse JSON report: %v\n", err)
+	}
+
+	if len(brokenLinks) != 2 || brokenLinks[0].Url != "C" || brokenLinks[1].Url != "D" {
+		t.Errorf("Unexpected JSON report: %v\n", sb.String())
+	}
+}
+
+func makeTestGraph() *G.Node {
+	//       A
+	//      / \
+	//     B-->C (404)
+	//      \
+	//       D (timeout)
+	//
+	a := &G.Node{Url: "A", Metadata: &S.Metadata{StatusCode: 200}}
+	b := &G.Node{Url: "B", Metadata: &S.Metadata{StatusCode: 200}}
+	c := &G.Node{Url: "C", Metadata: &S.Metadata{StatusCode: 404}}
+	d := &G.Node{Url: "D", Metadata: &S.Metadata{Error: "timeout"}}
+	a.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: b}, {Kind: G.EdgeKindLink, Node: c}}
+	b.Out = []G.Edge{{Kind: G.EdgeKindLink, Node: c}, {Kind: G.EdgeKindLink, Node: d}}
+	return a
+}
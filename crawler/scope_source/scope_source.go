@@ -0,0 +1,291 @@
+// Package scope_source wraps a Source so that the links and assets that it
+// finds are followed, recorded without being fetched, or dropped according to
+// a set of rules. This narrows the scope of a crawl to part of a site.
+package scope_source
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	S "multiverse.io/crawler/crawler/source"
+)
+
+type Action int
+
+const (
+	// Fetch the resource (if it's a page or a loadable asset).
+	ActionFollow Action = iota
+
+	// Record the resource in the graph, but don't fetch it.
+	ActionNoFollow
+
+	// Leave the resource out of the graph.
+	ActionDrop
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionFollow:
+		return "follow"
+	case ActionNoFollow:
+		return "nofollow"
+	case ActionDrop:
+		return "drop"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Pattern matches URLs by their host, or by their path and query.
+//
+// A pattern is a glob unless it starts with "re:", in which case it's a regular
+// expression. A pattern that starts with "host:" (e.g. "host:*.foo.com" or
+// "host:re:^cdn\.") matches the host of a URL; other patterns match its path
+// followed by its query, if it has one (e.g. "/search?q=foo").
+//
+// In a glob, "**" matches any sequence of characters, and "*" matches any
+// sequence of characters other than "/", except in the query, where it matches
+// any sequence of characters. A "/**" at the end also matches nothing, so
+// "/docs/**" matches "/docs". All other characters, including "?", match
+// themselves. Globs must match the whole path and query (or host), whereas
+// regular expressions may match any part of it unless anchored.
+type Pattern struct {
+	source string
+	host   bool
+	re     *regexp.Regexp
+}
+
+func ParsePattern(s string) (Pattern, error) {
+	p := Pattern{source: s}
+
+	rest := s
+	if strings.HasPrefix(rest, "host:") {
+		p.host = true
+		rest = strings.TrimPrefix(rest, "host:")
+	}
+
+	var expr string
+	if strings.HasPrefix(rest, "re:") {
+		expr = strings.TrimPrefix(rest, "re:")
+	} else {
+		expr = globToRegexp(rest, p.host)
+	}
+
+	// An empty pattern is surely a mistake (as a glob, it would only match
+	// an empty path).
+	if rest == "" || expr == "" {
+		return p, fmt.Errorf("Empty pattern '%v'", s)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return p, fmt.Errorf("Bad pattern '%v': %v", s, err)
+	}
+	p.re = re
+
+	return p, nil
+}
+
+func (p Pattern) String() string {
+	return p.source
+}
+
+// Match determines whether a URL matches the pattern.
+func (p Pattern) Match(u *url.URL) bool {
+	if p.host {
+		return p.re.MatchString(strings.ToLower(u.Host))
+	}
+
+	target := u.EscapedPath()
+	if u.RawQuery != "" || u.ForceQuery {
+		target += "?" + u.RawQuery
+	}
+	return p.re.MatchString(target)
+}
+
+func globToRegexp(glob string, host bool) string {
+	var b strings.Builder
+	b.WriteString("^")
+
+	inQuery := host
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*' && inQuery:
+			b.WriteString(".*")
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		default:
+			if glob[i] == '?' {
+				inQuery = true
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
+
+// Rules decide what to do with each URL that a crawl finds.
+type Rules struct {
+	// If not empty, URLs that don't match any of these patterns are recorded
+	// but not fetched.
+	Include []Pattern
+
+	// URLs that match any of these patterns are recorded but not fetched.
+	NoFollow []Pattern
+
+	// URLs that match any of these patterns are dropped. This takes precedence
+	// over the other rules.
+	Exclude []Pattern
+}
+
+// Decide determines what to do with a URL.
+func (r *Rules) Decide(rawUrl string) Action {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ActionDrop
+	}
+
+	if matchAny(r.Exclude, u) {
+		return ActionDrop
+	}
+	if matchAny(r.NoFollow, u) {
+		return ActionNoFollow
+	}
+	if len(r.Include) > 0 && !matchAny(r.Include, u) {
+		return ActionNoFollow
+	}
+	return ActionFollow
+}
+
+// DecideExternal determines what to do with a URL on another site. The Include
+// patterns don't apply, as they describe the part of the site to crawl.
+func (r *Rules) DecideExternal(rawUrl string) Action {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ActionDrop
+	}
+
+	if matchAny(r.Exclude, u) {
+		return ActionDrop
+	}
+	if matchAny(r.NoFollow, u) {
+		return ActionNoFollow
+	}
+	return ActionFollow
+}
+
+func matchAny(patterns []Pattern, u *url.URL) bool {
+	for _, p := range patterns {
+		if p.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+type ScopeSource struct {
+	source S.Source
+	rules  *Rules
+}
+
+func (s *ScopeSource) GetUrl() string {
+	return s.source.GetUrl()
+}
+
+func (s *ScopeSource) GetOuts() S.Outs {
+	return s.GetOutsContext(context.Background())
+}
+
+func (s *ScopeSource) GetOutsContext(ctx context.Context) S.Outs {
+	origOuts := S.GetOutsContext(ctx, s.source)
+
+	var newLinks []S.Link
+	for _, l := range origOuts.Links {
+		action := s.rules.Decide(l.Url)
+		if l.External {
+			action = s.rules.DecideExternal(l.Url)
+		}
+
+		switch action {
+		case ActionFollow:
+			l.Source = &ScopeSource{source: l.Source, rules: s.rules}
+		case ActionNoFollow:
+			l.Source = &unfetchedSource{url: l.Url}
+		case ActionDrop:
+			continue
+		}
+		newLinks = append(newLinks, l)
+	}
+
+	var newAssets []S.Asset
+	for _, a := range origOuts.Assets {
+		switch s.rules.Decide(a.Url) {
+		case ActionFollow:
+			if a.Source != nil {
+				a.Source = &ScopeSource{source: a.Source, rules: s.rules}
+			}
+		case ActionNoFollow:
+			a.Source = nil
+		case ActionDrop:
+			continue
+		}
+		newAssets = append(newAssets, a)
+	}
+
+	return S.Outs{
+		Assets:   newAssets,
+		Links:    newLinks,
+		Metadata: origOuts.Metadata,
+	}
+}
+
+func (s *ScopeSource) Reserve() (bool, time.Time) {
+	return S.Reserve(s.source)
+}
+
+func (s *ScopeSource) Release() {
+	S.Release(s.source)
+}
+
+// unfetchedSource is the source of a page that is out of scope. Like a
+// LimitedSource over its limits, it says that the page has no assets and no
+// links, and it doesn't attempt to load it.
+type unfetchedSource struct {
+	url string
+}
+
+func (s *unfetchedSource) GetUrl() string {
+	return s.url
+}
+
+func (s *unfetchedSource) GetOuts() S.Outs {
+	return S.Outs{}
+}
+
+// MakeSource makes a source that applies rules to the links and assets found
+// by source (but not to source itself, which is always fetched).
+func MakeSource(source S.Source, rules *Rules) *ScopeSource {
+	return &ScopeSource{source: source, rules: rules}
+}
+
+// MakeLinkSource is like MakeSource, but applies rules to source itself as
+// though it had been found by another ScopeSource, so it isn't fetched if it's
+// out of scope. This is useful for the pages in a sitemap, and for resuming a
+// crawl.
+func MakeLinkSource(source S.Source, rules *Rules) S.Source {
+	if rules.Decide(source.GetUrl()) != ActionFollow {
+		return &unfetchedSource{url: source.GetUrl()}
+	}
+	return MakeSource(source, rules)
+}
@@ -0,0 +1,184 @@
+package scope_source
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	MS "multiverse.io/crawler/crawler/test_helpers/mock_source"
+)
+
+func TestPatternMatch(t *testing.T) {
+	type test struct {
+		pattern  string
+		url      string
+		expected bool
+	}
+
+	tests := []test{
+		{"/docs/**", "http://foo.com/docs", true},
+		{"/docs/**", "http://foo.com/docs/", true},
+		{"/docs/**", "http://foo.com/docs/a/b.html", true},
+		{"/docs/**", "http://foo.com/docs/a?page=2", true},
+		{"/docs/**", "http://foo.com/docsearch", false},
+		{"/docs/**", "http://foo.com/about/docs/", false},
+		{"/docs/*", "http://foo.com/docs/a", true},
+		{"/docs/*", "http://foo.com/docs/a/b", false},
+		{"/**/*.pdf", "http://foo.com/files/2020/report.pdf", true},
+		{"/**/*.pdf", "http://foo.com/report.pdf.html", false},
+		{"/about", "http://foo.com/about", true},
+		{"/about", "http://foo.com/about?ref=home", false},
+
+		// "?" is literal, and "*" in the query matches "/" too.
+		{"/search?*", "http://foo.com/search?q=a/b", true},
+		{"/search?*", "http://foo.com/search", false},
+		{"/search?*", "http://foo.com/searches", false},
+		{"/*?*page=*", "http://foo.com/list?sort=asc&page=2", true},
+
+		{"re:^/blog/[0-9]{4}/", "http://foo.com/blog/2020/post", true},
+		{"re:^/blog/[0-9]{4}/", "http://foo.com/blog/latest/post", false},
+		{"re:utm_", "http://foo.com/a?utm_source=x", true},
+		{"re:(?i)/PRIVATE", "http://foo.com/a/private/b", true},
+
+		{"host:*.foo.com", "http://cdn.foo.com/a", true},
+		{"host:*.foo.com", "http://foo.com/a", false},
+		{"host:foo.com", "http://FOO.com/a", true},
+		{"host:re:^cdn\\.", "http://cdn.foo.com/a", true},
+		{"host:re:^cdn\\.", "http://foo.com/cdn.html", false},
+	}
+
+	for _, tst := range tests {
+		p, err := ParsePattern(tst.pattern)
+		if err != nil {
+			t.Fatalf("Couldn't parse pattern '%v': %v\n", tst.pattern, err)
+		}
+		u, _ := url.Parse(tst.url)
+		if actual := p.Match(u); actual != tst.expected {
+			t.Errorf("Expected '%v' matching %v to be %v; got %v\n", tst.pattern, tst.url, tst.expected, actual)
+		}
+	}
+
+	for _, s := range []string{"", "host:", "re:"} {
+		if _, err := ParsePattern(s); err == nil {
+			t.Errorf("Expected error for empty pattern '%v'\n", s)
+		}
+	}
+
+	if _, err := ParsePattern("re:("); err == nil {
+		t.Errorf("Expected an error for a bad regular expression\n")
+	}
+}
+
+func mustParsePatterns(patterns ...string) []Pattern {
+	var result []Pattern
+	for _, s := range patterns {
+		p, err := ParsePattern(s)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func TestRulesDecide(t *testing.T) {
+	rules := Rules{
+		Include:  mustParsePatterns("/docs/**", "/static/**"),
+		NoFollow: mustParsePatterns("/docs/archive/**"),
+		Exclude:  mustParsePatterns("/search?*", "/docs/archive/secret"),
+	}
+
+	type test struct {
+		url      string
+		expected Action
+	}
+
+	tests := []test{
+		{"http://foo.com/docs/a", ActionFollow},
+		{"http://foo.com/static/site.css", ActionFollow},
+		{"http://foo.com/about", ActionNoFollow},
+		{"http://foo.com/docs/archive/2019", ActionNoFollow},
+		{"http://foo.com/docs/archive/secret", ActionDrop},
+		{"http://foo.com/search?q=docs", ActionDrop},
+	}
+
+	for _, tst := range tests {
+		if actual := rules.Decide(tst.url); actual != tst.expected {
+			t.Errorf("Expected %v for %v; got %v\n", tst.expected, tst.url, actual)
+		}
+	}
+
+	// Only the Exclude and NoFollow patterns apply to external links.
+	if actual := rules.DecideExternal("http://bar.com/about"); actual != ActionFollow {
+		t.Errorf("Expected %v for an external link; got %v\n", ActionFollow, actual)
+	}
+	if actual := rules.DecideExternal("http://bar.com/search?q=x"); actual != ActionDrop {
+		t.Errorf("Expected %v for an excluded external link; got %v\n", ActionDrop, actual)
+	}
+
+	// Everything is followed without rules.
+	if actual := (&Rules{}).Decide("http://foo.com/anything"); actual != ActionFollow {
+		t.Errorf("Expected %v without rules; got %v\n", ActionFollow, actual)
+	}
+}
+
+func TestScopeSource(t *testing.T) {
+	universe := MS.MockSourceUniverse{
+		Links: map[string][]string{
+			"/":       []string{"/docs/a", "/about", "/search?q=x"},
+			"/docs/a": []string{"/docs/b"},
+			"/about":  []string{"/team"},
+		},
+		Assets: map[string][]string{
+			"/":       []string{"/docs/a.css", "/other.css", "/search?q=img"},
+			"/docs/a": []string{"/docs/a.css"},
+		},
+		LoadableAssets: map[string]bool{
+			"/docs/a.css": true,
+			"/other.css":  true,
+		},
+	}
+
+	rules := &Rules{
+		Include: mustParsePatterns("/docs/**"),
+		Exclude: mustParsePatterns("/search?*"),
+	}
+	source := MakeSource(&MS.MockSource{Universe: &universe, Url: "/"}, rules)
+
+	outs := source.GetOuts()
+
+	var links []string
+	for _, l := range outs.Links {
+		links = append(links, l.Url)
+	}
+	if strings.Join(links, " ") != "/docs/a /about" {
+		t.Fatalf("Unexpected links %v\n", links)
+	}
+
+	// Followed links are wrapped in turn.
+	if docsOuts := outs.Links[0].Source.GetOuts(); len(docsOuts.Links) != 1 || docsOuts.Links[0].Url != "/docs/b" {
+		t.Errorf("Unexpected outs for /docs/a: %+v\n", docsOuts)
+	}
+	if _, ok := outs.Links[0].Source.(*ScopeSource); !ok {
+		t.Errorf("Expected /docs/a to be wrapped\n")
+	}
+
+	// Links that aren't followed are recorded, but aren't loaded.
+	if aboutOuts := outs.Links[1].Source.GetOuts(); len(aboutOuts.Links) != 0 || aboutOuts.Metadata != nil {
+		t.Errorf("Expected /about not to be loaded; got %+v\n", aboutOuts)
+	}
+	if outs.Links[1].Source.GetUrl() != "/about" {
+		t.Errorf("Unexpected URL for /about's source: %v\n", outs.Links[1].Source.GetUrl())
+	}
+
+	if _, ok := MakeLinkSource(&MS.MockSource{Universe: &universe, Url: "/about"}, rules).(*ScopeSource); ok {
+		t.Errorf("Expected a link source for /about not to be loaded\n")
+	}
+	if _, ok := MakeLinkSource(&MS.MockSource{Universe: &universe, Url: "/docs/a"}, rules).(*ScopeSource); !ok {
+		t.Errorf("Expected a link source for /docs/a to be loaded\n")
+	}
+
+	if len(outs.Assets) != 2 || outs.Assets[0].Url != "/docs/a.css" || outs.Assets[0].Source == nil || outs.Assets[1].Url != "/other.css" || outs.Assets[1].Source != nil {
+		t.Errorf("Unexpected assets %+v\n", outs.Assets)
+	}
+}
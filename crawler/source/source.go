@@ -2,21 +2,135 @@
 // references assets and contains links to other loadable resources.
 package source
 
+import (
+	"context"
+	"time"
+)
+
 type Asset struct {
 	Url string
+
+	// If not nil, the asset can be loaded to find the assets that it refers to
+	// in turn (e.g. the fonts and images used by a stylesheet).
+	Source Source
+
+	// Other URLs that were found for the asset, which canonicalize to Url.
+	Aliases []string
 }
 
 type Link struct {
 	Url    string
 	Source Source
+
+	// Other URLs that were found for the page, which canonicalize to Url.
+	Aliases []string
+
+	// Whether the page is on another site. If so, Source only checks that it
+	// exists, and finds no links or assets.
+	External bool
+}
+
+// Metadata describes the response received when loading a resource.
+type Metadata struct {
+	StatusCode    int
+	ContentType   string
+	ContentLength int64 // -1 if unknown
+	ResponseTime  time.Duration
+
+	// From the Last-Modified header; the zero time if there was none.
+	LastModified time.Time
+
+	// The URL that we were ultimately redirected to, if any.
+	RedirectUrl string
+
+	// The URL that the page gives as its canonical URL with
+	// <link rel="canonical">, if any.
+	CanonicalUrl string
+
+	// The contents of the page's <title> element, with runs of whitespace
+	// replaced by single spaces.
+	Title string
+
+	// Describes the error if no response was received.
+	Error string
+
+	// How long the server asked us to wait before making more requests, from
+	// the Retry-After header of a 429 or 503 response.
+	RetryAfter time.Duration
+
+	// The minimum time between requests to the host that its robots.txt asks
+	// for with Crawl-delay, if any.
+	CrawlDelay time.Duration
+
+	// The number of requests made for the resource, including retries. This
+	// describes the last of them.
+	Attempts int
+}
+
+// IsBroken determines whether the resource failed to load.
+func (m *Metadata) IsBroken() bool {
+	return m.Error != "" || m.StatusCode >= 400
 }
 
 type Outs struct {
 	Links  []Link
 	Assets []Asset
+
+	// Metadata is nil if the source didn't attempt to load the resource.
+	Metadata *Metadata
 }
 
 type Source interface {
 	GetUrl() string
 	GetOuts() Outs
 }
+
+// ContextSource is a Source that can abandon loading a resource when a context
+// is cancelled.
+type ContextSource interface {
+	Source
+	GetOutsContext(ctx context.Context) Outs
+}
+
+// GetOutsContext gets the outs of a source using its GetOutsContext method if
+// it is a ContextSource, or its GetOuts method otherwise.
+func GetOutsContext(ctx context.Context, source Source) Outs {
+	if cs, ok := source.(ContextSource); ok {
+		return cs.GetOutsContext(ctx)
+	}
+	return source.GetOuts()
+}
+
+// ScheduledSource is a Source that may have to wait before loading its
+// resource (e.g. so as not to make too many requests to a host at once). A
+// crawler can reserve the right to load it before handing it to a worker, so
+// that workers don't wait.
+type ScheduledSource interface {
+	Source
+
+	// Reserve reports whether the resource can be loaded now, and if so,
+	// reserves the right to do so, so that the next call to GetOuts or
+	// GetOutsContext doesn't wait. Otherwise, it returns the earliest time at
+	// which it's worth trying again, or the zero time if that depends on
+	// other requests finishing.
+	Reserve() (ok bool, retryAt time.Time)
+
+	// Release gives up a reservation without loading the resource.
+	Release()
+}
+
+// Reserve reserves the right to load a source's resource if it is a
+// ScheduledSource. Other sources can always be loaded.
+func Reserve(source Source) (ok bool, retryAt time.Time) {
+	if ss, ok := source.(ScheduledSource); ok {
+		return ss.Reserve()
+	}
+	return true, time.Time{}
+}
+
+// Release gives up a reservation made with Reserve.
+func Release(source Source) {
+	if ss, ok := source.(ScheduledSource); ok {
+		ss.Release()
+	}
+}
@@ -1,12 +1,29 @@
 package mock_source
 
 import (
+	"time"
+
 	S "multiverse.io/crawler/crawler/source"
 )
 
 type MockSourceUniverse struct {
 	Links  map[string][]string // Which URLs are linked to from each URL?
 	Assets map[string][]string // Which assets are referenced from each URL?
+
+	// What metadata is returned for each URL? (optional)
+	Metadata map[string]*S.Metadata
+
+	// How long does it take to get the outs of each URL? (optional)
+	Delays map[string]time.Duration
+
+	// Which assets can be loaded, like stylesheets? (optional)
+	LoadableAssets map[string]bool
+
+	// Which other URLs canonicalize to each URL? (optional)
+	Aliases map[string][]string
+
+	// Which URLs are on other sites, and only checked? (optional)
+	External map[string]bool
 }
 
 type MockSource struct {
@@ -21,12 +38,18 @@ func (s *MockSource) GetUrl() string {
 func (s *MockSource) GetOuts() S.Outs {
 	var outs S.Outs
 	if s.Universe != nil {
+		time.Sleep(s.Universe.Delays[s.Url])
 		for _, url := range s.Universe.Links[s.Url] {
-			outs.Links = append(outs.Links, S.Link{Url: url, Source: &MockSource{s.Universe, url}})
+			outs.Links = append(outs.Links, S.Link{Url: url, Source: &MockSource{s.Universe, url}, Aliases: s.Universe.Aliases[url], External: s.Universe.External[url]})
 		}
 		for _, url := range s.Universe.Assets[s.Url] {
-			outs.Assets = append(outs.Assets, S.Asset{Url: url})
+			asset := S.Asset{Url: url, Aliases: s.Universe.Aliases[url]}
+			if s.Universe.LoadableAssets[url] {
+				asset.Source = &MockSource{s.Universe, url}
+			}
+			outs.Assets = append(outs.Assets, asset)
 		}
+		outs.Metadata = s.Universe.Metadata[s.Url]
 	}
 	return outs
 }
@@ -1,31 +1,179 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	C "multiverse.io/crawler/crawler"
+	D "multiverse.io/crawler/crawler/diff"
+	G "multiverse.io/crawler/crawler/graph"
+	HC "multiverse.io/crawler/crawler/http_cache"
 	H "multiverse.io/crawler/crawler/http_source"
 	L "multiverse.io/crawler/crawler/limited_source"
+	P "multiverse.io/crawler/crawler/polite_source"
 	R "multiverse.io/crawler/crawler/render"
+	RP "multiverse.io/crawler/crawler/report"
+	SC "multiverse.io/crawler/crawler/scope_source"
+	S "multiverse.io/crawler/crawler/source"
 )
 
+// The exit code used when a broken link report finds broken links.
+const exitCodeBrokenLinks = 2
+
 func main() {
 	args, err := getCommandArgs(os.Stderr, os.Args[1:])
 	if err != nil {
 		os.Exit(1)
 	}
 
-	source, err := H.MakeSource(args.url, handleError)
+	var checkpoint *C.Checkpoint
+	if args.resumeFile != "" {
+		args, checkpoint, err = loadCheckpoint(args.resumeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if args.diff {
+		if err := diff(args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var g *G.Graph
+	if args.loadFile != "" {
+		var root *G.Node
+		root, err = loadCrawl(args.loadFile)
+		if err == nil {
+			g = G.NewGraph(root)
+		}
+	} else {
+		g, err = crawl(args, append([]string{args.url}, args.seeds...), checkpoint)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
+	root := g.Root()
+
+	// Crawl files don't include the metrics, which depend on -damping and
+	// -metriciterations, so they're computed here when they're shown.
+	if needsMetrics(args) {
+		G.ComputeMetrics(g, args.metrics)
+	}
 
-	limitedSource := L.MakeSource(&source, args.nRequestsLimit, args.depthLimit)
+	if args.sitemapDir != "" {
+		if err := exportSitemap(args.sitemapDir, args.sitemapBase, root); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if args.report == reportBroken {
+		brokenLinks := RP.BrokenLinks(g)
+		if args.reportFormat == reportFormatJson {
+			err = RP.WriteJson(os.Stdout, brokenLinks)
+		} else {
+			err = RP.WriteText(os.Stdout, brokenLinks)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if len(brokenLinks) > 0 {
+			os.Exit(exitCodeBrokenLinks)
+		}
+		return
+	}
+
+	switch args.format {
+	case formatDot:
+		fmt.Print(R.ExportDot(root, R.DotOptions{ClusterDepth: args.dotCluster}))
+	case formatGraphML:
+		err = R.WriteGraphML(os.Stdout, root)
+	case formatGexf:
+		err = R.WriteGexf(os.Stdout, root)
+	case formatCsv:
+		err = R.WriteCsvZip(os.Stdout, root)
+	default:
+		html := R.ExportHtmlWithOptions(root, R.HtmlOptions{SizeBy: args.sizeBy})
+		fmt.Printf("%v\n", html)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// diff compares two crawls, each of which is either loaded from a file or
+// crawled from a URL.
+func diff(args commandArgs) error {
+	var roots [2]*G.Node
+	for i, input := range args.diffInputs {
+		var err error
+		if isUrl(input) {
+			var g *G.Graph
+			if g, err = crawl(args, []string{input}, nil); err == nil {
+				roots[i] = g.Root()
+			}
+		} else {
+			roots[i], err = loadCrawl(input)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	d := D.Compare(roots[0], roots[1])
+
+	if args.report == reportDiff {
+		if args.reportFormat == reportFormatJson {
+			return D.WriteJson(os.Stdout, d)
+		}
+		return D.WriteText(os.Stdout, d)
+	}
+
+	html := R.ExportDiffHtml(d)
+	fmt.Printf("%v\n", html)
+	return nil
+}
+
+func isUrl(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// crawl crawls a site from one or more URLs, the first of which is the root of
+// the graph, or resumes a crawl from a checkpoint if checkpoint is not nil.
+func crawl(args commandArgs, urls []string, checkpoint *C.Checkpoint) (*G.Graph, error) {
+	var options H.Options
+	if args.cacheDir != "" {
+		options.Transport = &HC.Transport{Dir: args.cacheDir, Offline: args.offline}
+	}
+	options.Canonicalizer = &args.canonicalRules
+	options.CheckExternalLinks = args.checkExternal
+	// The broken link report covers images, scripts and other assets too.
+	options.CheckAssets = args.report == reportBroken
+	options.Hosts = args.hosts
+	options.Retries = args.retries
+
+	sources, err := H.MakeSources(urls, handleError, options)
+	if err != nil {
+		return nil, err
+	}
+	source := sources[0]
 
 	var assetsMode C.AssetsMode
 	if args.noAssets {
@@ -34,10 +182,197 @@ func main() {
 		assetsMode = C.AssetsModeIncludeAssets
 	}
 
-	root := C.Crawl(limitedSource, assetsMode)
+	// Stop crawling on Ctrl-C, but still output the graph built so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	html := R.ExportHtml(root)
-	fmt.Printf("%v\n", html)
+	info := G.CrawlInfo{StartedAt: time.Now(), Parameters: args.parameters}
+	if checkpoint != nil {
+		info.StartedAt = checkpoint.Graph.StartedAt
+	}
+
+	crawlOptions := C.Options{
+		AssetsMode:         assetsMode,
+		CheckpointFile:     args.checkpointFile,
+		CheckpointInterval: args.checkpointInterval,
+		CrawlInfo:          info,
+		MergeCanonical:     args.mergeCanonical,
+	}
+
+	hosts := P.NewHosts(P.Options{MaxConcurrency: args.hostConcurrency, MinDelay: args.hostDelay})
+
+	var totalRequests uint64
+	if checkpoint != nil {
+		totalRequests = checkpoint.Requests
+	}
+
+	// Every source in the crawl shares the same politeness state and request
+	// counter. Pages other than the root are only loaded if they're in scope.
+	wrapSource := func(s S.Source, depth int, external bool) S.Source {
+		politeSource := P.MakeSourceWithHosts(s, hosts)
+		makeLimited := L.MakeSourceWithCounter
+		if external {
+			makeLimited = L.MakeExternalSourceWithCounter
+		}
+		limitedSource := makeLimited(politeSource, args.nRequestsLimit, args.depthLimit, uint64(depth), &totalRequests)
+		if depth == 0 {
+			return SC.MakeSource(limitedSource, &args.scope)
+		}
+		return SC.MakeLinkSource(limitedSource, &args.scope)
+	}
+
+	for i := range sources[1:] {
+		crawlOptions.Seeds = append(crawlOptions.Seeds, wrapSource(&sources[i+1], 0, false))
+	}
+
+	if args.sitemap || args.seedSitemap {
+		// Each host has its own sitemaps.
+		seenHosts := make(map[string]bool)
+		for i := range sources {
+			host := hostOf(sources[i].GetUrl())
+			if seenHosts[host] {
+				continue
+			}
+			seenHosts[host] = true
+
+			for _, link := range sources[i].GetSitemap(ctx) {
+				if args.scope.Decide(link.Url) == SC.ActionDrop {
+					continue
+				}
+				crawlOptions.Sitemap = append(crawlOptions.Sitemap, S.Link{Url: link.Url, Source: wrapSource(link.Source, 1, false), Aliases: link.Aliases})
+			}
+		}
+		crawlOptions.SeedSitemap = args.seedSitemap
+	}
+
+	var g *G.Graph
+	if checkpoint == nil {
+		g, err = C.CrawlGraph(ctx, wrapSource(&source, 0, false), crawlOptions)
+	} else {
+		makeSource := func(u string, depth int) (S.Source, error) {
+			newSource := source.NewSource
+			external := !source.InScope(u)
+			if external {
+				newSource = source.NewExternalSource
+			}
+			s, err := newSource(u)
+			if err != nil {
+				return nil, err
+			}
+			return wrapSource(&s, depth, external), nil
+		}
+		g, err = C.ResumeGraph(ctx, checkpoint, makeSource, crawlOptions)
+	}
+	if g == nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Crawl interrupted (%v); the graph is incomplete.\n", ctx.Err())
+		if args.checkpointFile != "" {
+			fmt.Fprintf(os.Stderr, "Resume it with -resume %v\n", args.checkpointFile)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	info.FinishedAt = time.Now()
+
+	if args.saveFile != "" {
+		if err := saveCrawl(args.saveFile, info, g.Root()); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// hostOf returns the host of a URL, or "" if it can't be parsed.
+func hostOf(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+func saveCrawl(filename string, info G.CrawlInfo, root *G.Node) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := G.WriteJson(f, info, root); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// exportSitemap writes a sitemap of the crawl to sitemap.xml in dir, along with
+// the sitemaps that it indexes, if any.
+func exportSitemap(dir, baseUrl string, root *G.Node) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, f := range R.ExportSitemap(root, baseUrl) {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), f.Content, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadCheckpoint loads a checkpoint along with the command line arguments of
+// the crawl that wrote it. Only the flags that were given are saved, so the
+// others get their defaults again.
+func loadCheckpoint(filename string) (commandArgs, *C.Checkpoint, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return commandArgs{}, nil, err
+	}
+	defer f.Close()
+
+	checkpoint, err := C.ReadCheckpoint(f)
+	if err != nil {
+		return commandArgs{}, nil, fmt.Errorf("Couldn't read checkpoint %v: %v", filename, err)
+	}
+
+	var argv []string
+	for name, value := range checkpoint.Graph.Parameters {
+		if name != "url" && name != "resume" {
+			argv = append(argv, fmt.Sprintf("-%v=%v", name, value))
+		}
+	}
+	argv = append(argv, strings.Fields(checkpoint.Graph.Parameters["url"])...)
+
+	args, err := getCommandArgs(os.Stderr, argv)
+	if err != nil {
+		return commandArgs{}, nil, fmt.Errorf("Bad parameters in checkpoint %v", filename)
+	}
+
+	// Keep updating the same checkpoint.
+	args.checkpointFile = filename
+
+	return args, checkpoint, nil
+}
+
+func loadCrawl(filename string) (*G.Node, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	root, _, err := G.ReadJson(f)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read crawl file %v: %v", filename, err)
+	}
+
+	return root, nil
 }
 
 func handleError(httpUrl string, err error) {
@@ -46,13 +381,74 @@ func handleError(httpUrl string, err error) {
 
 type commandArgs struct {
 	url            string
+	seeds          []string // the URLs given after url, if any
+	hosts          []string
 	depthLimit     uint64
 	nRequestsLimit uint64
 	noAssets       bool
+	report         string
+	reportFormat   string
+	format         string
+	dotCluster     int
+	sizeBy         string
+	metrics        G.MetricsOptions
+	saveFile       string
+	loadFile       string
+	diff           bool
+	diffInputs     [2]string
+	cacheDir       string
+	offline        bool
+
+	hostConcurrency int
+	hostDelay       time.Duration
+
+	retries H.RetryPolicy
+
+	sitemap     bool
+	seedSitemap bool
+	sitemapDir  string
+	sitemapBase string
+
+	canonicalRules H.CanonicalRules
+	mergeCanonical bool
+
+	scope SC.Rules
+
+	checkExternal bool
+
+	checkpointFile     string
+	checkpointInterval time.Duration
+	resumeFile         string
+
+	// The value of every flag, keyed by name, plus the URLs (separated by
+	// spaces) as "url".
+	parameters map[string]string
 }
 
+const (
+	reportNone   = ""
+	reportBroken = "broken"
+	reportDiff   = "diff"
+)
+
+const (
+	reportFormatText = "text"
+	reportFormatJson = "json"
+)
+
+const (
+	formatHtml    = "html"
+	formatDot     = "dot"
+	formatGraphML = "graphml"
+	formatGexf    = "gexf"
+	formatCsv     = "csv"
+)
+
 const defaultDepthLimit = 30
 const defaultNRequestsLimit = 200
+const defaultRetries = 2
+const defaultRetryBackoff = 500 * time.Millisecond
+const defaultMaxBackoff = 30 * time.Second
 
 func getCommandArgs(usageOutput io.Writer, argv []string) (args commandArgs, err error) {
 	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
@@ -61,18 +457,263 @@ func getCommandArgs(usageOutput io.Writer, argv []string) (args commandArgs, err
 	flagSet.Uint64Var(&args.depthLimit, "maxdepth", defaultDepthLimit, "the maximum depth of the traversal from the root")
 	flagSet.Uint64Var(&args.nRequestsLimit, "maxreqs", defaultNRequestsLimit, "the maximum number of HTTP requests to make before halting")
 	flagSet.BoolVar(&args.noAssets, "noassets", false, "if this flag is present, assets are not included in the graph")
+	flagSet.StringVar(&args.report, "report", reportNone, "output a report instead of a graph ('broken', or 'diff' with -diff)")
+	flagSet.StringVar(&args.reportFormat, "reportformat", reportFormatText, "the format of the report ('text' or 'json')")
+	flagSet.StringVar(&args.format, "format", formatHtml, "the format of the graph ('html', 'dot', 'graphml', 'gexf' or 'csv')")
+	flagSet.IntVar(&args.dotCluster, "dotcluster", 0, "with -format dot, group the nodes that share this many path segments into subgraphs")
+	flagSet.StringVar(&args.sizeBy, "sizeby", "", "size the nodes in the HTML graph by this metric ('"+strings.Join(R.SizeMetrics, "', '")+"')")
+	flagSet.Float64Var(&args.metrics.Damping, "damping", G.DefaultDamping, "the probability of following a link rather than going to a random page, when computing PageRank")
+	flagSet.IntVar(&args.metrics.MaxIterations, "metriciterations", G.DefaultMaxIterations, "the maximum number of iterations when computing PageRank and HITS scores")
+	flagSet.StringVar(&args.saveFile, "savecrawl", "", "save the crawl to this file in JSON format")
+	flagSet.StringVar(&args.loadFile, "loadcrawl", "", "load a crawl saved with -savecrawl from this file instead of crawling")
+	flagSet.StringVar(&args.cacheDir, "cachedir", "", "cache HTTP responses in this directory")
+	flagSet.BoolVar(&args.offline, "offline", false, "only load responses from the cache (requires -cachedir)")
+	flagSet.IntVar(&args.hostConcurrency, "hostconcurrency", 0, "the maximum number of requests to make to a host at once (0 for no limit)")
+	flagSet.DurationVar(&args.hostDelay, "hostdelay", 0, "the minimum time between starting requests to a host")
+	flagSet.IntVar(&args.retries.MaxRetries, "retries", defaultRetries, "the maximum number of times to retry a request that fails temporarily")
+	flagSet.DurationVar(&args.retries.InitialBackoff, "retrybackoff", defaultRetryBackoff, "how long to wait before retrying a request the first time (doubling each time after that)")
+	flagSet.DurationVar(&args.retries.MaxBackoff, "maxbackoff", defaultMaxBackoff, "the longest to wait before retrying a request")
+	flagSet.BoolVar(&args.sitemap, "sitemap", false, "find the pages in the site's sitemaps, and show which of them are linked to")
+	flagSet.BoolVar(&args.seedSitemap, "seedsitemap", false, "like -sitemap, but also crawl the pages in the sitemaps that aren't linked to")
+	flagSet.StringVar(&args.sitemapDir, "exportsitemap", "", "write a sitemap of the crawl to sitemap.xml in this directory")
+	flagSet.StringVar(&args.sitemapBase, "sitemapbase", "", "the URL that the sitemaps written by -exportsitemap will be served from, if there is more than one (default the root of the site)")
+	flagSet.StringVar(&args.checkpointFile, "checkpoint", "", "periodically save the state of the crawl to this file so that it can be resumed")
+	flagSet.DurationVar(&args.checkpointInterval, "checkpointinterval", C.DefaultCheckpointInterval, "how often to save the state of the crawl with -checkpoint")
+	flagSet.StringVar(&args.resumeFile, "resume", "", "resume the crawl saved in this file by -checkpoint")
+	flagSet.BoolVar(&args.diff, "diff", false, "compare two crawls, each given as a URL or a file saved with -savecrawl")
+
+	flagSet.Var((*patternList)(&args.scope.Include), "include", "only fetch the pages matching this pattern (and others given with -include); may be repeated")
+	flagSet.Var((*patternList)(&args.scope.NoFollow), "nofollow", "don't fetch the pages matching this pattern, but include them in the graph; may be repeated")
+	flagSet.Var((*patternList)(&args.scope.Exclude), "exclude", "leave the pages and assets matching this pattern out of the graph; may be repeated")
+
+	var hosts string
+	flagSet.StringVar(&hosts, "hosts", "", "crawl the pages on these comma separated hosts too, as well as those on the hosts of the URLs")
+	flagSet.BoolVar(&args.checkExternal, "checkexternal", false, "check that the links to other sites work (without crawling them)")
+
+	var removeParams, trailingSlash, indexFiles string
+	flagSet.StringVar(&removeParams, "removeparams", "", "remove the query parameters matching these comma separated patterns from URLs (e.g. 'utm_*,fbclid')")
+	flagSet.BoolVar(&args.canonicalRules.SortParams, "sortparams", false, "sort the query parameters of URLs by name")
+	flagSet.StringVar(&trailingSlash, "trailingslash", "keep", "whether to 'keep', 'add' or 'remove' slashes at the end of URL paths")
+	flagSet.StringVar(&indexFiles, "indexfiles", "", "remove these comma separated file names (e.g. 'index.html') from the end of URL paths")
+	flagSet.BoolVar(&args.canonicalRules.LowercasePaths, "lowercasepaths", false, "convert URL paths to lowercase, for sites whose paths are case insensitive")
+	flagSet.BoolVar(&args.mergeCanonical, "mergecanonical", false, "merge each page into the page given by its <link rel=\"canonical\">")
 
 	if err = flagSet.Parse(argv); err != nil {
 		return
 	}
 
-	if flagSet.NArg() != 1 {
-		err = errors.New("You must provide exactly one URL.\n")
+	if args.diff {
+		if flagSet.NArg() != 2 {
+			err = errors.New("You must provide exactly two URLs or crawl files with -diff.\n")
+			fmt.Fprintf(usageOutput, "%v", err)
+			return
+		}
+		if args.loadFile != "" || args.saveFile != "" || args.checkpointFile != "" || args.resumeFile != "" || args.sitemapDir != "" {
+			err = errors.New("You can't use -loadcrawl, -savecrawl, -checkpoint, -resume or -exportsitemap with -diff.\n")
+			fmt.Fprintf(usageOutput, "%v", err)
+			return
+		}
+		args.diffInputs = [2]string{flagSet.Arg(0), flagSet.Arg(1)}
+	} else if args.resumeFile != "" {
+		// The resumed crawl uses the flags saved in the checkpoint, so any
+		// others would be ignored.
+		var others []string
+		flagSet.Visit(func(f *flag.Flag) {
+			if f.Name != "resume" {
+				others = append(others, "-"+f.Name)
+			}
+		})
+		if flagSet.NArg() != 0 {
+			err = errors.New("You can't provide a URL with -resume.\n")
+			fmt.Fprintf(usageOutput, "%v", err)
+			return
+		}
+		if len(others) != 0 {
+			err = fmt.Errorf("You can't use %v with -resume, as the options of the crawl are saved in the checkpoint.\n", strings.Join(others, ", "))
+			fmt.Fprintf(usageOutput, "%v", err)
+			return
+		}
+	} else if args.loadFile != "" {
+		if flagSet.NArg() != 0 {
+			err = errors.New("You can't provide a URL with -loadcrawl.\n")
+			fmt.Fprintf(usageOutput, "%v", err)
+			return
+		}
+	} else if flagSet.NArg() == 0 {
+		err = errors.New("You must provide at least one URL.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	// Go's parser stops at the first argument that isn't a flag, so any flags
+	// after the URL would be taken for more URLs.
+	for _, arg := range flagSet.Args() {
+		if strings.HasPrefix(arg, "-") {
+			err = fmt.Errorf("Flags must come before the URLs (found %v).\n", arg)
+			fmt.Fprintf(usageOutput, "%v", err)
+			return
+		}
+	}
+
+	if args.offline && args.cacheDir == "" {
+		err = errors.New("You must provide -cachedir with -offline.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.sitemapBase != "" && args.sitemapDir == "" {
+		err = errors.New("You must provide -exportsitemap with -sitemapbase.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	args.hosts = splitList(hosts)
+	args.canonicalRules.RemoveParams = splitList(removeParams)
+	args.canonicalRules.IndexFiles = splitList(indexFiles)
+	if args.canonicalRules.TrailingSlash, err = H.ParseTrailingSlashPolicy(trailingSlash); err != nil {
+		err = fmt.Errorf("%v.\n", err)
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.hostConcurrency < 0 {
+		err = errors.New("-hostconcurrency can't be negative.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.retries.MaxRetries < 0 || args.retries.InitialBackoff < 0 || args.retries.MaxBackoff < 0 {
+		err = errors.New("-retries, -retrybackoff and -maxbackoff can't be negative.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.report != reportNone && args.report != reportBroken && args.report != reportDiff {
+		err = fmt.Errorf("Unknown report '%v'.\n", args.report)
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if (args.report == reportDiff) != (args.diff && args.report != reportNone) {
+		err = errors.New("The 'diff' report is the only report available with -diff, and requires it.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.reportFormat != reportFormatText && args.reportFormat != reportFormatJson {
+		err = fmt.Errorf("Unknown report format '%v'.\n", args.reportFormat)
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	switch args.format {
+	case formatHtml, formatDot, formatGraphML, formatGexf, formatCsv:
+	default:
+		err = fmt.Errorf("Unknown format '%v'.\n", args.format)
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.format != formatHtml && (args.diff || args.report != reportNone) {
+		err = errors.New("-format only applies to graphs, not to reports or diffs.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.dotCluster < 0 || args.dotCluster > 0 && args.format != formatDot {
+		err = errors.New("-dotcluster must be positive, and requires -format dot.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.sizeBy != "" && !isSizeMetric(args.sizeBy) {
+		err = fmt.Errorf("Unknown metric '%v' for -sizeby.\n", args.sizeBy)
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.sizeBy != "" && (args.format != formatHtml || args.diff || args.report != reportNone) {
+		err = errors.New("-sizeby only applies to HTML graphs.\n")
+		fmt.Fprintf(usageOutput, "%v", err)
+		return
+	}
+
+	if args.metrics.Damping <= 0 || args.metrics.Damping >= 1 || args.metrics.MaxIterations <= 0 {
+		err = errors.New("-damping must be between 0 and 1, and -metriciterations must be positive.\n")
 		fmt.Fprintf(usageOutput, "%v", err)
 		return
 	}
 
-	args.url = flagSet.Arg(0)
+	if !args.diff && flagSet.NArg() > 0 {
+		args.url = flagSet.Arg(0)
+		args.seeds = flagSet.Args()[1:]
+	}
+
+	args.parameters = map[string]string{"url": strings.Join(append([]string{args.url}, args.seeds...), " ")}
+	flagSet.Visit(func(f *flag.Flag) {
+		args.parameters[f.Name] = f.Value.String()
+	})
 
 	return
 }
+
+// splitList splits a comma separated list, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// needsMetrics returns whether the output shows the metrics of the pages: an
+// HTML graph sized by one of them, or an export that carries every field of a
+// node.
+func needsMetrics(args commandArgs) bool {
+	if args.report != reportNone {
+		return false
+	}
+	return args.sizeBy != "" || args.format == formatGraphML || args.format == formatGexf || args.format == formatCsv
+}
+
+func isSizeMetric(name string) bool {
+	for _, m := range R.SizeMetrics {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// patternList is a flag that may be repeated to give several scope patterns.
+// Its value is the patterns separated by newlines (which can't appear in
+// URLs), so that the flags saved in a checkpoint can be parsed again.
+type patternList []SC.Pattern
+
+func (l *patternList) String() string {
+	if l == nil {
+		return ""
+	}
+	var patterns []string
+	for _, p := range *l {
+		patterns = append(patterns, p.String())
+	}
+	return strings.Join(patterns, "\n")
+}
+
+func (l *patternList) Set(value string) error {
+	for _, s := range strings.Split(value, "\n") {
+		// An empty value (e.g. "-include=") gives no patterns.
+		if s == "" {
+			continue
+		}
+		p, err := SC.ParsePattern(s)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, p)
+	}
+	return nil
+}
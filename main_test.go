@@ -1,8 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	C "multiverse.io/crawler/crawler"
+	G "multiverse.io/crawler/crawler/graph"
+	H "multiverse.io/crawler/crawler/http_source"
 )
 
 func TestGetCommandArgs(t *testing.T) {
@@ -16,9 +27,28 @@ func TestGetCommandArgs(t *testing.T) {
 
 	{
 		var usageOutput strings.Builder
-		_, err := getCommandArgs(&usageOutput, []string{"http://foo.com", "http://foo.com"})
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com", "http://docs.foo.com", "http://blog.bar.com"})
+		if err != nil || args.url != "http://foo.com" || fmt.Sprint(args.seeds) != "[http://docs.foo.com http://blog.bar.com]" {
+			t.Errorf("Couldn't give several URLs.\n")
+		}
+		if args.parameters["url"] != "http://foo.com http://docs.foo.com http://blog.bar.com" {
+			t.Errorf("Unexpected url parameter %q.\n", args.parameters["url"])
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{})
 		if err == nil {
-			t.Errorf("Expected error if two URLs given.\n")
+			t.Errorf("Expected error if no URL given.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-hosts", "docs.foo.com, cdn.foo.com", "http://foo.com"})
+		if err != nil || fmt.Sprint(args.hosts) != "[docs.foo.com cdn.foo.com]" {
+			t.Errorf("Couldn't set -hosts.\n")
 		}
 	}
 
@@ -46,6 +76,14 @@ func TestGetCommandArgs(t *testing.T) {
 		}
 	}
 
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-checkexternal", "http://foo.com"})
+		if err != nil || !args.checkExternal || args.url != "http://foo.com" {
+			t.Errorf("Couldn't set -checkexternal.\n")
+		}
+	}
+
 	{
 		var usageOutput strings.Builder
 		_, err := getCommandArgs(&usageOutput, []string{"http://foo.com", "-noassets"})
@@ -53,4 +91,533 @@ func TestGetCommandArgs(t *testing.T) {
 			t.Errorf("Expected error if trying to set flag following URL.\n")
 		}
 	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.report != reportNone || args.reportFormat != reportFormatText {
+			t.Errorf("Unexpected default report settings.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-report", "broken", "-reportformat", "json", "http://foo.com"})
+		if err != nil || args.report != reportBroken || args.reportFormat != reportFormatJson || args.url != "http://foo.com" {
+			t.Errorf("Couldn't set -report broken -reportformat json.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-report", "nonsense", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for unknown report.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-report", "broken", "-reportformat", "xml", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for unknown report format.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-savecrawl", "crawl.json", "-maxdepth", "5", "http://foo.com"})
+		if err != nil || args.saveFile != "crawl.json" || args.loadFile != "" || args.url != "http://foo.com" {
+			t.Errorf("Couldn't set -savecrawl crawl.json.\n")
+		}
+		// Only the flags that were given are saved.
+		if len(args.parameters) != 3 || args.parameters["url"] != "http://foo.com" || args.parameters["maxdepth"] != "5" || args.parameters["savecrawl"] != "crawl.json" {
+			t.Errorf("Unexpected parameters %v.\n", args.parameters)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-loadcrawl", "crawl.json"})
+		if err != nil || args.loadFile != "crawl.json" || args.url != "" {
+			t.Errorf("Couldn't set -loadcrawl crawl.json without a URL.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-loadcrawl", "crawl.json", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error if URL given with -loadcrawl.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-diff", "old.json", "http://foo.com"})
+		if err != nil || !args.diff || args.diffInputs != [2]string{"old.json", "http://foo.com"} || args.url != "" || args.report != reportNone {
+			t.Errorf("Couldn't set -diff old.json http://foo.com.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-diff", "-report", "diff", "-reportformat", "json", "old.json", "new.json"})
+		if err != nil || !args.diff || args.report != reportDiff || args.reportFormat != reportFormatJson {
+			t.Errorf("Couldn't set -diff -report diff -reportformat json.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-diff", "old.json"})
+		if err == nil {
+			t.Errorf("Expected error if one input given with -diff.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-diff", "-report", "broken", "old.json", "new.json"})
+		if err == nil {
+			t.Errorf("Expected error for -report broken with -diff.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-report", "diff", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for -report diff without -diff.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsCache(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-cachedir", "/tmp/cache", "-offline", "http://foo.com"})
+		if err != nil || args.cacheDir != "/tmp/cache" || !args.offline {
+			t.Errorf("Couldn't set -cachedir /tmp/cache -offline.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-offline", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for -offline without -cachedir.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsPoliteness(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.hostConcurrency != 0 || args.hostDelay != 0 {
+			t.Errorf("Unexpected default politeness settings.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-hostconcurrency", "4", "-hostdelay", "250ms", "http://foo.com"})
+		if err != nil || args.hostConcurrency != 4 || args.hostDelay != 250*time.Millisecond {
+			t.Errorf("Couldn't set -hostconcurrency 4 -hostdelay 250ms.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-hostconcurrency", "-1", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for negative -hostconcurrency.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsRetries(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.retries != (H.RetryPolicy{MaxRetries: defaultRetries, InitialBackoff: defaultRetryBackoff, MaxBackoff: defaultMaxBackoff}) {
+			t.Errorf("Unexpected default retry policy %+v.\n", args.retries)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-retries", "5", "-retrybackoff", "1s", "-maxbackoff", "1m", "http://foo.com"})
+		if err != nil || args.retries != (H.RetryPolicy{MaxRetries: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute}) {
+			t.Errorf("Couldn't set -retries 5 -retrybackoff 1s -maxbackoff 1m.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-retries", "-1", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for negative -retries.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsFormat(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.format != formatHtml || args.dotCluster != 0 {
+			t.Errorf("Unexpected default format %v.\n", args.format)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-format", "dot", "-dotcluster", "2", "http://foo.com"})
+		if err != nil || args.format != formatDot || args.dotCluster != 2 {
+			t.Errorf("Couldn't set -format dot -dotcluster 2.\n")
+		}
+	}
+
+	for _, format := range []string{formatGraphML, formatGexf, formatCsv} {
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-format", format, "http://foo.com"})
+		if err != nil || args.format != format {
+			t.Errorf("Couldn't set -format %v.\n", format)
+		}
+	}
+
+	for _, argv := range [][]string{
+		{"-format", "png", "http://foo.com"},
+		{"-format", "dot", "-report", "broken", "http://foo.com"},
+		{"-format", "dot", "-diff", "http://foo.com", "http://bar.com"},
+		{"-dotcluster", "1", "http://foo.com"},
+		{"-format", "gexf", "-dotcluster", "1", "http://foo.com"},
+	} {
+		var usageOutput strings.Builder
+		if _, err := getCommandArgs(&usageOutput, argv); err == nil {
+			t.Errorf("Expected error for %v.\n", argv)
+		}
+	}
+}
+
+func TestGetCommandArgsMetrics(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.sizeBy != "" || args.metrics.Damping != G.DefaultDamping || args.metrics.MaxIterations != G.DefaultMaxIterations {
+			t.Errorf("Unexpected default metric settings %v %+v.\n", args.sizeBy, args.metrics)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-sizeby", "pagerank", "-damping", "0.5", "-metriciterations", "20", "http://foo.com"})
+		if err != nil || args.sizeBy != "pagerank" || args.metrics.Damping != 0.5 || args.metrics.MaxIterations != 20 {
+			t.Errorf("Couldn't set -sizeby pagerank -damping 0.5 -metriciterations 20.\n")
+		}
+	}
+
+	for _, argv := range [][]string{
+		{"-sizeby", "size", "http://foo.com"},
+		{"-sizeby", "hub", "-format", "dot", "http://foo.com"},
+		{"-sizeby", "hub", "-report", "broken", "http://foo.com"},
+		{"-damping", "1", "http://foo.com"},
+		{"-damping", "0", "http://foo.com"},
+		{"-metriciterations", "0", "http://foo.com"},
+	} {
+		var usageOutput strings.Builder
+		if _, err := getCommandArgs(&usageOutput, argv); err == nil {
+			t.Errorf("Expected error for %v.\n", argv)
+		}
+	}
+}
+
+func TestNeedsMetrics(t *testing.T) {
+	for _, test := range []struct {
+		argv     []string
+		expected bool
+	}{
+		{[]string{"http://foo.com"}, false},
+		{[]string{"-format", "dot", "http://foo.com"}, false},
+		{[]string{"-report", "broken", "http://foo.com"}, false},
+		{[]string{"-sizeby", "pagerank", "http://foo.com"}, true},
+		{[]string{"-format", "graphml", "http://foo.com"}, true},
+		{[]string{"-format", "gexf", "http://foo.com"}, true},
+		{[]string{"-format", "csv", "http://foo.com"}, true},
+	} {
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, test.argv)
+		if err != nil || needsMetrics(args) != test.expected {
+			t.Errorf("Expected needsMetrics to be %v for %v.\n", test.expected, test.argv)
+		}
+	}
+}
+
+func TestGetCommandArgsSitemap(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.sitemap || args.seedSitemap {
+			t.Errorf("Unexpected default sitemap settings.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-sitemap", "http://foo.com"})
+		if err != nil || !args.sitemap || args.seedSitemap {
+			t.Errorf("Couldn't set -sitemap.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-seedsitemap", "http://foo.com"})
+		if err != nil || args.sitemap || !args.seedSitemap {
+			t.Errorf("Couldn't set -seedsitemap.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsCanonicalization(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || fmt.Sprintf("%+v", args.canonicalRules) != fmt.Sprintf("%+v", H.CanonicalRules{}) || args.mergeCanonical {
+			t.Errorf("Unexpected default canonicalization settings %+v.\n", args.canonicalRules)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{
+			"-removeparams", "utm_*, fbclid,", "-sortparams", "-trailingslash", "remove",
+			"-indexfiles", "index.html,index.htm", "-lowercasepaths", "-mergecanonical", "http://foo.com"})
+		rules := args.canonicalRules
+		if err != nil ||
+			fmt.Sprint(rules.RemoveParams) != "[utm_* fbclid]" ||
+			!rules.SortParams ||
+			rules.TrailingSlash != H.TrailingSlashRemove ||
+			fmt.Sprint(rules.IndexFiles) != "[index.html index.htm]" ||
+			!rules.LowercasePaths ||
+			!args.mergeCanonical {
+			t.Errorf("Couldn't set canonicalization flags: %+v\n", rules)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-trailingslash", "sometimes", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected an error for an unknown trailing slash policy.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsScope(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || len(args.scope.Include) != 0 || len(args.scope.NoFollow) != 0 || len(args.scope.Exclude) != 0 {
+			t.Errorf("Unexpected default scope %+v.\n", args.scope)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{
+			"-include", "/docs/**", "-include", "/blog/**", "-nofollow", "/docs/archive/**",
+			"-exclude", "/search?*", "http://foo.com"})
+		if err != nil || fmt.Sprint(args.scope.Include) != "[/docs/** /blog/**]" || fmt.Sprint(args.scope.NoFollow) != "[/docs/archive/**]" || fmt.Sprint(args.scope.Exclude) != "[/search?*]" {
+			t.Errorf("Couldn't set scope flags: %+v\n", args.scope)
+		}
+
+		// The patterns are saved so that a resumed crawl has the same scope.
+		if args.parameters["include"] != "/docs/**\n/blog/**" {
+			t.Errorf("Unexpected parameter for -include: %q\n", args.parameters["include"])
+		}
+		resumed, err := getCommandArgs(&usageOutput, []string{"-include=" + args.parameters["include"], "http://foo.com"})
+		if err != nil || fmt.Sprint(resumed.scope.Include) != "[/docs/** /blog/**]" {
+			t.Errorf("Couldn't parse saved -include: %+v\n", resumed.scope)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-exclude", "re:(", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected an error for a bad pattern.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsExportSitemap(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-exportsitemap", "out", "-sitemapbase", "https://foo.com/maps/", "http://foo.com"})
+		if err != nil || args.sitemapDir != "out" || args.sitemapBase != "https://foo.com/maps/" {
+			t.Errorf("Couldn't set -exportsitemap out -sitemapbase https://foo.com/maps/.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-exportsitemap", "out", "-loadcrawl", "crawl.json"})
+		if err != nil || args.sitemapDir != "out" || args.loadFile != "crawl.json" {
+			t.Errorf("Couldn't set -exportsitemap out with -loadcrawl.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-sitemapbase", "https://foo.com/", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error for -sitemapbase without -exportsitemap.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-diff", "-exportsitemap", "out", "old.json", "new.json"})
+		if err == nil {
+			t.Errorf("Expected error for -exportsitemap with -diff.\n")
+		}
+	}
+}
+
+func TestGetCommandArgsCheckpoint(t *testing.T) {
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"http://foo.com"})
+		if err != nil || args.checkpointFile != "" || args.checkpointInterval != C.DefaultCheckpointInterval || args.resumeFile != "" {
+			t.Errorf("Unexpected default checkpoint settings.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-checkpoint", "crawl.ckpt", "-checkpointinterval", "1m", "http://foo.com"})
+		if err != nil || args.checkpointFile != "crawl.ckpt" || args.checkpointInterval != time.Minute {
+			t.Errorf("Couldn't set -checkpoint crawl.ckpt -checkpointinterval 1m.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		args, err := getCommandArgs(&usageOutput, []string{"-resume", "crawl.ckpt"})
+		if err != nil || args.resumeFile != "crawl.ckpt" || args.url != "" {
+			t.Errorf("Couldn't set -resume crawl.ckpt.\n")
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-resume", "crawl.ckpt", "http://foo.com"})
+		if err == nil {
+			t.Errorf("Expected error if URL given with -resume.\n")
+		}
+	}
+
+	for _, argv := range [][]string{
+		{"-resume", "crawl.ckpt", "-loadcrawl", "crawl.json"},
+		{"-resume", "crawl.ckpt", "-maxreqs", "10"},
+		{"-format", "dot", "-resume", "crawl.ckpt"},
+		{"-resume", "crawl.ckpt", "-report", "broken"},
+	} {
+		var usageOutput strings.Builder
+		if _, err := getCommandArgs(&usageOutput, argv); err == nil {
+			t.Errorf("Expected error for %v, as the flags are saved in the checkpoint.\n", argv)
+		}
+	}
+
+	{
+		var usageOutput strings.Builder
+		_, err := getCommandArgs(&usageOutput, []string{"-diff", "-checkpoint", "crawl.ckpt", "old.json", "new.json"})
+		if err == nil {
+			t.Errorf("Expected error for -checkpoint with -diff.\n")
+		}
+	}
+}
+
+func TestResumeWithoutScopePatterns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/a">A</a>`)
+		case "/a":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/b">B</a>`)
+		case "/b":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	checkpointFile := filepath.Join(t.TempDir(), "crawl.ckpt")
+
+	var usageOutput strings.Builder
+	args, err := getCommandArgs(&usageOutput, []string{"-checkpoint", checkpointFile, server.URL + "/"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if _, err := crawl(args, []string{args.url}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// Rewind the checkpoint to when only the root had been loaded.
+	_, checkpoint, err := loadCheckpoint(checkpointFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	root, info, err := G.FromCrawlFile(checkpoint.Graph)
+	if err != nil || len(root.Out) != 1 {
+		t.Fatalf("Unexpected checkpoint %+v (error %v)\n", checkpoint.Graph, err)
+	}
+	a := root.Out[0].Node
+	a.Out, a.Metadata = nil, nil
+	checkpoint.Graph = G.ToCrawlFile(info, root)
+	checkpoint.Frontier = []string{a.Url}
+	checkpoint.Requests = 1
+
+	f, err := os.Create(checkpointFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	err = json.NewEncoder(f).Encode(checkpoint)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	args, checkpoint, err = loadCheckpoint(checkpointFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if len(args.scope.Include) != 0 || len(args.scope.NoFollow) != 0 || len(args.scope.Exclude) != 0 {
+		t.Errorf("Expected no scope patterns when resuming; got %+v\n", args.scope)
+	}
+
+	g, err := crawl(args, append([]string{args.url}, args.seeds...), checkpoint)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	loaded := make(map[string]bool)
+	G.Traverse(g.Root(), func(node *G.Node) {
+		loaded[strings.TrimPrefix(node.Url, server.URL)] = node.Metadata != nil && node.Metadata.StatusCode == 200
+	})
+	if !loaded["/a"] || !loaded["/b"] {
+		t.Errorf("Expected the resumed crawl to follow links; got %v\n", loaded)
+	}
+}
+
+func TestIsUrl(t *testing.T) {
+	if !isUrl("http://foo.com") || !isUrl("HTTPS://foo.com") || isUrl("crawl.json") || isUrl("/tmp/http://foo.json") {
+		t.Errorf("Unexpected result from isUrl.\n")
+	}
 }